@@ -0,0 +1,255 @@
+package aggregate
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+type Statistic string
+
+const (
+	// StatisticMean is the mean of every field. The wind direction is the vector average weighted by the wind speed.
+	StatisticMean Statistic = "mean"
+	// StatisticMin is the minimum of every field except the wind direction
+	StatisticMin Statistic = "min"
+	// StatisticMax is the maximum of every field except the wind direction, such as the maximum wind gust
+	StatisticMax Statistic = "max"
+	// StatisticLast is the last value of every field
+	StatisticLast Statistic = "last"
+	// StatisticSum is the amount of rain that fell during the interval, calculated from the increase of the daily,
+	// weekly and monthly rain
+	StatisticSum Statistic = "sum"
+)
+
+var allStatistics = []Statistic{StatisticMean, StatisticMin, StatisticMax, StatisticLast, StatisticSum}
+
+func ParseStatistic(s string) (Statistic, error) {
+	for _, statistic := range allStatistics {
+		if Statistic(s) == statistic {
+			return statistic, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid statistic %q, use %s, %s, %s, %s or %s", s, StatisticMean, StatisticMin, StatisticMax, StatisticLast, StatisticSum)
+}
+
+var nullFloat64Type = reflect.TypeOf(wsupload.NullFloat64{})
+var nullInt64Type = reflect.TypeOf(wsupload.NullInt64{})
+
+// numericFields are the fields of observations that are aggregated
+var numericFields = func() []*wsupload.Field {
+	var fields []*wsupload.Field
+	for _, field := range wsupload.ObservationSchema.Fields {
+		if field.JSONName != "" && (field.Type == nullFloat64Type || field.Type == nullInt64Type) {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}()
+
+// counterFields are the fields that only increase until they are reset, by Go name
+var counterFields = map[string]bool{
+	"DailyRainMillimeters":   true,
+	"WeeklyRainMillimeters":  true,
+	"MonthlyRainMillimeters": true,
+}
+
+const (
+	windDirectionField = "WindDirectionDegrees"
+	windSpeedField     = "WindSpeedMetersPerSecond"
+)
+
+type accumulator struct {
+	count    int
+	sum      float64
+	min      float64
+	max      float64
+	last     float64
+	lastTime time.Time
+
+	// increase is the sum of the increases of a counter field
+	increase    float64
+	hasIncrease bool
+}
+
+// bucket contains the statistics of the observations of a station in a single interval.
+type bucket struct {
+	start time.Time
+	end   time.Time
+
+	softwareType string
+	fields       []accumulator
+
+	// The wind direction is averaged as unit vectors, both unweighted and weighted by the wind speed
+	windX, windY                 float64
+	weightedWindX, weightedWindY float64
+}
+
+func newBucket(start, end time.Time) *bucket {
+	return &bucket{
+		start:  start,
+		end:    end,
+		fields: make([]accumulator, len(numericFields)),
+	}
+}
+
+// fieldValue returns the value of a numeric field as float64 and whether it is set.
+func fieldValue(obs *wsupload.Observation, field *wsupload.Field) (float64, bool) {
+	v := field.Value(obs).Interface().(wsupload.Nullable)
+	if v.IsNull() {
+		return 0, false
+	}
+
+	switch value := v.Value().(type) {
+	case float64:
+		return value, true
+	case int64:
+		return float64(value), true
+	default:
+		return 0, false
+	}
+}
+
+// add adds the observation to the bucket. The increases contain the increase of each counter field since the previous
+// observation of the station, by index in numericFields.
+func (b *bucket) add(obs *wsupload.Observation, increases map[int]float64) {
+	if obs.SoftwareType != "" {
+		b.softwareType = obs.SoftwareType
+	}
+
+	var windSpeed, windDirection float64
+	var hasWindSpeed, hasWindDirection bool
+
+	for i, field := range numericFields {
+		v, ok := fieldValue(obs, field)
+		if !ok {
+			continue
+		}
+
+		acc := &b.fields[i]
+		if acc.count == 0 || v < acc.min {
+			acc.min = v
+		}
+		if acc.count == 0 || v > acc.max {
+			acc.max = v
+		}
+		if acc.count == 0 || !obs.ObservationTime.Before(acc.lastTime) {
+			acc.last = v
+			acc.lastTime = obs.ObservationTime
+		}
+		acc.count++
+		acc.sum += v
+
+		if increase, ok := increases[i]; ok {
+			acc.increase += increase
+			acc.hasIncrease = true
+		}
+
+		switch field.Name {
+		case windSpeedField:
+			windSpeed, hasWindSpeed = v, true
+		case windDirectionField:
+			windDirection, hasWindDirection = v, true
+		}
+	}
+
+	if hasWindDirection {
+		radians := windDirection * math.Pi / 180
+		b.windX += math.Cos(radians)
+		b.windY += math.Sin(radians)
+		if hasWindSpeed {
+			b.weightedWindX += windSpeed * math.Cos(radians)
+			b.weightedWindY += windSpeed * math.Sin(radians)
+		}
+	}
+}
+
+// meanWindDirection returns the vector average of the wind direction in degrees. The average is weighted by the wind
+// speed, unless it was calm during the whole interval.
+func (b *bucket) meanWindDirection() (float64, bool) {
+	x, y := b.weightedWindX, b.weightedWindY
+	if math.Hypot(x, y) < 1e-9 {
+		x, y = b.windX, b.windY
+	}
+	if math.Hypot(x, y) < 1e-9 {
+		return 0, false
+	}
+
+	// Round to whole degrees first, so the result is never 360
+	degrees := math.Round(math.Atan2(y, x) * 180 / math.Pi)
+	if degrees < 0 {
+		degrees += 360
+	}
+
+	return degrees, true
+}
+
+// observation returns the statistic of the bucket as observation with the time of the start of the interval. It
+// returns nil if no field has a value for the statistic.
+func (b *bucket) observation(stationID string, statistic Statistic, interval string) *wsupload.Observation {
+	obs := &wsupload.Observation{
+		StationID:         stationID,
+		SoftwareType:      b.softwareType,
+		ObservationTime:   b.start.UTC(),
+		Aggregate:         string(statistic),
+		AggregateInterval: interval,
+	}
+
+	var valid bool
+
+	for i, field := range numericFields {
+		acc := b.fields[i]
+		if acc.count == 0 {
+			continue
+		}
+
+		var v float64
+		ok := true
+
+		switch statistic {
+		case StatisticMean:
+			if field.Name == windDirectionField {
+				v, ok = b.meanWindDirection()
+			} else {
+				v = acc.sum / float64(acc.count)
+			}
+		case StatisticMin:
+			v, ok = acc.min, field.Name != windDirectionField
+		case StatisticMax:
+			v, ok = acc.max, field.Name != windDirectionField
+		case StatisticLast:
+			v = acc.last
+		case StatisticSum:
+			v, ok = acc.increase, acc.hasIncrease
+		}
+
+		if !ok {
+			continue
+		}
+
+		setField(obs, field, v)
+		valid = true
+	}
+
+	if !valid {
+		return nil
+	}
+
+	return obs
+}
+
+func setField(obs *wsupload.Observation, field *wsupload.Field, v float64) {
+	fieldValue := field.Value(obs)
+
+	switch fieldValue.Interface().(type) {
+	case wsupload.NullFloat64:
+		fieldValue.Set(reflect.ValueOf(wsupload.NullFloat64{Valid: true, Float64: v}))
+	case wsupload.NullInt64:
+		fieldValue.Set(reflect.ValueOf(wsupload.NullInt64{Valid: true, Int64: int64(math.Round(v))}))
+	}
+}
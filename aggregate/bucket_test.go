@@ -0,0 +1,143 @@
+package aggregate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+func windObservation(direction int64, speed float64) *wsupload.Observation {
+	return &wsupload.Observation{
+		WindDirectionDegrees:     wsupload.NullInt64{Valid: true, Int64: direction},
+		WindSpeedMetersPerSecond: wsupload.NullFloat64{Valid: true, Float64: speed},
+	}
+}
+
+func TestMeanWindDirection(t *testing.T) {
+	tests := []struct {
+		name         string
+		observations []*wsupload.Observation
+		want         float64
+		wantOK       bool
+	}{
+		{
+			name:         "across north",
+			observations: []*wsupload.Observation{windObservation(350, 2), windObservation(10, 2)},
+			want:         0,
+			wantOK:       true,
+		},
+		{
+			name:         "weighted by speed",
+			observations: []*wsupload.Observation{windObservation(0, 1), windObservation(90, 3)},
+			want:         72,
+			wantOK:       true,
+		},
+		{
+			name:         "west",
+			observations: []*wsupload.Observation{windObservation(260, 5), windObservation(280, 5)},
+			want:         270,
+			wantOK:       true,
+		},
+		{
+			name:         "calm",
+			observations: []*wsupload.Observation{windObservation(0, 0), windObservation(90, 0)},
+			want:         45,
+			wantOK:       true,
+		},
+		{
+			name:         "calm with unknown speed",
+			observations: []*wsupload.Observation{{WindDirectionDegrees: wsupload.NullInt64{Valid: true, Int64: 180}}},
+			want:         180,
+			wantOK:       true,
+		},
+		{
+			name:         "opposite",
+			observations: []*wsupload.Observation{windObservation(0, 2), windObservation(180, 2)},
+		},
+		{
+			name:         "no direction",
+			observations: []*wsupload.Observation{{WindSpeedMetersPerSecond: wsupload.NullFloat64{Valid: true, Float64: 2}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBucket(time.Time{}, time.Time{})
+			for _, obs := range tt.observations {
+				b.add(obs, nil)
+			}
+
+			got, ok := b.meanWindDirection()
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("meanWindDirection() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestBucketObservation(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	b := newBucket(start, start.Add(time.Hour))
+
+	observations := []struct {
+		minute      int
+		temperature float64
+		direction   int64
+		speed       float64
+	}{
+		{minute: 0, temperature: 20, direction: 350, speed: 4},
+		// Observations can be added out of order, the last value is the value of the latest observation
+		{minute: 30, temperature: 24, direction: 10, speed: 4},
+		{minute: 15, temperature: 19, direction: 0, speed: 8},
+	}
+	for _, o := range observations {
+		b.add(&wsupload.Observation{
+			SoftwareType:              "console",
+			ObservationTime:           start.Add(time.Duration(o.minute) * time.Minute),
+			OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: o.temperature},
+			WindDirectionDegrees:      wsupload.NullInt64{Valid: true, Int64: o.direction},
+			WindSpeedMetersPerSecond:  wsupload.NullFloat64{Valid: true, Float64: o.speed},
+		}, nil)
+	}
+
+	tests := []struct {
+		statistic       Statistic
+		wantTemperature float64
+		wantSpeed       float64
+		wantDirection   wsupload.NullInt64
+	}{
+		{statistic: StatisticMean, wantTemperature: 21, wantSpeed: 16.0 / 3, wantDirection: wsupload.NullInt64{Valid: true, Int64: 0}},
+		{statistic: StatisticMin, wantTemperature: 19, wantSpeed: 4},
+		{statistic: StatisticMax, wantTemperature: 24, wantSpeed: 8},
+		{statistic: StatisticLast, wantTemperature: 24, wantSpeed: 4, wantDirection: wsupload.NullInt64{Valid: true, Int64: 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.statistic), func(t *testing.T) {
+			obs := b.observation("station", tt.statistic, "1h")
+			if obs == nil {
+				t.Fatal("observation() = nil")
+			}
+
+			if obs.StationID != "station" || obs.SoftwareType != "console" || !obs.ObservationTime.Equal(start) || obs.Aggregate != string(tt.statistic) || obs.AggregateInterval != "1h" {
+				t.Errorf("observation() = %+v", obs)
+			}
+			if got := obs.OutsideTemperatureCelsius; !got.Valid || math.Abs(got.Float64-tt.wantTemperature) > 1e-9 {
+				t.Errorf("OutsideTemperatureCelsius = %+v, want %v", got, tt.wantTemperature)
+			}
+			if got := obs.WindSpeedMetersPerSecond; !got.Valid || math.Abs(got.Float64-tt.wantSpeed) > 1e-9 {
+				t.Errorf("WindSpeedMetersPerSecond = %+v, want %v", got, tt.wantSpeed)
+			}
+			if obs.WindDirectionDegrees != tt.wantDirection {
+				t.Errorf("WindDirectionDegrees = %+v, want %+v", obs.WindDirectionDegrees, tt.wantDirection)
+			}
+		})
+	}
+
+	// Without counter increases there is nothing to sum
+	if obs := b.observation("station", StatisticSum, "1h"); obs != nil {
+		t.Errorf("observation(sum) = %+v, want nil", obs)
+	}
+}
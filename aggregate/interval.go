@@ -0,0 +1,70 @@
+package aggregate
+
+import (
+	"fmt"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// validateInterval returns an error if the interval cannot be aligned to midnight. Intervals shorter than a day must
+// divide a day, longer intervals must be a whole number of days.
+func validateInterval(interval time.Duration) error {
+	switch {
+	case interval <= 0:
+		return fmt.Errorf("interval %s must be positive", interval)
+	case interval < day && day%interval != 0:
+		return fmt.Errorf("interval %s must divide a day", interval)
+	case interval >= day && interval%day != 0:
+		return fmt.Errorf("interval %s must be a whole number of days", interval)
+	}
+
+	return nil
+}
+
+// intervalBounds returns the start and end of the interval containing t. Intervals are aligned to midnight in the
+// location, so daily intervals follow the local days even if they are 23 or 25 hours long.
+func intervalBounds(t time.Time, interval time.Duration, location *time.Location) (time.Time, time.Time) {
+	local := t.In(location)
+	year, month, dayOfMonth := local.Date()
+
+	if interval >= day {
+		days := int(interval / day)
+
+		// Count the days since the Unix epoch in the calendar of the location, so multi-day intervals are aligned to
+		// the same days in every location
+		epochDay := int(time.Date(year, month, dayOfMonth, 0, 0, 0, 0, time.UTC).Unix() / int64(day/time.Second))
+		startDay := epochDay - mod(epochDay, days)
+
+		return time.Date(1970, time.January, 1+startDay, 0, 0, 0, 0, location), time.Date(1970, time.January, 1+startDay+days, 0, 0, 0, 0, location)
+	}
+
+	midnight := time.Date(year, month, dayOfMonth, 0, 0, 0, 0, location)
+	nextMidnight := time.Date(year, month, dayOfMonth+1, 0, 0, 0, 0, location)
+
+	start := midnight.Add(t.Sub(midnight) / interval * interval)
+	end := start.Add(interval)
+	if end.After(nextMidnight) {
+		end = nextMidnight
+	}
+
+	return start, end
+}
+
+func mod(a, b int) int {
+	return (a%b + b) % b
+}
+
+// intervalName returns a short name of the interval, such as 5m, 1h or 1d.
+func intervalName(interval time.Duration) string {
+	switch {
+	case interval%day == 0:
+		return fmt.Sprintf("%dd", interval/day)
+	case interval%time.Hour == 0:
+		return fmt.Sprintf("%dh", interval/time.Hour)
+	case interval%time.Minute == 0:
+		return fmt.Sprintf("%dm", interval/time.Minute)
+	default:
+		return interval.String()
+	}
+}
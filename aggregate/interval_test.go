@@ -0,0 +1,164 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateInterval(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		wantErr  bool
+	}{
+		{interval: time.Minute},
+		{interval: 5 * time.Minute},
+		{interval: 3 * time.Hour},
+		{interval: day},
+		{interval: 7 * day},
+		{interval: 0, wantErr: true},
+		{interval: -time.Hour, wantErr: true},
+		{interval: 7 * time.Minute, wantErr: true},
+		{interval: 5 * time.Hour, wantErr: true},
+		{interval: 36 * time.Hour, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interval.String(), func(t *testing.T) {
+			if err := validateInterval(tt.interval); (err != nil) != tt.wantErr {
+				t.Errorf("validateInterval() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIntervalBounds(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		interval  time.Duration
+		location  *time.Location
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "five minutes",
+			t:         time.Date(2024, 6, 1, 12, 7, 30, 0, time.UTC),
+			interval:  5 * time.Minute,
+			location:  time.UTC,
+			wantStart: time.Date(2024, 6, 1, 12, 5, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 6, 1, 12, 10, 0, 0, time.UTC),
+		},
+		{
+			name:      "start of interval",
+			t:         time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+			interval:  time.Hour,
+			location:  time.UTC,
+			wantStart: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "hour in half hour offset",
+			t:         time.Date(2024, 6, 1, 12, 10, 0, 0, time.UTC),
+			interval:  time.Hour,
+			location:  kolkata,
+			wantStart: time.Date(2024, 6, 1, 11, 30, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "day in time zone",
+			t:         time.Date(2024, 6, 1, 23, 0, 0, 0, time.UTC),
+			interval:  day,
+			location:  amsterdam,
+			wantStart: time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 6, 2, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "day with daylight saving time start",
+			t:         time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC),
+			interval:  day,
+			location:  amsterdam,
+			wantStart: time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "day with daylight saving time end",
+			t:         time.Date(2024, 10, 27, 12, 0, 0, 0, time.UTC),
+			interval:  day,
+			location:  amsterdam,
+			wantStart: time.Date(2024, 10, 26, 22, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 10, 27, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "three hours on daylight saving time start",
+			t:         time.Date(2024, 3, 31, 0, 30, 0, 0, time.UTC),
+			interval:  3 * time.Hour,
+			location:  amsterdam,
+			wantStart: time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 3, 31, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "last interval cut off at midnight",
+			t:         time.Date(2024, 3, 31, 21, 30, 0, 0, time.UTC),
+			interval:  3 * time.Hour,
+			location:  amsterdam,
+			wantStart: time.Date(2024, 3, 31, 20, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 3, 31, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "week",
+			t:         time.Date(2024, 6, 5, 12, 0, 0, 0, time.UTC),
+			interval:  7 * day,
+			location:  time.UTC,
+			wantStart: time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 6, 6, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "week in time zone",
+			t:         time.Date(2024, 6, 5, 23, 0, 0, 0, time.UTC),
+			interval:  7 * day,
+			location:  amsterdam,
+			wantStart: time.Date(2024, 6, 5, 22, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2024, 6, 12, 22, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := intervalBounds(tt.t, tt.interval, tt.location)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("intervalBounds() = %s, %s, want %s, %s", start.UTC(), end.UTC(), tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestIntervalName(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		want     string
+	}{
+		{interval: 5 * time.Minute, want: "5m"},
+		{interval: 90 * time.Minute, want: "90m"},
+		{interval: time.Hour, want: "1h"},
+		{interval: day, want: "1d"},
+		{interval: 7 * day, want: "7d"},
+		{interval: 30 * time.Second, want: "30s"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := intervalName(tt.interval); got != tt.want {
+				t.Errorf("intervalName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/koesie10/ws-upload/config"
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+)
+
+const PublisherType = "aggregate"
+
+// flushInterval is how often intervals are checked for being complete when no observations are received
+const flushInterval = 10 * time.Second
+
+var _ wsupload.Publisher = (*publisher)(nil)
+var _ wsupload.HealthReporter = (*publisher)(nil)
+var _ wsupload.StatefulPublisher = (*publisher)(nil)
+
+func init() {
+	wsupload.RegisterPublisher(wsupload.PublisherFactory{
+		Type: PublisherType,
+		NewOptions: func() interface{} {
+			options := DefaultPublisherOptions()
+			return &options
+		},
+		New: func(logger *zap.Logger, options interface{}) (wsupload.Publisher, error) {
+			return NewPublisher(logger, *options.(*PublisherOptions))
+		},
+	})
+}
+
+type PublisherOptions struct {
+	// Intervals are the lengths of the intervals, which are aligned to midnight. Intervals shorter than a day must
+	// divide a day, longer intervals must be a whole number of days.
+	Intervals []time.Duration `flag:"intervals"`
+	// Statistics are the statistics published for every interval
+	Statistics []string `flag:"statistics"`
+	// Timezone is the IANA time zone of the midnight the intervals are aligned to, defaults to UTC
+	Timezone string `flag:"timezone"`
+	// Delay is how long to wait for late observations after the end of an interval before publishing it, if no newer
+	// observation of the station is received
+	Delay time.Duration `flag:"delay"`
+	// Publishers are the publishers the aggregated observations are published to, configured in the same way as the
+	// top-level publishers
+	Publishers []config.Publisher `flag:"publishers"`
+}
+
+func DefaultPublisherOptions() PublisherOptions {
+	return PublisherOptions{
+		Intervals: []time.Duration{5 * time.Minute, time.Hour, 24 * time.Hour},
+		Statistics: []string{
+			string(StatisticMean),
+			string(StatisticMin),
+			string(StatisticMax),
+			string(StatisticLast),
+			string(StatisticSum),
+		},
+		Delay: time.Minute,
+	}
+}
+
+type intervalKey struct {
+	stationID string
+	interval  time.Duration
+}
+
+type intervalState struct {
+	current *bucket
+	// published is the end of the last published interval, later observations before it are dropped
+	published time.Time
+}
+
+// counterState contains the last values of the counter fields of a station.
+type counterState struct {
+	time   time.Time
+	values map[int]float64
+}
+
+type publisher struct {
+	logger *zap.Logger
+
+	options    PublisherOptions
+	location   *time.Location
+	statistics []Statistic
+
+	publishers     []wsupload.Publisher
+	publisherNames []string
+
+	mu        sync.Mutex
+	intervals map[intervalKey]*intervalState
+	counters  map[string]*counterState
+	// replacement is the publisher that took over the intervals of this publisher, observations are published to it
+	replacement *publisher
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewPublisher creates a publisher that aggregates observations per interval and publishes each statistic of an
+// interval as an observation to its publishers once the interval is complete.
+func NewPublisher(logger *zap.Logger, options PublisherOptions) (wsupload.Publisher, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	if len(options.Intervals) == 0 {
+		return nil, errors.New("at least one interval is required")
+	}
+	names := make(map[string]struct{}, len(options.Intervals))
+	for _, interval := range options.Intervals {
+		if err := validateInterval(interval); err != nil {
+			return nil, err
+		}
+		if _, ok := names[intervalName(interval)]; ok {
+			return nil, fmt.Errorf("duplicate interval %s", interval)
+		}
+		names[intervalName(interval)] = struct{}{}
+	}
+
+	if len(options.Statistics) == 0 {
+		return nil, errors.New("at least one statistic is required")
+	}
+	statistics := make([]Statistic, len(options.Statistics))
+	for i, s := range options.Statistics {
+		statistic, err := ParseStatistic(s)
+		if err != nil {
+			return nil, err
+		}
+		statistics[i] = statistic
+	}
+
+	location := time.UTC
+	if options.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(options.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone: %w", err)
+		}
+	}
+
+	if options.Delay < 0 {
+		return nil, errors.New("delay must not be negative")
+	}
+
+	if len(options.Publishers) == 0 {
+		return nil, errors.New("at least one publisher is required")
+	}
+
+	p := &publisher{
+		logger: logger,
+
+		options:    options,
+		location:   location,
+		statistics: statistics,
+
+		intervals: make(map[intervalKey]*intervalState),
+		counters:  make(map[string]*counterState),
+
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if err := p.createPublishers(); err != nil {
+		return nil, err
+	}
+
+	go p.run()
+
+	return p, nil
+}
+
+func (p *publisher) createPublishers() (err error) {
+	defer func() {
+		if err != nil {
+			p.closePublishers()
+		}
+	}()
+
+	for i, publisherConfig := range p.options.Publishers {
+		if publisherConfig.Type == "" {
+			return fmt.Errorf("publisher %d has no type", i)
+		}
+		if publisherConfig.Name == "" {
+			publisherConfig.Name = publisherConfig.Type
+		}
+
+		factory, options, err := config.DecodePublisherOptions(publisherConfig)
+		if err != nil {
+			return err
+		}
+
+		entry := p.logger.With(zap.String("aggregate.publisher.name", publisherConfig.Name), zap.String("aggregate.publisher.type", publisherConfig.Type))
+
+		publisher, err := factory.New(entry, options)
+		if err != nil {
+			return fmt.Errorf("failed to create publisher %s: %w", publisherConfig.Name, err)
+		}
+		p.publishers = append(p.publishers, publisher)
+		p.publisherNames = append(p.publisherNames, publisherConfig.Name)
+
+		entry.Info("Aggregate publisher enabled")
+	}
+
+	return nil
+}
+
+func (p *publisher) Publish(obs *wsupload.Observation) error {
+	p.mu.Lock()
+
+	if replacement := p.replacement; replacement != nil {
+		p.mu.Unlock()
+		return replacement.Publish(obs)
+	}
+
+	increases := p.counterIncreases(obs)
+
+	var complete []*aggregated
+	for _, interval := range p.options.Intervals {
+		key := intervalKey{stationID: obs.StationID, interval: interval}
+
+		state, ok := p.intervals[key]
+		if !ok {
+			state = &intervalState{}
+			p.intervals[key] = state
+		}
+
+		if obs.ObservationTime.Before(state.published) || (state.current != nil && obs.ObservationTime.Before(state.current.start)) {
+			p.logger.Debug("Dropping late observation for aggregate", zap.String("aggregate.interval", intervalName(interval)), zap.Time("ws_upload.observation_time", obs.ObservationTime))
+			continue
+		}
+
+		if state.current != nil && !obs.ObservationTime.Before(state.current.end) {
+			complete = append(complete, p.complete(key, state))
+		}
+
+		if state.current == nil {
+			state.current = newBucket(intervalBounds(obs.ObservationTime, interval, p.location))
+		}
+
+		state.current.add(obs, increases)
+	}
+
+	p.mu.Unlock()
+
+	return p.publishAggregated(complete)
+}
+
+// TakeState moves the incomplete intervals and counters of the previous publisher to this publisher, so they are not
+// discarded when the configuration is reloaded. Intervals are only moved if this publisher has the same interval and
+// time zone, others are published or discarded when the previous publisher is closed. The state of the publishers is
+// moved to the publishers of the same name and type, like the top-level publishers.
+func (p *publisher) TakeState(previous wsupload.Publisher) {
+	prev, ok := previous.(*publisher)
+	if !ok {
+		return
+	}
+
+	for i, publisher := range p.publishers {
+		statefulPublisher, ok := publisher.(wsupload.StatefulPublisher)
+		if !ok {
+			continue
+		}
+
+		for j, previousPublisher := range prev.publishers {
+			if prev.publisherNames[j] == p.publisherNames[i] && prev.options.Publishers[j].Type == p.options.Publishers[i].Type {
+				statefulPublisher.TakeState(previousPublisher)
+			}
+		}
+	}
+
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if prev.location.String() != p.location.String() {
+		return
+	}
+
+	intervals := make(map[time.Duration]bool, len(p.options.Intervals))
+	for _, interval := range p.options.Intervals {
+		intervals[interval] = true
+	}
+
+	for key, state := range prev.intervals {
+		if intervals[key.interval] {
+			p.intervals[key] = state
+			delete(prev.intervals, key)
+		}
+	}
+
+	p.counters = prev.counters
+	prev.counters = make(map[string]*counterState)
+	prev.replacement = p
+}
+
+// counterIncreases returns the increase of the counter fields since the previous observation of the station. A
+// decrease means the counter was reset, so the new value is the increase.
+func (p *publisher) counterIncreases(obs *wsupload.Observation) map[int]float64 {
+	state, ok := p.counters[obs.StationID]
+	if !ok {
+		state = &counterState{values: make(map[int]float64)}
+		p.counters[obs.StationID] = state
+	}
+
+	// Counters cannot be compared to an earlier observation
+	if obs.ObservationTime.Before(state.time) {
+		return nil
+	}
+	state.time = obs.ObservationTime
+
+	increases := make(map[int]float64)
+	for i, field := range numericFields {
+		if !counterFields[field.Name] {
+			continue
+		}
+
+		v, ok := fieldValue(obs, field)
+		if !ok {
+			continue
+		}
+
+		if previous, ok := state.values[i]; ok {
+			if v >= previous {
+				increases[i] = v - previous
+			} else {
+				increases[i] = v
+			}
+		}
+		state.values[i] = v
+	}
+
+	return increases
+}
+
+// aggregated contains the observations of a complete interval.
+type aggregated struct {
+	interval     string
+	observations []*wsupload.Observation
+}
+
+// complete removes the current bucket of the interval and returns its observations. The lock must be held.
+func (p *publisher) complete(key intervalKey, state *intervalState) *aggregated {
+	b := state.current
+	state.current = nil
+	state.published = b.end
+
+	result := &aggregated{
+		interval: intervalName(key.interval),
+	}
+	for _, statistic := range p.statistics {
+		if obs := b.observation(key.stationID, statistic, result.interval); obs != nil {
+			result.observations = append(result.observations, obs)
+		}
+	}
+
+	return result
+}
+
+func (p *publisher) publishAggregated(complete []*aggregated) error {
+	var errs []error
+
+	for _, a := range complete {
+		for _, obs := range a.observations {
+			for i, publisher := range p.publishers {
+				if err := publisher.Publish(obs); err != nil {
+					errs = append(errs, fmt.Errorf("failed to publish %s %s aggregate to publisher %s: %w", a.interval, obs.Aggregate, p.publisherNames[i], err))
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// flush publishes all intervals which ended before the time.
+func (p *publisher) flush(before time.Time) error {
+	p.mu.Lock()
+
+	var complete []*aggregated
+	for key, state := range p.intervals {
+		if state.current != nil && !state.current.end.After(before) {
+			complete = append(complete, p.complete(key, state))
+		}
+	}
+
+	p.mu.Unlock()
+
+	return p.publishAggregated(complete)
+}
+
+func (p *publisher) run() {
+	defer close(p.stopped)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			if err := p.flush(time.Now().Add(-p.options.Delay)); err != nil {
+				p.logger.Error("Failed to publish aggregates", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Health returns the worst health of the publishers.
+func (p *publisher) Health() wsupload.Health {
+	health := wsupload.Health{
+		State: wsupload.HealthStateConnected,
+	}
+
+	for _, publisher := range p.publishers {
+		if h := wsupload.PublisherHealth(publisher); h.State.Worse(health.State) {
+			health = h
+		}
+	}
+
+	return health
+}
+
+// Close publishes all complete intervals and closes the publishers. Observations of incomplete intervals are
+// discarded. It can be called multiple times.
+func (p *publisher) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+		<-p.stopped
+
+		if err := p.flush(time.Now()); err != nil {
+			p.logger.Error("Failed to publish aggregates", zap.Error(err))
+		}
+
+		p.mu.Lock()
+		for key, state := range p.intervals {
+			if state.current != nil {
+				p.logger.Info("Discarding incomplete aggregate", zap.String("aggregate.interval", intervalName(key.interval)), zap.String("ws_upload.station_id", key.stationID))
+			}
+		}
+		p.mu.Unlock()
+
+		p.closeErr = p.closePublishers()
+	})
+
+	return p.closeErr
+}
+
+func (p *publisher) closePublishers() error {
+	var errs []error
+	for i, publisher := range p.publishers {
+		if err := publisher.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close publisher %s: %w", p.publisherNames[i], err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
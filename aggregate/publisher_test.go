@@ -0,0 +1,222 @@
+package aggregate
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+)
+
+type recordingPublisher struct {
+	observations []*wsupload.Observation
+}
+
+func (p *recordingPublisher) Publish(obs *wsupload.Observation) error {
+	p.observations = append(p.observations, obs)
+	return nil
+}
+
+func (p *recordingPublisher) Close() error {
+	return nil
+}
+
+// newTestPublisher creates a publisher which publishes to the recording publisher and is only flushed explicitly.
+func newTestPublisher(intervals []time.Duration, statistics []Statistic) (*publisher, *recordingPublisher) {
+	recorder := &recordingPublisher{}
+
+	return &publisher{
+		logger: zap.NewNop(),
+
+		options:    PublisherOptions{Intervals: intervals},
+		location:   time.UTC,
+		statistics: statistics,
+
+		publishers:     []wsupload.Publisher{recorder},
+		publisherNames: []string{"recorder"},
+
+		intervals: make(map[intervalKey]*intervalState),
+		counters:  make(map[string]*counterState),
+	}, recorder
+}
+
+func rainObservation(t time.Time, daily float64) *wsupload.Observation {
+	return &wsupload.Observation{
+		StationID:            "station",
+		ObservationTime:      t,
+		DailyRainMillimeters: wsupload.NullFloat64{Valid: true, Float64: daily},
+	}
+}
+
+func TestCounterIncreases(t *testing.T) {
+	start := time.Date(2024, 6, 1, 23, 40, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		daily []float64
+		// times are the minutes after start of the observations, defaults to every 5 minutes
+		minutes []int
+		want    float64
+	}{
+		{
+			name:  "increasing",
+			daily: []float64{1, 1.5, 3},
+			want:  2,
+		},
+		{
+			name:  "reset at midnight",
+			daily: []float64{10, 12, 0.5, 1},
+			want:  3,
+		},
+		{
+			name:  "reset to zero",
+			daily: []float64{4, 0, 0},
+			want:  0,
+		},
+		{
+			name:    "earlier observation is ignored",
+			daily:   []float64{1, 2, 1.5, 3},
+			minutes: []int{0, 10, 5, 15},
+			want:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, recorder := newTestPublisher([]time.Duration{time.Hour}, []Statistic{StatisticSum})
+
+			for i, daily := range tt.daily {
+				minute := 5 * i
+				if tt.minutes != nil {
+					minute = tt.minutes[i]
+				}
+				if err := p.Publish(rainObservation(start.Add(time.Duration(minute)*time.Minute), daily)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := p.flush(start.Add(24 * time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+
+			var sum float64
+			for _, obs := range recorder.observations {
+				if !obs.DailyRainMillimeters.Valid {
+					t.Errorf("DailyRainMillimeters of %s aggregate = null", obs.ObservationTime)
+					continue
+				}
+				sum += obs.DailyRainMillimeters.Float64
+			}
+			if math.Abs(sum-tt.want) > 1e-9 {
+				t.Errorf("sum = %v, want %v", sum, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublish(t *testing.T) {
+	p, recorder := newTestPublisher([]time.Duration{5 * time.Minute, time.Hour}, []Statistic{StatisticMean, StatisticSum})
+
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, o := range []struct {
+		minute int
+		daily  float64
+	}{
+		{minute: 1, daily: 1},
+		{minute: 3, daily: 2},
+		{minute: 6, daily: 4},
+		// Late observations are dropped by published intervals but added to the current hour, without an increase
+		{minute: 2, daily: 4},
+	} {
+		if err := p.Publish(rainObservation(start.Add(time.Duration(o.minute)*time.Minute), o.daily)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first 5 minute interval is published by the observation of the next interval
+	if len(recorder.observations) != 2 {
+		t.Fatalf("got %d observations, want the mean and sum of the first interval", len(recorder.observations))
+	}
+	for _, obs := range recorder.observations {
+		if !obs.ObservationTime.Equal(start) || obs.AggregateInterval != "5m" {
+			t.Errorf("observation = %+v, want the first 5m interval", obs)
+		}
+		switch obs.Aggregate {
+		case string(StatisticMean):
+			if obs.DailyRainMillimeters.Float64 != 1.5 {
+				t.Errorf("mean = %v, want 1.5", obs.DailyRainMillimeters.Float64)
+			}
+		case string(StatisticSum):
+			if obs.DailyRainMillimeters.Float64 != 1 {
+				t.Errorf("sum = %v, want 1", obs.DailyRainMillimeters.Float64)
+			}
+		}
+	}
+
+	// Intervals are not published before they end
+	recorder.observations = nil
+	if err := p.flush(start.Add(10 * time.Minute).Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.observations) != 0 {
+		t.Fatalf("got %d observations, want none", len(recorder.observations))
+	}
+
+	if err := p.flush(start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]float64)
+	for _, obs := range recorder.observations {
+		got[obs.AggregateInterval+" "+obs.Aggregate] = obs.DailyRainMillimeters.Float64
+	}
+	want := map[string]float64{
+		"5m mean": 4,
+		"5m sum":  2,
+		"1h mean": 2.75,
+		"1h sum":  3,
+	}
+	for name, v := range want {
+		if math.Abs(got[name]-v) > 1e-9 {
+			t.Errorf("%s = %v, want %v", name, got[name], v)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTakeState(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	previous, previousRecorder := newTestPublisher([]time.Duration{5 * time.Minute, time.Hour}, []Statistic{StatisticSum})
+	if err := previous.Publish(rainObservation(start, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := previous.Publish(rainObservation(start.Add(time.Minute), 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	p, recorder := newTestPublisher([]time.Duration{time.Hour}, []Statistic{StatisticSum})
+	p.TakeState(previous)
+
+	// Observations published to the previous publisher are forwarded to the replacement
+	if err := previous.Publish(rainObservation(start.Add(2*time.Minute), 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.flush(start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.observations) != 1 || recorder.observations[0].DailyRainMillimeters.Float64 != 3 {
+		t.Errorf("observations = %+v, want a single 1h sum of 3", recorder.observations)
+	}
+
+	// The 5 minute interval is not taken over, so it stays with the previous publisher
+	if err := previous.flush(start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if len(previousRecorder.observations) != 1 || previousRecorder.observations[0].AggregateInterval != "5m" {
+		t.Errorf("previous observations = %+v, want the 5m interval", previousRecorder.observations)
+	}
+}
@@ -0,0 +1,405 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+)
+
+const (
+	// checkInterval is how often the no-upload rules are checked
+	checkInterval = 30 * time.Second
+	// sendTimeout is the maximum time to deliver an alert to a sink
+	sendTimeout = 30 * time.Second
+)
+
+type Options struct {
+	Rules []RuleOptions `flag:"rules"`
+	Sinks []SinkOptions `flag:"sinks"`
+}
+
+type State string
+
+const (
+	StateFiring   State = "firing"
+	StateResolved State = "resolved"
+)
+
+// Alert is delivered to the sinks when a rule fires or is resolved.
+type Alert struct {
+	Rule      string    `json:"rule"`
+	StationID string    `json:"station_id"`
+	State     State     `json:"state"`
+	Condition string    `json:"condition"`
+	Value     *float64  `json:"value,omitempty"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message"`
+}
+
+type stateKey struct {
+	rule      *rule
+	stationID string
+}
+
+// Engine evaluates the rules on every observation and delivers alerts to the sinks. It is safe for concurrent use.
+type Engine struct {
+	logger *zap.Logger
+
+	rules     []*rule
+	sinks     []Sink
+	sinkNames []string
+	// ruleSinks contains the indexes of the sinks of every rule
+	ruleSinks map[*rule][]int
+
+	mu     sync.Mutex
+	states map[stateKey]*ruleState
+	// lastSeen contains the server time of the last observation of every station
+	lastSeen map[string]time.Time
+	// closed is set once Close is called, after which no alerts are sent
+	closed bool
+	// replacement is the engine that took over the state of this engine, observations are evaluated by it
+	replacement *Engine
+
+	pending sync.WaitGroup
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewEngine creates an engine. The no-upload rules apply to the given stations from the start, and to other stations
+// once they have uploaded.
+func NewEngine(logger *zap.Logger, options Options, stationIDs []string) (*Engine, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	e := &Engine{
+		logger: logger,
+
+		ruleSinks: make(map[*rule][]int),
+
+		states:   make(map[stateKey]*ruleState),
+		lastSeen: make(map[string]time.Time),
+
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	sinkIndexes := make(map[string]int)
+	for i, sinkOptions := range options.Sinks {
+		sink, name, err := newSink(sinkOptions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sink %d: %w", i, err)
+		}
+		if _, ok := sinkIndexes[name]; ok {
+			return nil, fmt.Errorf("duplicate sink %s, set a unique name", name)
+		}
+		sinkIndexes[name] = len(e.sinks)
+
+		e.sinks = append(e.sinks, sink)
+		e.sinkNames = append(e.sinkNames, name)
+	}
+
+	ruleNames := make(map[string]struct{})
+	for _, ruleOptions := range options.Rules {
+		r, err := newRule(ruleOptions)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := ruleNames[r.Name]; ok {
+			return nil, fmt.Errorf("duplicate rule %s", r.Name)
+		}
+		ruleNames[r.Name] = struct{}{}
+
+		if len(r.Sinks) == 0 {
+			for i := range e.sinks {
+				e.ruleSinks[r] = append(e.ruleSinks[r], i)
+			}
+		}
+		for _, name := range r.Sinks {
+			i, ok := sinkIndexes[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown sink %s of rule %s", name, r.Name)
+			}
+			e.ruleSinks[r] = append(e.ruleSinks[r], i)
+		}
+
+		e.rules = append(e.rules, r)
+	}
+
+	if len(e.rules) > 0 && len(e.sinks) == 0 {
+		return nil, errors.New("alert rules require at least one sink")
+	}
+
+	now := time.Now()
+	for _, stationID := range stationIDs {
+		e.lastSeen[stationID] = now
+	}
+
+	go e.run()
+
+	return e, nil
+}
+
+// Seen records that the station uploaded, which resolves the no-upload rules of the station. It is called for every
+// upload, including uploads whose observation is discarded. The now time is the server time the upload was received.
+func (e *Engine) Seen(stationID string, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.replacement != nil {
+		// Locks are always taken from the previous to the replacement engine, as in TakeState
+		e.replacement.Seen(stationID, now)
+		return
+	}
+
+	e.seen(stationID, now)
+}
+
+// seen records that the station uploaded. The lock must be held.
+func (e *Engine) seen(stationID string, now time.Time) {
+	// Replayed observations are received at an earlier time
+	if now.After(e.lastSeen[stationID]) {
+		e.lastSeen[stationID] = now
+	}
+
+	for _, r := range e.rules {
+		if !r.noUpload || !r.appliesTo(stationID) {
+			continue
+		}
+
+		state := e.state(r, stationID)
+		if state.firing && state.resolve() {
+			e.send(r, Alert{
+				Rule:      r.Name,
+				StationID: stationID,
+				State:     StateResolved,
+				Condition: r.Condition,
+				Time:      now,
+				Message:   fmt.Sprintf("Resolved %s: station %s uploads again", r.Name, stationID),
+			})
+		}
+	}
+}
+
+// Observe evaluates the rules on the observation and records that the station uploaded. The now time is the server
+// time the observation was received.
+func (e *Engine) Observe(obs *wsupload.Observation, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.replacement != nil {
+		// Locks are always taken from the previous to the replacement engine, as in TakeState
+		e.replacement.Observe(obs, now)
+		return
+	}
+
+	e.seen(obs.StationID, now)
+
+	for _, r := range e.rules {
+		if r.noUpload || !r.appliesTo(obs.StationID) {
+			continue
+		}
+
+		state := e.state(r, obs.StationID)
+
+		v, err := r.value(obs)
+		if err != nil {
+			// The state is kept as is if the station did not send the field
+			continue
+		}
+
+		t := obs.ObservationTime
+
+		if state.firing {
+			if r.resolved(v) && state.resolve() {
+				e.send(r, e.valueAlert(r, obs.StationID, StateResolved, v, t))
+			}
+			continue
+		}
+
+		if !r.met(v) {
+			state.pendingSince = time.Time{}
+			continue
+		}
+
+		if state.pendingSince.IsZero() {
+			state.pendingSince = t
+		}
+
+		if t.Sub(state.pendingSince) >= r.For && state.fire(r, t) {
+			e.send(r, e.valueAlert(r, obs.StationID, StateFiring, v, t))
+		}
+	}
+}
+
+func (e *Engine) valueAlert(r *rule, stationID string, state State, v float64, t time.Time) Alert {
+	value := strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+
+	message := fmt.Sprintf("%s: %s at station %s (value %s)", r.Name, r.Condition, stationID, value)
+	if r.For > 0 {
+		message = fmt.Sprintf("%s: %s for %s at station %s (value %s)", r.Name, r.Condition, r.For, stationID, value)
+	}
+	if state == StateResolved {
+		message = "Resolved " + message
+	}
+
+	return Alert{
+		Rule:      r.Name,
+		StationID: stationID,
+		State:     state,
+		Condition: r.Condition,
+		Value:     &v,
+		Time:      t,
+		Message:   message,
+	}
+}
+
+// TakeState moves the state of the previous engine to this engine, so firing alerts, pending conditions and cooldowns
+// are kept when the configuration is reloaded. The state of a rule is only kept if a rule with the same name, station
+// and condition exists in this engine. Observations of the previous engine are evaluated by this engine afterwards.
+func (e *Engine) TakeState(previous *Engine) {
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules := make(map[string]*rule, len(e.rules))
+	for _, r := range e.rules {
+		rules[r.Name] = r
+	}
+
+	for key, state := range previous.states {
+		r, ok := rules[key.rule.Name]
+		if !ok || r.Station != key.rule.Station || r.Condition != key.rule.Condition {
+			continue
+		}
+
+		e.states[stateKey{rule: r, stationID: key.stationID}] = state
+	}
+	for stationID, lastSeen := range previous.lastSeen {
+		e.lastSeen[stationID] = lastSeen
+	}
+
+	previous.states = make(map[stateKey]*ruleState)
+	previous.lastSeen = make(map[string]time.Time)
+	previous.replacement = e
+}
+
+// state returns the state of the rule for the station. The lock must be held.
+func (e *Engine) state(r *rule, stationID string) *ruleState {
+	key := stateKey{rule: r, stationID: stationID}
+
+	state, ok := e.states[key]
+	if !ok {
+		state = &ruleState{}
+		e.states[key] = state
+	}
+
+	return state
+}
+
+// checkUploads fires the no-upload rules of stations that have not uploaded for the duration of the rule.
+func (e *Engine) checkUploads(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, r := range e.rules {
+		if !r.noUpload {
+			continue
+		}
+
+		for stationID, lastSeen := range e.lastSeen {
+			if !r.appliesTo(stationID) || now.Sub(lastSeen) < r.For {
+				continue
+			}
+
+			state := e.state(r, stationID)
+			if state.firing {
+				continue
+			}
+
+			if state.fire(r, now) {
+				e.send(r, Alert{
+					Rule:      r.Name,
+					StationID: stationID,
+					State:     StateFiring,
+					Condition: r.Condition,
+					Time:      now,
+					Message:   fmt.Sprintf("%s: no upload from station %s for %s", r.Name, stationID, r.For),
+				})
+			}
+		}
+	}
+}
+
+// send delivers the alert to the sinks of the rule in the background. The lock must be held.
+func (e *Engine) send(r *rule, alert Alert) {
+	if e.closed {
+		return
+	}
+
+	e.logger.Info("Alert", zap.String("alert.rule", alert.Rule), zap.String("alert.state", string(alert.State)), zap.String("ws_upload.station_id", alert.StationID), zap.String("alert.message", alert.Message))
+
+	for _, i := range e.ruleSinks[r] {
+		e.pending.Add(1)
+		go func(sink Sink, name string) {
+			defer e.pending.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+			defer cancel()
+
+			if err := sink.Send(ctx, alert); err != nil {
+				e.logger.Error("Failed to deliver alert", zap.String("alert.rule", alert.Rule), zap.String("alert.sink", name), zap.Error(err))
+			}
+		}(e.sinks[i], e.sinkNames[i])
+	}
+}
+
+func (e *Engine) run() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			return
+		case now := <-ticker.C:
+			e.checkUploads(now)
+		}
+	}
+}
+
+// Close waits for pending alerts to be delivered and closes the sinks. It can be called multiple times.
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	// Alerts are only sent with the lock held, so none are added to pending after this
+	e.closed = true
+	e.mu.Unlock()
+
+	close(e.done)
+	<-e.stopped
+
+	e.pending.Wait()
+
+	var errs []error
+	for i, sink := range e.sinks {
+		if err := sink.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close sink %s: %w", e.sinkNames[i], err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,271 @@
+package alert
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	alerts []Alert
+}
+
+func (s *recordingSink) Send(ctx context.Context, alert Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alerts = append(s.alerts, alert)
+
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	return nil
+}
+
+// sent returns the alerts sorted by time, since they are delivered in the background.
+func (s *recordingSink) sent() []Alert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	alerts := append([]Alert(nil), s.alerts...)
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].Time.Before(alerts[j].Time)
+	})
+
+	return alerts
+}
+
+// newTestEngine creates an engine for the station with the rule, which delivers the alerts to the returned sink.
+func newTestEngine(t *testing.T, rule RuleOptions) (*Engine, *recordingSink) {
+	t.Helper()
+
+	e, err := NewEngine(nil, Options{
+		Rules: []RuleOptions{rule},
+		Sinks: []SinkOptions{{Webhook: &WebhookOptions{URL: "http://localhost"}}},
+	}, []string{"station"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sink := &recordingSink{}
+	e.sinks[0] = sink
+
+	return e, sink
+}
+
+func temperatureObservation(t time.Time, temperature float64) *wsupload.Observation {
+	return &wsupload.Observation{
+		StationID:                 "station",
+		ObservationTime:           t,
+		OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: temperature},
+	}
+}
+
+func TestEngineObserve(t *testing.T) {
+	e, sink := newTestEngine(t, RuleOptions{
+		Name:       "frost",
+		Condition:  "outside_temperature_celsius < 0",
+		For:        15 * time.Minute,
+		Hysteresis: 1,
+		Cooldown:   time.Hour,
+	})
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	observations := []struct {
+		at          time.Duration
+		temperature float64
+	}{
+		{0, -1},
+		{10 * time.Minute, -2},
+		// Fires after the condition has been met for 15 minutes
+		{15 * time.Minute, -1},
+		// Within the hysteresis, so still firing
+		{20 * time.Minute, 0.5},
+		{25 * time.Minute, 1.5},
+		// Fires again within the cooldown, so neither the firing nor its resolution is delivered
+		{30 * time.Minute, -1},
+		{45 * time.Minute, -1},
+		{50 * time.Minute, 2},
+		{2 * time.Hour, -1},
+		{2*time.Hour + 15*time.Minute, -1},
+	}
+
+	for _, o := range observations {
+		e.Observe(temperatureObservation(t0.Add(o.at), o.temperature), t0.Add(o.at))
+	}
+
+	// An observation without the field keeps the rule firing
+	e.Observe(&wsupload.Observation{StationID: "station", ObservationTime: t0.Add(3 * time.Hour)}, t0.Add(3*time.Hour))
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		state State
+		at    time.Duration
+	}{
+		{StateFiring, 15 * time.Minute},
+		{StateResolved, 25 * time.Minute},
+		{StateFiring, 2*time.Hour + 15*time.Minute},
+	}
+
+	alerts := sink.sent()
+	if len(alerts) != len(want) {
+		t.Fatalf("sent %d alerts, want %d: %+v", len(alerts), len(want), alerts)
+	}
+	for i, alert := range alerts {
+		if alert.State != want[i].state || !alert.Time.Equal(t0.Add(want[i].at)) {
+			t.Errorf("alert %d is %s at %s, want %s at %s", i, alert.State, alert.Time, want[i].state, t0.Add(want[i].at))
+		}
+		if alert.Rule != "frost" || alert.StationID != "station" || alert.Value == nil {
+			t.Errorf("alert %d = %+v", i, alert)
+		}
+	}
+}
+
+func TestEngineNoUpload(t *testing.T) {
+	e, sink := newTestEngine(t, RuleOptions{
+		Name:      "silent",
+		Condition: NoUpload,
+		For:       10 * time.Minute,
+	})
+
+	now := time.Now()
+
+	e.checkUploads(now.Add(5 * time.Minute))
+	e.checkUploads(now.Add(11 * time.Minute))
+	// Already firing, so not sent again
+	e.checkUploads(now.Add(12 * time.Minute))
+	e.Observe(temperatureObservation(now.Add(13*time.Minute), 10), now.Add(13*time.Minute))
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts := sink.sent()
+	if len(alerts) != 2 || alerts[0].State != StateFiring || alerts[1].State != StateResolved {
+		t.Fatalf("sent %+v, want a firing and a resolved alert", alerts)
+	}
+}
+
+func TestEngineNoUploadSeen(t *testing.T) {
+	e, sink := newTestEngine(t, RuleOptions{
+		Name:      "silent",
+		Condition: NoUpload,
+		For:       10 * time.Minute,
+	})
+
+	now := time.Now()
+
+	// Uploads whose observation is discarded are only seen, which keeps the rule from firing
+	e.Seen("station", now.Add(5*time.Minute))
+	e.checkUploads(now.Add(11 * time.Minute))
+	e.checkUploads(now.Add(16 * time.Minute))
+	e.Seen("station", now.Add(17*time.Minute))
+	// A replayed upload received earlier does not move the time the station was last seen back
+	e.Seen("station", now)
+	e.checkUploads(now.Add(26 * time.Minute))
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts := sink.sent()
+	if len(alerts) != 2 || alerts[0].State != StateFiring || alerts[1].State != StateResolved {
+		t.Fatalf("sent %+v, want a firing and a resolved alert", alerts)
+	}
+	if !alerts[0].Time.Equal(now.Add(16*time.Minute)) || !alerts[1].Time.Equal(now.Add(17*time.Minute)) {
+		t.Errorf("sent alerts at %s and %s, want %s and %s", alerts[0].Time, alerts[1].Time, now.Add(16*time.Minute), now.Add(17*time.Minute))
+	}
+}
+
+func TestEngineClosed(t *testing.T) {
+	e, sink := newTestEngine(t, RuleOptions{
+		Name:      "frost",
+		Condition: "outside_temperature_celsius < 0",
+	})
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	e.Observe(temperatureObservation(now, -5), now)
+
+	if alerts := sink.sent(); len(alerts) != 0 {
+		t.Errorf("sent %+v after Close()", alerts)
+	}
+}
+
+func TestEngineTakeState(t *testing.T) {
+	frost := RuleOptions{
+		Name:      "frost",
+		Condition: "outside_temperature_celsius < 0",
+		Cooldown:  time.Hour,
+	}
+
+	previous, previousSink := newTestEngine(t, frost)
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	previous.Observe(temperatureObservation(t0, -1), t0)
+
+	e, sink := newTestEngine(t, frost)
+	e.TakeState(previous)
+
+	// Observations of the previous engine are evaluated by the new engine, which knows the rule is firing
+	previous.Observe(temperatureObservation(t0.Add(time.Minute), -2), t0.Add(time.Minute))
+	e.Observe(temperatureObservation(t0.Add(2*time.Minute), 1), t0.Add(2*time.Minute))
+
+	if err := previous.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if alerts := previousSink.sent(); len(alerts) != 1 || alerts[0].State != StateFiring {
+		t.Errorf("previous engine sent %+v, want a firing alert", alerts)
+	}
+	if alerts := sink.sent(); len(alerts) != 1 || alerts[0].State != StateResolved {
+		t.Errorf("new engine sent %+v, want a resolved alert", alerts)
+	}
+}
+
+func TestEngineTakeStateChangedRule(t *testing.T) {
+	previous, _ := newTestEngine(t, RuleOptions{
+		Name:      "frost",
+		Condition: "outside_temperature_celsius < 0",
+	})
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	previous.Observe(temperatureObservation(t0, -1), t0)
+
+	e, sink := newTestEngine(t, RuleOptions{
+		Name:      "frost",
+		Condition: "outside_temperature_celsius < -5",
+	})
+	e.TakeState(previous)
+
+	// The condition changed, so the state is not kept and the rule fires again
+	e.Observe(temperatureObservation(t0.Add(time.Minute), -6), t0.Add(time.Minute))
+
+	previous.Close()
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if alerts := sink.sent(); len(alerts) != 1 || alerts[0].State != StateFiring {
+		t.Errorf("sent %+v, want a firing alert", alerts)
+	}
+}
@@ -0,0 +1,105 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	mqttclient "github.com/eclipse/paho.mqtt.golang"
+	"github.com/koesie10/ws-upload/mqtt"
+)
+
+type MQTTOptions struct {
+	Brokers []string `flag:"brokers"`
+	// ClientID is the prefix of the client ID, a random suffix is added so every sink has a unique client ID
+	ClientID string `flag:"client-id"`
+	Username string `flag:"username"`
+	Password string `flag:"password"`
+	// Topic receives the alerts as JSON
+	Topic    string `flag:"topic"`
+	QoS      byte   `flag:"qos"`
+	Retained bool   `flag:"retained"`
+}
+
+type mqttSink struct {
+	client  mqttclient.Client
+	options MQTTOptions
+
+	connect sync.Once
+}
+
+func newMQTTSink(options MQTTOptions) (Sink, error) {
+	if len(options.Brokers) == 0 {
+		return nil, errors.New("mqtt brokers are required")
+	}
+	if options.Topic == "" {
+		return nil, errors.New("mqtt topic is required")
+	}
+	if options.QoS > 2 {
+		return nil, errors.New("mqtt qos must be 0, 1 or 2")
+	}
+
+	clientIDPrefix := options.ClientID
+	if clientIDPrefix == "" {
+		hostname, _ := os.Hostname()
+		clientIDPrefix = hostname + "-alert"
+	}
+
+	// The sink of the previous config is only closed after the new one is created, so they must not share a client ID
+	connOpts := mqttclient.NewClientOptions().SetClientID(mqtt.UniqueClientID(clientIDPrefix)).SetCleanSession(true)
+	for _, broker := range options.Brokers {
+		connOpts.AddBroker(broker)
+	}
+	if options.Username != "" {
+		connOpts.SetUsername(options.Username)
+		if options.Password != "" {
+			connOpts.SetPassword(options.Password)
+		}
+	}
+	connOpts.SetAutoReconnect(true)
+	connOpts.SetConnectRetry(true)
+
+	s := &mqttSink{
+		client:  mqttclient.NewClient(connOpts),
+		options: options,
+	}
+
+	return s, nil
+}
+
+func (s *mqttSink) Send(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	// The client only connects once an alert is sent, so validating a configuration does not connect. The connection
+	// is retried in the background, so this does not block.
+	s.connect.Do(func() {
+		s.client.Connect()
+	})
+
+	token := s.client.Publish(s.options.Topic, s.options.QoS, s.options.Retained, body)
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("failed to publish alert: %w", ctx.Err())
+	case <-token.Done():
+		if err := token.Error(); err != nil {
+			return fmt.Errorf("failed to publish alert: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *mqttSink) Close() error {
+	if s.client.IsConnected() {
+		s.client.Disconnect(250)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+type NtfyOptions struct {
+	// URL is the URL of the topic, such as https://ntfy.sh/my-weather-alerts
+	URL string `flag:"url"`
+	// Token is sent as bearer token if set
+	Token string `flag:"token"`
+	// Priority is the priority of firing alerts, resolved alerts use the default priority
+	Priority string `flag:"priority"`
+	// Tags are added to the notifications
+	Tags []string `flag:"tags"`
+}
+
+type ntfySink struct {
+	options NtfyOptions
+}
+
+func newNtfySink(options NtfyOptions) (Sink, error) {
+	if options.URL == "" {
+		return nil, errors.New("ntfy url is required")
+	}
+
+	return &ntfySink{
+		options: options,
+	}, nil
+}
+
+func (s *ntfySink) Send(ctx context.Context, alert Alert) error {
+	headers := map[string]string{
+		"Title": title(alert),
+	}
+	if s.options.Token != "" {
+		headers["Authorization"] = "Bearer " + s.options.Token
+	}
+	if s.options.Priority != "" && alert.State == StateFiring {
+		headers["Priority"] = s.options.Priority
+	}
+	if len(s.options.Tags) > 0 {
+		headers["Tags"] = strings.Join(s.options.Tags, ",")
+	}
+
+	return post(ctx, s.options.URL, headers, []byte(alert.Message), "text/plain; charset=utf-8")
+}
+
+func (s *ntfySink) Close() error {
+	return nil
+}
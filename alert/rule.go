@@ -0,0 +1,186 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+// NoUpload is the condition of rules that fire when a station has not uploaded for the duration of the rule
+const NoUpload = "no-upload"
+
+type RuleOptions struct {
+	// Name identifies the rule in alerts
+	Name string `flag:"name"`
+	// Station is the ID of the station the rule applies to, it applies to all stations if empty
+	Station string `flag:"station"`
+	// Condition is a comparison of an observation field with a value, such as "outside_temperature_celsius < 0", or
+	// NoUpload
+	Condition string `flag:"condition"`
+	// For is how long the condition must be met before the rule fires
+	For time.Duration `flag:"for"`
+	// Hysteresis is how far the value must be past the threshold before a firing rule is resolved
+	Hysteresis float64 `flag:"hysteresis"`
+	// Cooldown is the minimum time between two alerts of the rule for a station
+	Cooldown time.Duration `flag:"cooldown"`
+	// Sinks are the names of the sinks to deliver the alerts to, defaults to all sinks
+	Sinks []string `flag:"sinks"`
+}
+
+type operator string
+
+const (
+	operatorLess           operator = "<"
+	operatorLessOrEqual    operator = "<="
+	operatorGreater        operator = ">"
+	operatorGreaterOrEqual operator = ">="
+)
+
+type rule struct {
+	RuleOptions
+
+	noUpload  bool
+	field     *wsupload.Field
+	operator  operator
+	threshold float64
+}
+
+var nullFloat64Type = reflect.TypeOf(wsupload.NullFloat64{})
+var nullInt64Type = reflect.TypeOf(wsupload.NullInt64{})
+
+func newRule(options RuleOptions) (*rule, error) {
+	if options.Name == "" {
+		return nil, fmt.Errorf("rule with condition %q has no name", options.Condition)
+	}
+	if options.For < 0 || options.Cooldown < 0 || options.Hysteresis < 0 {
+		return nil, fmt.Errorf("for, cooldown and hysteresis of rule %s must not be negative", options.Name)
+	}
+
+	r := &rule{
+		RuleOptions: options,
+	}
+
+	if strings.TrimSpace(options.Condition) == NoUpload {
+		if options.For <= 0 {
+			return nil, fmt.Errorf("rule %s requires a duration in for", options.Name)
+		}
+
+		r.noUpload = true
+
+		return r, nil
+	}
+
+	parts := strings.Fields(options.Condition)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid condition %q of rule %s, use <field> <operator> <value> or %s", options.Condition, options.Name, NoUpload)
+	}
+
+	for _, field := range wsupload.ObservationSchema.Fields {
+		if field.JSONName == parts[0] && (field.Type == nullFloat64Type || field.Type == nullInt64Type) {
+			r.field = field
+		}
+	}
+	if r.field == nil {
+		return nil, fmt.Errorf("unknown numeric field %s in condition of rule %s", parts[0], options.Name)
+	}
+
+	switch op := operator(parts[1]); op {
+	case operatorLess, operatorLessOrEqual, operatorGreater, operatorGreaterOrEqual:
+		r.operator = op
+	default:
+		return nil, fmt.Errorf("invalid operator %s in condition of rule %s, use <, <=, > or >=", parts[1], options.Name)
+	}
+
+	threshold, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %s in condition of rule %s: %w", parts[2], options.Name, err)
+	}
+	r.threshold = threshold
+
+	return r, nil
+}
+
+// appliesTo returns whether the rule applies to the station.
+func (r *rule) appliesTo(stationID string) bool {
+	return r.Station == "" || r.Station == stationID
+}
+
+// value returns the value of the field of the rule in the observation.
+func (r *rule) value(obs *wsupload.Observation) (float64, error) {
+	v := r.field.Value(obs).Interface().(wsupload.Nullable)
+	if v.IsNull() {
+		return 0, errors.New("no value")
+	}
+
+	switch value := v.Value().(type) {
+	case float64:
+		return value, nil
+	case int64:
+		return float64(value), nil
+	default:
+		return 0, fmt.Errorf("unsupported value %T", value)
+	}
+}
+
+// met returns whether the condition is met by the value.
+func (r *rule) met(v float64) bool {
+	switch r.operator {
+	case operatorLess:
+		return v < r.threshold
+	case operatorLessOrEqual:
+		return v <= r.threshold
+	case operatorGreater:
+		return v > r.threshold
+	default:
+		return v >= r.threshold
+	}
+}
+
+// resolved returns whether the value is past the threshold by at least the hysteresis.
+func (r *rule) resolved(v float64) bool {
+	switch r.operator {
+	case operatorLess, operatorLessOrEqual:
+		return v > r.threshold+r.Hysteresis || (r.Hysteresis == 0 && !r.met(v))
+	default:
+		return v < r.threshold-r.Hysteresis || (r.Hysteresis == 0 && !r.met(v))
+	}
+}
+
+// ruleState is the state of a rule for a single station.
+type ruleState struct {
+	// pendingSince is the time since the condition is met, or zero if it is not met
+	pendingSince time.Time
+	firing       bool
+	// notified is whether the current firing was delivered, it is not if it was within the cooldown
+	notified     bool
+	lastNotified time.Time
+}
+
+// fire marks the state as firing and returns whether an alert should be sent, which is not the case within the
+// cooldown of the last alert.
+func (s *ruleState) fire(r *rule, t time.Time) bool {
+	s.firing = true
+	s.notified = s.lastNotified.IsZero() || t.Sub(s.lastNotified) >= r.Cooldown
+	if s.notified {
+		s.lastNotified = t
+	}
+
+	return s.notified
+}
+
+// resolve marks the state as resolved and returns whether an alert should be sent, which is only the case if the
+// firing was delivered.
+func (s *ruleState) resolve() bool {
+	notify := s.firing && s.notified
+
+	s.firing = false
+	s.notified = false
+	s.pendingSince = time.Time{}
+
+	return notify
+}
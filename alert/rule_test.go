@@ -0,0 +1,107 @@
+package alert
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		options RuleOptions
+		wantErr bool
+	}{
+		{name: "comparison", options: RuleOptions{Name: "frost", Condition: "outside_temperature_celsius < 0"}},
+		{name: "integer field", options: RuleOptions{Name: "humid", Condition: "outside_relative_humidity >= 90"}},
+		{name: "no upload", options: RuleOptions{Name: "silent", Condition: "no-upload", For: 10 * time.Minute}},
+		{name: "no name", options: RuleOptions{Condition: "outside_temperature_celsius < 0"}, wantErr: true},
+		{name: "no upload without for", options: RuleOptions{Name: "silent", Condition: "no-upload"}, wantErr: true},
+		{name: "negative cooldown", options: RuleOptions{Name: "frost", Condition: "outside_temperature_celsius < 0", Cooldown: -time.Minute}, wantErr: true},
+		{name: "missing value", options: RuleOptions{Name: "frost", Condition: "outside_temperature_celsius <"}, wantErr: true},
+		{name: "unknown field", options: RuleOptions{Name: "frost", Condition: "temperature < 0"}, wantErr: true},
+		{name: "non-numeric field", options: RuleOptions{Name: "station", Condition: "station_id < 0"}, wantErr: true},
+		{name: "invalid operator", options: RuleOptions{Name: "frost", Condition: "outside_temperature_celsius == 0"}, wantErr: true},
+		{name: "invalid value", options: RuleOptions{Name: "frost", Condition: "outside_temperature_celsius < zero"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newRule(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleMetResolved(t *testing.T) {
+	tests := []struct {
+		condition    string
+		hysteresis   float64
+		value        float64
+		wantMet      bool
+		wantResolved bool
+	}{
+		{condition: "outside_temperature_celsius < 0", value: -1, wantMet: true},
+		{condition: "outside_temperature_celsius < 0", value: 0, wantResolved: true},
+		{condition: "outside_temperature_celsius <= 0", value: 0, wantMet: true},
+		{condition: "outside_temperature_celsius <= 0", value: 0.1, wantResolved: true},
+		{condition: "wind_gust_meters_per_second > 20", value: 20, wantResolved: true},
+		{condition: "wind_gust_meters_per_second > 20", value: 20.5, wantMet: true},
+		{condition: "wind_gust_meters_per_second >= 20", value: 20, wantMet: true},
+		{condition: "outside_temperature_celsius < 0", hysteresis: 1, value: 0.5},
+		{condition: "outside_temperature_celsius < 0", hysteresis: 1, value: 1.5, wantResolved: true},
+		{condition: "wind_gust_meters_per_second > 20", hysteresis: 5, value: 16},
+		{condition: "wind_gust_meters_per_second > 20", hysteresis: 5, value: 14, wantResolved: true},
+	}
+
+	for _, tt := range tests {
+		r, err := newRule(RuleOptions{Name: "rule", Condition: tt.condition, Hysteresis: tt.hysteresis})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := r.met(tt.value); got != tt.wantMet {
+			t.Errorf("%s: met(%v) = %v, want %v", tt.condition, tt.value, got, tt.wantMet)
+		}
+		if got := r.resolved(tt.value); got != tt.wantResolved {
+			t.Errorf("%s with hysteresis %v: resolved(%v) = %v, want %v", tt.condition, tt.hysteresis, tt.value, got, tt.wantResolved)
+		}
+	}
+}
+
+func TestRuleStateCooldown(t *testing.T) {
+	r := &rule{RuleOptions: RuleOptions{Cooldown: time.Hour}}
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		fire bool
+		at   time.Duration
+		want bool
+	}{
+		// The first firing is always delivered
+		{fire: true, at: 0, want: true},
+		{fire: false, want: true},
+		// Firing again within the cooldown is not delivered, and neither is its resolution
+		{fire: true, at: 30 * time.Minute, want: false},
+		{fire: false, want: false},
+		{fire: true, at: time.Hour, want: true},
+		{fire: false, want: true},
+		// Resolving a state that is not firing is not delivered
+		{fire: false, want: false},
+	}
+
+	var state ruleState
+	for i, step := range steps {
+		var got bool
+		if step.fire {
+			got = state.fire(r, t0.Add(step.at))
+		} else {
+			got = state.resolve()
+		}
+
+		if got != step.want {
+			t.Errorf("step %d: got %v, want %v", i, got, step.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+type SinkOptions struct {
+	// Name identifies the sink in rules, defaults to its type
+	Name string `flag:"name"`
+
+	// Exactly one of the sink types must be set
+	Webhook *WebhookOptions `flag:"webhook"`
+	MQTT    *MQTTOptions    `flag:"mqtt"`
+	SMTP    *SMTPOptions    `flag:"smtp"`
+	Ntfy    *NtfyOptions    `flag:"ntfy"`
+}
+
+// Sink delivers alerts.
+type Sink interface {
+	Send(ctx context.Context, alert Alert) error
+	Close() error
+}
+
+func newSink(options SinkOptions) (Sink, string, error) {
+	var sinks []Sink
+	var types []string
+
+	if options.Webhook != nil {
+		sink, err := newWebhookSink(*options.Webhook)
+		if err != nil {
+			return nil, "", err
+		}
+		sinks = append(sinks, sink)
+		types = append(types, "webhook")
+	}
+	if options.MQTT != nil {
+		sink, err := newMQTTSink(*options.MQTT)
+		if err != nil {
+			return nil, "", err
+		}
+		sinks = append(sinks, sink)
+		types = append(types, "mqtt")
+	}
+	if options.SMTP != nil {
+		sink, err := newSMTPSink(*options.SMTP)
+		if err != nil {
+			return nil, "", err
+		}
+		sinks = append(sinks, sink)
+		types = append(types, "smtp")
+	}
+	if options.Ntfy != nil {
+		sink, err := newNtfySink(*options.Ntfy)
+		if err != nil {
+			return nil, "", err
+		}
+		sinks = append(sinks, sink)
+		types = append(types, "ntfy")
+	}
+
+	if len(sinks) != 1 {
+		for _, sink := range sinks {
+			sink.Close()
+		}
+		return nil, "", errors.New("exactly one of webhook, mqtt, smtp or ntfy must be set")
+	}
+
+	name := options.Name
+	if name == "" {
+		name = types[0]
+	}
+
+	return sinks[0], name, nil
+}
+
+var httpClient = &http.Client{
+	Timeout: sendTimeout,
+}
+
+// post sends a POST request and returns an error if the response status is not successful.
+func post(ctx context.Context, url string, headers map[string]string, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// title returns a short title of the alert.
+func title(alert Alert) string {
+	if alert.State == StateResolved {
+		return fmt.Sprintf("Resolved: %s at %s", alert.Rule, alert.StationID)
+	}
+
+	return fmt.Sprintf("Alert: %s at %s", alert.Rule, alert.StationID)
+}
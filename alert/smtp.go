@@ -0,0 +1,117 @@
+package alert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTPOptions struct {
+	// Address is the host and port of the SMTP server, such as smtp.example.com:587
+	Address string `flag:"address"`
+	// Username and Password are used for PLAIN authentication if the username is set
+	Username string   `flag:"username"`
+	Password string   `flag:"password"`
+	From     string   `flag:"from"`
+	To       []string `flag:"to"`
+	// InsecureSkipVerify disables verification of the certificate of the server when using STARTTLS
+	InsecureSkipVerify bool `flag:"insecure-skip-verify"`
+}
+
+type smtpSink struct {
+	options SMTPOptions
+	host    string
+}
+
+func newSMTPSink(options SMTPOptions) (Sink, error) {
+	if options.Address == "" {
+		return nil, errors.New("smtp address is required")
+	}
+	host, _, err := net.SplitHostPort(options.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp address: %w", err)
+	}
+	if options.From == "" || len(options.To) == 0 {
+		return nil, errors.New("smtp from and to are required")
+	}
+
+	return &smtpSink{
+		options: options,
+		host:    host,
+	}, nil
+}
+
+func (s *smtpSink) Send(ctx context.Context, alert Alert) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.options.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host, InsecureSkipVerify: s.options.InsecureSkipVerify}); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	if s.options.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.options.Username, s.options.Password, s.host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.options.From); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	for _, to := range s.options.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("failed to add recipient %s: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if _, err := w.Write(s.message(alert)); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+func (s *smtpSink) message(alert Alert) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + s.options.From + "\r\n")
+	b.WriteString("To: " + strings.Join(s.options.To, ", ") + "\r\n")
+	b.WriteString("Subject: " + title(alert) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(alert.Message + "\r\n")
+
+	return []byte(b.String())
+}
+
+func (s *smtpSink) Close() error {
+	return nil
+}
@@ -0,0 +1,152 @@
+package alert
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpStandIn is a minimal SMTP server that accepts a single message.
+type smtpStandIn struct {
+	listener net.Listener
+	messages chan string
+}
+
+func newSMTPStandIn(t *testing.T) *smtpStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	s := &smtpStandIn{
+		listener: listener,
+		messages: make(chan string, 1),
+	}
+
+	go s.serve()
+
+	return s
+}
+
+func (s *smtpStandIn) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost ESMTP")
+
+	var envelope, data strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"), strings.HasPrefix(command, "RCPT TO:"):
+			envelope.WriteString(strings.TrimSpace(line) + "\n")
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(line)
+			}
+			s.messages <- envelope.String() + data.String()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+func TestSMTPSink(t *testing.T) {
+	server := newSMTPStandIn(t)
+
+	sink, err := newSMTPSink(SMTPOptions{
+		Address: server.listener.Addr().String(),
+		From:    "ws-upload@example.com",
+		To:      []string{"alice@example.com", "bob@example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = sink.Send(ctx, Alert{
+		Rule:      "frost",
+		StationID: "station",
+		State:     StateFiring,
+		Time:      time.Now(),
+		Message:   "frost: outside_temperature_celsius < 0 at station station (value -1)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := <-server.messages
+
+	for _, want := range []string{
+		"MAIL FROM:<ws-upload@example.com>",
+		"RCPT TO:<alice@example.com>",
+		"RCPT TO:<bob@example.com>",
+		"Subject: Alert: frost at station\r\n",
+		"\r\n\r\nfrost: outside_temperature_celsius < 0 at station station (value -1)\r\n",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message does not contain %q:\n%s", want, message)
+		}
+	}
+}
+
+func TestNewSMTPSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		options SMTPOptions
+		wantErr bool
+	}{
+		{name: "valid", options: SMTPOptions{Address: "localhost:25", From: "a@example.com", To: []string{"b@example.com"}}},
+		{name: "no address", options: SMTPOptions{From: "a@example.com", To: []string{"b@example.com"}}, wantErr: true},
+		{name: "no port", options: SMTPOptions{Address: "localhost", From: "a@example.com", To: []string{"b@example.com"}}, wantErr: true},
+		{name: "no recipients", options: SMTPOptions{Address: "localhost:25", From: "a@example.com"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSMTPSink(tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newSMTPSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type WebhookOptions struct {
+	// URL receives the alerts as JSON in a POST request
+	URL string `flag:"url"`
+	// Headers are added to the requests, such as an Authorization header
+	Headers map[string]string `flag:"headers"`
+}
+
+type webhookSink struct {
+	options WebhookOptions
+}
+
+func newWebhookSink(options WebhookOptions) (Sink, error) {
+	if options.URL == "" {
+		return nil, errors.New("webhook url is required")
+	}
+
+	return &webhookSink{
+		options: options,
+	}, nil
+}
+
+func (s *webhookSink) Send(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	return post(ctx, s.options.URL, s.options.Headers, body, "application/json")
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
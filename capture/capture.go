@@ -0,0 +1,154 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/koesie10/ws-upload/password"
+)
+
+// Record is a raw request as received from a station
+type Record struct {
+	Time    time.Time   `json:"time"`
+	Method  string      `json:"method"`
+	Path    string      `json:"path"`
+	Query   string      `json:"query"`
+	Body    string      `json:"body,omitempty"`
+	Headers http.Header `json:"headers,omitempty"`
+}
+
+// sensitiveHeaders are the headers containing credentials, which are not captured
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// NewRecord creates a record of the request. Station passwords are redacted from the query and form-encoded bodies,
+// and headers containing credentials are dropped.
+func NewRecord(t time.Time, r *http.Request, body []byte) Record {
+	record := Record{
+		Time:    t,
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Query:   password.RedactQuery(r.URL.RawQuery),
+		Body:    string(body),
+		Headers: r.Header.Clone(),
+	}
+
+	for _, header := range sensitiveHeaders {
+		record.Headers.Del(header)
+	}
+
+	if isForm(record.Headers) {
+		record.Body = password.RedactQuery(record.Body)
+	}
+
+	return record
+}
+
+func isForm(headers http.Header) bool {
+	return strings.HasPrefix(headers.Get("Content-Type"), "application/x-www-form-urlencoded")
+}
+
+// Params returns the query parameters of the record, merged with the body if it is form-encoded.
+func (r *Record) Params() (url.Values, error) {
+	params, err := url.ParseQuery(r.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %w", err)
+	}
+
+	if r.Body != "" && isForm(r.Headers) {
+		form, err := url.ParseQuery(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse body: %w", err)
+		}
+
+		for k, v := range form {
+			params[k] = append(params[k], v...)
+		}
+	}
+
+	return params, nil
+}
+
+// Writer appends records to a file as newline-delimited JSON
+type Writer struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func NewWriter(path string) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+
+	return &Writer{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+func (w *Writer) Write(record Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.encoder.Encode(record); err != nil {
+		return fmt.Errorf("failed to write capture record: %w", err)
+	}
+
+	return nil
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
+
+// Reader reads records written by a Writer
+type Reader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	return &Reader{
+		scanner: scanner,
+	}
+}
+
+// Next returns the next record, or io.EOF if there are no more records.
+func (r *Reader) Next() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := r.scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse capture record on line %d: %w", r.line, err)
+		}
+
+		return &record, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
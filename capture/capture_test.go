@@ -0,0 +1,70 @@
+package capture
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewRecord(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		contentType string
+		wantQuery   string
+		wantBody    string
+	}{
+		{
+			name:      "query",
+			target:    "/weatherstation/updateweatherstation.php?ID=station&PASSWORD=secret&tempf=50",
+			wantQuery: "ID=station&PASSWORD=REDACTED&tempf=50",
+		},
+		{
+			name:        "form body",
+			target:      "/api/v1/observe",
+			body:        "PASSKEY=secret&tempf=50",
+			contentType: "application/x-www-form-urlencoded",
+			wantBody:    "PASSKEY=REDACTED&tempf=50",
+		},
+		{
+			name:        "other body",
+			target:      "/api/v1/observe",
+			body:        `{"PASSWORD":"secret"}`,
+			contentType: "application/json",
+			wantBody:    `{"PASSWORD":"secret"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer token")
+			req.Header.Set("Proxy-Authorization", "Basic credentials")
+			req.Header.Set("Cookie", "session=secret")
+			req.Header.Set("User-Agent", "console")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			record := NewRecord(time.Now(), req, []byte(tt.body))
+
+			if record.Query != tt.wantQuery {
+				t.Errorf("Query = %q, want %q", record.Query, tt.wantQuery)
+			}
+			if record.Body != tt.wantBody {
+				t.Errorf("Body = %q, want %q", record.Body, tt.wantBody)
+			}
+			for _, header := range []string{"Authorization", "Proxy-Authorization", "Cookie"} {
+				if v := record.Headers.Get(header); v != "" {
+					t.Errorf("header %s = %q, want it to be dropped", header, v)
+				}
+			}
+			if record.Headers.Get("User-Agent") != "console" {
+				t.Errorf("User-Agent header = %q, want console", record.Headers.Get("User-Agent"))
+			}
+		})
+	}
+}
@@ -0,0 +1,462 @@
+package climate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+)
+
+type Options struct {
+	Enabled   bool   `env:"CLIMATE_ENABLED" flag:"enabled" desc:"whether to track daily and monthly climate records of the stations"`
+	StateFile string `env:"CLIMATE_STATE_FILE" flag:"state-file" desc:"file to persist the climate records in, they are lost on restart if empty"`
+
+	HeatingBaseCelsius float64 `env:"CLIMATE_HEATING_BASE_CELSIUS" flag:"heating-base-celsius" desc:"base temperature of heating degree days"`
+	CoolingBaseCelsius float64 `env:"CLIMATE_COOLING_BASE_CELSIUS" flag:"cooling-base-celsius" desc:"base temperature of cooling degree days"`
+	GrowingBaseCelsius float64 `env:"CLIMATE_GROWING_BASE_CELSIUS" flag:"growing-base-celsius" desc:"base temperature of growing degree days"`
+
+	RainDayThresholdMillimeters float64 `env:"CLIMATE_RAIN_DAY_THRESHOLD_MILLIMETERS" flag:"rain-day-threshold-millimeters" desc:"minimum daily rain of a rain day"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		HeatingBaseCelsius:          18,
+		CoolingBaseCelsius:          18,
+		GrowingBaseCelsius:          10,
+		RainDayThresholdMillimeters: 0.2,
+	}
+}
+
+// Extreme is a high or low and the time it occurred.
+type Extreme struct {
+	Value float64   `json:"value"`
+	Time  time.Time `json:"time"`
+}
+
+// Period contains the highs and lows of the tracked fields by JSON name and the totals of a day or month. Degree days
+// are calculated from the mean of the daily high and low outside temperature.
+type Period struct {
+	Start time.Time          `json:"start"`
+	Highs map[string]Extreme `json:"highs"`
+	Lows  map[string]Extreme `json:"lows"`
+
+	HeatingDegreeDays float64 `json:"heating_degree_days"`
+	CoolingDegreeDays float64 `json:"cooling_degree_days"`
+	GrowingDegreeDays float64 `json:"growing_degree_days"`
+	RainMillimeters   float64 `json:"rain_millimeters"`
+	RainDays          int     `json:"rain_days"`
+}
+
+// Records contains the all-time highs and lows of the tracked fields by JSON name.
+type Records struct {
+	Since time.Time          `json:"since"`
+	Highs map[string]Extreme `json:"highs"`
+	Lows  map[string]Extreme `json:"lows"`
+}
+
+type Station struct {
+	StationID string `json:"station_id"`
+
+	Today         Period  `json:"today"`
+	Yesterday     *Period `json:"yesterday,omitempty"`
+	Month         Period  `json:"month"`
+	PreviousMonth *Period `json:"previous_month,omitempty"`
+
+	Records Records `json:"records"`
+}
+
+// trackedFields are the fields of which highs and lows are tracked, by JSON name. The lows of fields that are often
+// zero are not tracked.
+var trackedFields = []struct {
+	jsonName string
+	lows     bool
+}{
+	{"outside_temperature_celsius", true},
+	{"indoor_temperature_celsius", true},
+	{"dewpoint_celsius", true},
+	{"outside_relative_humidity", true},
+	{"relative_atmospheric_pressure_pascal", true},
+	{"wind_speed_meters_per_second", false},
+	{"wind_gust_meters_per_second", false},
+	{"uv_index", false},
+	{"solar_radiation_watt_per_meter_squared", false},
+	{"daily_rain_millimeters", false},
+}
+
+const (
+	temperatureField = "outside_temperature_celsius"
+	dailyRainField   = "daily_rain_millimeters"
+)
+
+// saveInterval is how often the records are written to the state file if they changed
+const saveInterval = time.Minute
+
+// schemaFields contains the observation schema fields of the tracked fields, by JSON name. It panics if a tracked
+// field is not a float field of the observation schema.
+var schemaFields = func() map[string]*wsupload.Field {
+	fields := make(map[string]*wsupload.Field)
+	for _, field := range wsupload.ObservationSchema.Fields {
+		fields[field.JSONName] = field
+	}
+
+	tracked := make(map[string]*wsupload.Field, len(trackedFields))
+	for _, trackedField := range trackedFields {
+		field, ok := fields[trackedField.jsonName]
+		if !ok || field.Type != reflect.TypeOf(wsupload.NullFloat64{}) {
+			panic(fmt.Sprintf("climate: tracked field %s is not a float field of the observation schema", trackedField.jsonName))
+		}
+
+		tracked[trackedField.jsonName] = field
+	}
+
+	return tracked
+}()
+
+// Tracker tracks the climate records of all stations. It is safe for concurrent use.
+type Tracker struct {
+	logger  *zap.Logger
+	options Options
+
+	mu       sync.Mutex
+	stations map[string]*Station
+	// dirty is true if the records changed since they were last saved
+	dirty  bool
+	closed bool
+	// replacement is the tracker that took over the records of this tracker, updates are applied to it
+	replacement *Tracker
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewTracker creates a tracker, reading the records from the state file if it exists. The records are saved
+// periodically and when the tracker is closed.
+func NewTracker(logger *zap.Logger, options Options) (*Tracker, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	if options.RainDayThresholdMillimeters < 0 {
+		return nil, errors.New("rain day threshold must not be negative")
+	}
+
+	t := &Tracker{
+		logger:   logger,
+		options:  options,
+		stations: make(map[string]*Station),
+
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if options.StateFile == "" {
+		logger.Warn("Climate records are not persisted since no state file is set")
+		close(t.stopped)
+		return t, nil
+	}
+
+	data, err := os.ReadFile(options.StateFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read climate state file: %w", err)
+	}
+
+	if err == nil {
+		var state stateFile
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("invalid climate state file %s: %w", options.StateFile, err)
+		}
+		if state.Stations != nil {
+			t.stations = state.Stations
+		}
+	}
+
+	go t.run()
+
+	return t, nil
+}
+
+type stateFile struct {
+	// Stations contains the records of all stations. The totals of the month only include the completed days.
+	Stations map[string]*Station `json:"stations"`
+}
+
+// Update adds the observation to the records of its station. Days and months are in the location. It returns the
+// updated records, or nil if the observation is of an earlier day than the last observation of the station or if the
+// tracker is closed.
+func (t *Tracker) Update(obs *wsupload.Observation, location *time.Location) *Station {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.replacement != nil {
+		// Locks are always taken from the previous to the replacement tracker, as in TakeState
+		return t.replacement.Update(obs, location)
+	}
+	if t.closed {
+		return nil
+	}
+
+	local := obs.ObservationTime.In(location)
+	year, month, day := local.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, location)
+
+	s, ok := t.stations[obs.StationID]
+	if !ok {
+		s = &Station{
+			StationID: obs.StationID,
+			Today:     newPeriod(today),
+			Month:     newPeriod(time.Date(year, month, 1, 0, 0, 0, 0, location)),
+			Records: Records{
+				Since: obs.ObservationTime,
+				Highs: make(map[string]Extreme),
+				Lows:  make(map[string]Extreme),
+			},
+		}
+		t.stations[obs.StationID] = s
+	}
+
+	if today.Before(s.Today.Start) {
+		return nil
+	}
+
+	if today.After(s.Today.Start) {
+		addTotals(&s.Month, s.Today)
+
+		yesterday := s.Today
+		s.Yesterday = &yesterday
+		s.Today = newPeriod(today)
+
+		if !s.Month.Start.Equal(time.Date(year, month, 1, 0, 0, 0, 0, location)) {
+			previousMonth := s.Month
+			s.PreviousMonth = &previousMonth
+			s.Month = newPeriod(time.Date(year, month, 1, 0, 0, 0, 0, location))
+		}
+	}
+
+	for _, tracked := range trackedFields {
+		v := schemaFields[tracked.jsonName].Value(obs).Interface().(wsupload.NullFloat64)
+		if !v.Valid {
+			continue
+		}
+		value := v.Float64
+
+		extreme := Extreme{Value: value, Time: obs.ObservationTime}
+
+		for _, highs := range []map[string]Extreme{s.Today.Highs, s.Month.Highs, s.Records.Highs} {
+			if current, ok := highs[tracked.jsonName]; !ok || value > current.Value {
+				highs[tracked.jsonName] = extreme
+			}
+		}
+		if tracked.lows {
+			for _, lows := range []map[string]Extreme{s.Today.Lows, s.Month.Lows, s.Records.Lows} {
+				if current, ok := lows[tracked.jsonName]; !ok || value < current.Value {
+					lows[tracked.jsonName] = extreme
+				}
+			}
+		}
+	}
+
+	t.updateTotals(&s.Today)
+	t.dirty = true
+
+	return s.withToday()
+}
+
+// TakeState moves the records of the previous tracker to this tracker if both use the same state file, so the records
+// are kept when the configuration is reloaded and only this tracker writes the state file. Updates of the previous
+// tracker are applied to this tracker afterwards.
+func (t *Tracker) TakeState(previous *Tracker) {
+	if previous.options.StateFile != t.options.StateFile {
+		return
+	}
+
+	previous.mu.Lock()
+	defer previous.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// The records of the previous tracker are newer than the state file if they have not been saved yet
+	t.stations = previous.stations
+	t.dirty = previous.dirty
+
+	previous.stations = make(map[string]*Station)
+	previous.dirty = false
+	previous.replacement = t
+}
+
+// Station returns the records of the station, or nil if there are none.
+func (t *Tracker) Station(stationID string) *Station {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.replacement != nil {
+		return t.replacement.Station(stationID)
+	}
+
+	s, ok := t.stations[stationID]
+	if !ok {
+		return nil
+	}
+
+	return s.withToday()
+}
+
+func newPeriod(start time.Time) Period {
+	return Period{
+		Start: start,
+		Highs: make(map[string]Extreme),
+		Lows:  make(map[string]Extreme),
+	}
+}
+
+// updateTotals calculates the degree days and rain of a day from its highs and lows.
+func (t *Tracker) updateTotals(day *Period) {
+	high, hasHigh := day.Highs[temperatureField]
+	low, hasLow := day.Lows[temperatureField]
+	if hasHigh && hasLow {
+		mean := (high.Value + low.Value) / 2
+
+		day.HeatingDegreeDays = max(t.options.HeatingBaseCelsius-mean, 0)
+		day.CoolingDegreeDays = max(mean-t.options.CoolingBaseCelsius, 0)
+		day.GrowingDegreeDays = max(mean-t.options.GrowingBaseCelsius, 0)
+	}
+
+	// The daily rain only increases during the day, so its high is the rain of the day
+	if rain, ok := day.Highs[dailyRainField]; ok {
+		day.RainMillimeters = rain.Value
+		day.RainDays = 0
+		if rain.Value >= t.options.RainDayThresholdMillimeters && rain.Value > 0 {
+			day.RainDays = 1
+		}
+	}
+}
+
+func addTotals(period *Period, day Period) {
+	period.HeatingDegreeDays += day.HeatingDegreeDays
+	period.CoolingDegreeDays += day.CoolingDegreeDays
+	period.GrowingDegreeDays += day.GrowingDegreeDays
+	period.RainMillimeters += day.RainMillimeters
+	period.RainDays += day.RainDays
+}
+
+// withToday returns a copy of the records in which the totals of the month include today.
+func (s *Station) withToday() *Station {
+	c := &Station{
+		StationID: s.StationID,
+		Today:     s.Today.clone(),
+		Month:     s.Month.clone(),
+		Records: Records{
+			Since: s.Records.Since,
+			Highs: cloneExtremes(s.Records.Highs),
+			Lows:  cloneExtremes(s.Records.Lows),
+		},
+	}
+	if s.Yesterday != nil {
+		yesterday := s.Yesterday.clone()
+		c.Yesterday = &yesterday
+	}
+	if s.PreviousMonth != nil {
+		previousMonth := s.PreviousMonth.clone()
+		c.PreviousMonth = &previousMonth
+	}
+
+	addTotals(&c.Month, s.Today)
+
+	return c
+}
+
+func (p Period) clone() Period {
+	p.Highs = cloneExtremes(p.Highs)
+	p.Lows = cloneExtremes(p.Lows)
+
+	return p
+}
+
+func cloneExtremes(extremes map[string]Extreme) map[string]Extreme {
+	c := make(map[string]Extreme, len(extremes))
+	for k, v := range extremes {
+		c[k] = v
+	}
+
+	return c
+}
+
+func (t *Tracker) run() {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			if err := t.save(); err != nil {
+				t.logger.Error("Failed to save climate records", zap.Error(err))
+			}
+			t.mu.Unlock()
+		}
+	}
+}
+
+// Close saves the records if they changed. Updates after closing are ignored.
+func (t *Tracker) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.mu.Unlock()
+
+	close(t.done)
+	<-t.stopped
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.save()
+}
+
+// save writes the records to the state file if they changed. The file is replaced atomically, so it is never
+// partially written. The lock must be held.
+func (t *Tracker) save() error {
+	if t.options.StateFile == "" || !t.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(stateFile{Stations: t.stations})
+	if err != nil {
+		return fmt.Errorf("failed to marshal climate records: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(t.options.StateFile), filepath.Base(t.options.StateFile)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write climate state file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write climate state file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write climate state file: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), t.options.StateFile); err != nil {
+		return fmt.Errorf("failed to write climate state file: %w", err)
+	}
+
+	t.dirty = false
+
+	return nil
+}
@@ -0,0 +1,298 @@
+package climate
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+func observation(t time.Time, temperature, dailyRain float64) *wsupload.Observation {
+	return &wsupload.Observation{
+		StationID:                 "station",
+		ObservationTime:           t,
+		OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: temperature},
+		DailyRainMillimeters:      wsupload.NullFloat64{Valid: true, Float64: dailyRain},
+	}
+}
+
+func TestTrackerUpdate(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type update struct {
+		time        time.Time
+		temperature float64
+		dailyRain   float64
+	}
+
+	tests := []struct {
+		name     string
+		location *time.Location
+		updates  []update
+
+		wantToday         time.Time
+		wantYesterday     *time.Time
+		wantMonth         time.Time
+		wantPreviousMonth *time.Time
+		// wantMonthRain is the rain of the month including today
+		wantMonthRain     float64
+		wantMonthRainDays int
+		wantTodayHigh     float64
+		wantRecordLow     float64
+	}{
+		{
+			name:     "same day",
+			location: time.UTC,
+			updates: []update{
+				{time.Date(2024, 3, 10, 6, 0, 0, 0, time.UTC), 5, 0},
+				{time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC), 15, 1},
+			},
+			wantToday:         time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+			wantMonth:         time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantMonthRain:     1,
+			wantMonthRainDays: 1,
+			wantTodayHigh:     15,
+			wantRecordLow:     5,
+		},
+		{
+			name:     "day rollover",
+			location: time.UTC,
+			updates: []update{
+				{time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC), 15, 2},
+				{time.Date(2024, 3, 11, 6, 0, 0, 0, time.UTC), 3, 0.1},
+			},
+			wantToday:         time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+			wantYesterday:     ptr(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)),
+			wantMonth:         time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantMonthRain:     2.1,
+			wantMonthRainDays: 1,
+			wantTodayHigh:     3,
+			wantRecordLow:     3,
+		},
+		{
+			name:     "month rollover",
+			location: time.UTC,
+			updates: []update{
+				{time.Date(2024, 2, 29, 14, 0, 0, 0, time.UTC), 15, 2},
+				{time.Date(2024, 3, 1, 6, 0, 0, 0, time.UTC), 8, 0},
+			},
+			wantToday:         time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantYesterday:     ptr(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)),
+			wantMonth:         time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantPreviousMonth: ptr(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)),
+			wantTodayHigh:     8,
+			wantRecordLow:     8,
+		},
+		{
+			name:     "earlier day is ignored",
+			location: time.UTC,
+			updates: []update{
+				{time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC), 15, 0},
+				{time.Date(2024, 3, 9, 14, 0, 0, 0, time.UTC), -10, 0},
+			},
+			wantToday:     time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+			wantMonth:     time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			wantTodayHigh: 15,
+			wantRecordLow: 15,
+		},
+		{
+			name:     "day in location",
+			location: amsterdam,
+			updates: []update{
+				{time.Date(2024, 3, 31, 21, 0, 0, 0, time.UTC), 10, 0},
+				// 00:30 on the 1st of April in Amsterdam
+				{time.Date(2024, 3, 31, 22, 30, 0, 0, time.UTC), 9, 0},
+			},
+			wantToday:         time.Date(2024, 4, 1, 0, 0, 0, 0, amsterdam),
+			wantYesterday:     ptr(time.Date(2024, 3, 31, 0, 0, 0, 0, amsterdam)),
+			wantMonth:         time.Date(2024, 4, 1, 0, 0, 0, 0, amsterdam),
+			wantPreviousMonth: ptr(time.Date(2024, 3, 1, 0, 0, 0, 0, amsterdam)),
+			wantTodayHigh:     9,
+			wantRecordLow:     9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, err := NewTracker(nil, DefaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tracker.Close()
+
+			for _, u := range tt.updates {
+				tracker.Update(observation(u.time, u.temperature, u.dailyRain), tt.location)
+			}
+
+			s := tracker.Station("station")
+			if s == nil {
+				t.Fatal("Station() = nil")
+			}
+
+			if !s.Today.Start.Equal(tt.wantToday) {
+				t.Errorf("today starts at %s, want %s", s.Today.Start, tt.wantToday)
+			}
+			if !periodStartEqual(s.Yesterday, tt.wantYesterday) {
+				t.Errorf("yesterday = %v, want start %v", s.Yesterday, tt.wantYesterday)
+			}
+			if !s.Month.Start.Equal(tt.wantMonth) {
+				t.Errorf("month starts at %s, want %s", s.Month.Start, tt.wantMonth)
+			}
+			if !periodStartEqual(s.PreviousMonth, tt.wantPreviousMonth) {
+				t.Errorf("previous month = %v, want start %v", s.PreviousMonth, tt.wantPreviousMonth)
+			}
+
+			if !floatEqual(s.Month.RainMillimeters, tt.wantMonthRain) {
+				t.Errorf("month rain = %v, want %v", s.Month.RainMillimeters, tt.wantMonthRain)
+			}
+			if s.Month.RainDays != tt.wantMonthRainDays {
+				t.Errorf("month rain days = %d, want %d", s.Month.RainDays, tt.wantMonthRainDays)
+			}
+			if high := s.Today.Highs[temperatureField].Value; high != tt.wantTodayHigh {
+				t.Errorf("today high = %v, want %v", high, tt.wantTodayHigh)
+			}
+			if low := s.Records.Lows[temperatureField].Value; low != tt.wantRecordLow {
+				t.Errorf("record low = %v, want %v", low, tt.wantRecordLow)
+			}
+		})
+	}
+}
+
+func TestTrackerDegreeDays(t *testing.T) {
+	tests := []struct {
+		name        string
+		high, low   float64
+		wantHeating float64
+		wantCooling float64
+		wantGrowing float64
+	}{
+		{name: "cold", high: 10, low: 2, wantHeating: 12},
+		{name: "mild", high: 20, low: 10, wantHeating: 3, wantGrowing: 5},
+		{name: "hot", high: 30, low: 20, wantCooling: 7, wantGrowing: 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, err := NewTracker(nil, DefaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tracker.Close()
+
+			day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+			tracker.Update(observation(day.Add(6*time.Hour), tt.low, 0), time.UTC)
+			s := tracker.Update(observation(day.Add(14*time.Hour), tt.high, 0), time.UTC)
+
+			if s.Today.HeatingDegreeDays != tt.wantHeating {
+				t.Errorf("heating degree days = %v, want %v", s.Today.HeatingDegreeDays, tt.wantHeating)
+			}
+			if s.Today.CoolingDegreeDays != tt.wantCooling {
+				t.Errorf("cooling degree days = %v, want %v", s.Today.CoolingDegreeDays, tt.wantCooling)
+			}
+			if s.Today.GrowingDegreeDays != tt.wantGrowing {
+				t.Errorf("growing degree days = %v, want %v", s.Today.GrowingDegreeDays, tt.wantGrowing)
+			}
+		})
+	}
+}
+
+func TestTrackerStateFile(t *testing.T) {
+	options := DefaultOptions()
+	options.StateFile = filepath.Join(t.TempDir(), "climate.json")
+
+	tracker, err := NewTracker(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tracker.Update(observation(time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC), 15, 0), time.UTC)
+
+	if err := tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if s := tracker.Update(observation(time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC), 20, 0), time.UTC); s != nil {
+		t.Error("Update() after Close() returned records")
+	}
+
+	tracker, err = NewTracker(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	s := tracker.Station("station")
+	if s == nil {
+		t.Fatal("records were not saved")
+	}
+	if high := s.Today.Highs[temperatureField].Value; high != 15 {
+		t.Errorf("today high = %v, want 15", high)
+	}
+}
+
+func TestTrackerTakeState(t *testing.T) {
+	options := DefaultOptions()
+	options.StateFile = filepath.Join(t.TempDir(), "climate.json")
+
+	previous, err := NewTracker(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous.Update(observation(time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC), 15, 0), time.UTC)
+
+	tracker, err := NewTracker(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.TakeState(previous)
+
+	// Updates of the previous tracker are applied to the new tracker
+	previous.Update(observation(time.Date(2024, 3, 10, 15, 0, 0, 0, time.UTC), 20, 0), time.UTC)
+
+	if err := previous.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := tracker.Station("station")
+	if s == nil {
+		t.Fatal("records were not taken over")
+	}
+	if high := s.Today.Highs[temperatureField].Value; high != 20 {
+		t.Errorf("today high = %v, want 20", high)
+	}
+
+	if err := tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tracker, err = NewTracker(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+
+	if s := tracker.Station("station"); s == nil || s.Today.Highs[temperatureField].Value != 20 {
+		t.Errorf("saved records = %+v, want today high 20", s)
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
+
+func periodStartEqual(period *Period, start *time.Time) bool {
+	if period == nil || start == nil {
+		return period == nil && start == nil
+	}
+
+	return period.Start.Equal(*start)
+}
+
+func floatEqual(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
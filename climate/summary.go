@@ -0,0 +1,92 @@
+package climate
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+// SummarySchema is the schema of Summary, used for Home Assistant discovery.
+var SummarySchema = wsupload.MustNewSchema(reflect.TypeOf(Summary{}))
+
+// Summary contains the most relevant records of a station as flat structure, so they can be used as Home Assistant
+// sensors.
+type Summary struct {
+	StationID string `json:"station_id" influx:"-"`
+
+	TodayHighOutsideTemperatureCelsius wsupload.NullFloat64 `json:"today_high_outside_temperature_celsius" influx:"-" homeassistant:"Today high outside temperature,device_class=temperature,unit_of_measurement=°C,state_class=measurement"`
+	TodayHighOutsideTemperatureTime    *time.Time           `json:"today_high_outside_temperature_time" influx:"-" homeassistant:"Today high outside temperature time,device_class=timestamp"`
+	TodayLowOutsideTemperatureCelsius  wsupload.NullFloat64 `json:"today_low_outside_temperature_celsius" influx:"-" homeassistant:"Today low outside temperature,device_class=temperature,unit_of_measurement=°C,state_class=measurement"`
+	TodayLowOutsideTemperatureTime     *time.Time           `json:"today_low_outside_temperature_time" influx:"-" homeassistant:"Today low outside temperature time,device_class=timestamp"`
+	TodayHighWindGustMetersPerSecond   wsupload.NullFloat64 `json:"today_high_wind_gust_meters_per_second" influx:"-" homeassistant:"Today high wind gust,unit_of_measurement=m/s,state_class=measurement"`
+
+	TodayHeatingDegreeDays float64 `json:"today_heating_degree_days" influx:"-" homeassistant:"Today heating degree days,unit_of_measurement=°C·d"`
+	TodayCoolingDegreeDays float64 `json:"today_cooling_degree_days" influx:"-" homeassistant:"Today cooling degree days,unit_of_measurement=°C·d"`
+	TodayGrowingDegreeDays float64 `json:"today_growing_degree_days" influx:"-" homeassistant:"Today growing degree days,unit_of_measurement=°C·d"`
+
+	MonthHighOutsideTemperatureCelsius wsupload.NullFloat64 `json:"month_high_outside_temperature_celsius" influx:"-" homeassistant:"Month high outside temperature,device_class=temperature,unit_of_measurement=°C,state_class=measurement"`
+	MonthLowOutsideTemperatureCelsius  wsupload.NullFloat64 `json:"month_low_outside_temperature_celsius" influx:"-" homeassistant:"Month low outside temperature,device_class=temperature,unit_of_measurement=°C,state_class=measurement"`
+
+	MonthHeatingDegreeDays float64 `json:"month_heating_degree_days" influx:"-" homeassistant:"Month heating degree days,unit_of_measurement=°C·d"`
+	MonthCoolingDegreeDays float64 `json:"month_cooling_degree_days" influx:"-" homeassistant:"Month cooling degree days,unit_of_measurement=°C·d"`
+	MonthGrowingDegreeDays float64 `json:"month_growing_degree_days" influx:"-" homeassistant:"Month growing degree days,unit_of_measurement=°C·d"`
+	MonthRainMillimeters   float64 `json:"month_rain_millimeters" influx:"-" homeassistant:"Month rain,unit_of_measurement=mm"`
+	MonthRainDays          int     `json:"month_rain_days" influx:"-" homeassistant:"Month rain days,unit_of_measurement=d"`
+
+	RecordHighOutsideTemperatureCelsius wsupload.NullFloat64 `json:"record_high_outside_temperature_celsius" influx:"-" homeassistant:"Record high outside temperature,device_class=temperature,unit_of_measurement=°C,state_class=measurement"`
+	RecordHighOutsideTemperatureTime    *time.Time           `json:"record_high_outside_temperature_time" influx:"-" homeassistant:"Record high outside temperature time,device_class=timestamp"`
+	RecordLowOutsideTemperatureCelsius  wsupload.NullFloat64 `json:"record_low_outside_temperature_celsius" influx:"-" homeassistant:"Record low outside temperature,device_class=temperature,unit_of_measurement=°C,state_class=measurement"`
+	RecordLowOutsideTemperatureTime     *time.Time           `json:"record_low_outside_temperature_time" influx:"-" homeassistant:"Record low outside temperature time,device_class=timestamp"`
+	RecordHighWindGustMetersPerSecond   wsupload.NullFloat64 `json:"record_high_wind_gust_meters_per_second" influx:"-" homeassistant:"Record high wind gust,unit_of_measurement=m/s,state_class=measurement"`
+	RecordHighWindGustTime              *time.Time           `json:"record_high_wind_gust_time" influx:"-" homeassistant:"Record high wind gust time,device_class=timestamp"`
+	RecordHighDailyRainMillimeters      wsupload.NullFloat64 `json:"record_high_daily_rain_millimeters" influx:"-" homeassistant:"Record daily rain,unit_of_measurement=mm"`
+	RecordHighDailyRainTime             *time.Time           `json:"record_high_daily_rain_time" influx:"-" homeassistant:"Record daily rain time,device_class=timestamp"`
+}
+
+// Publisher is implemented by publishers that publish the climate records of stations.
+type Publisher interface {
+	PublishClimate(summary *Summary) error
+}
+
+// Summary returns the summary of the records.
+func (s *Station) Summary() *Summary {
+	summary := &Summary{
+		StationID: s.StationID,
+
+		TodayHeatingDegreeDays: s.Today.HeatingDegreeDays,
+		TodayCoolingDegreeDays: s.Today.CoolingDegreeDays,
+		TodayGrowingDegreeDays: s.Today.GrowingDegreeDays,
+
+		MonthHeatingDegreeDays: s.Month.HeatingDegreeDays,
+		MonthCoolingDegreeDays: s.Month.CoolingDegreeDays,
+		MonthGrowingDegreeDays: s.Month.GrowingDegreeDays,
+		MonthRainMillimeters:   s.Month.RainMillimeters,
+		MonthRainDays:          s.Month.RainDays,
+	}
+
+	summary.TodayHighOutsideTemperatureCelsius, summary.TodayHighOutsideTemperatureTime = extreme(s.Today.Highs, temperatureField)
+	summary.TodayLowOutsideTemperatureCelsius, summary.TodayLowOutsideTemperatureTime = extreme(s.Today.Lows, temperatureField)
+	summary.TodayHighWindGustMetersPerSecond, _ = extreme(s.Today.Highs, "wind_gust_meters_per_second")
+
+	summary.MonthHighOutsideTemperatureCelsius, _ = extreme(s.Month.Highs, temperatureField)
+	summary.MonthLowOutsideTemperatureCelsius, _ = extreme(s.Month.Lows, temperatureField)
+
+	summary.RecordHighOutsideTemperatureCelsius, summary.RecordHighOutsideTemperatureTime = extreme(s.Records.Highs, temperatureField)
+	summary.RecordLowOutsideTemperatureCelsius, summary.RecordLowOutsideTemperatureTime = extreme(s.Records.Lows, temperatureField)
+	summary.RecordHighWindGustMetersPerSecond, summary.RecordHighWindGustTime = extreme(s.Records.Highs, "wind_gust_meters_per_second")
+	summary.RecordHighDailyRainMillimeters, summary.RecordHighDailyRainTime = extreme(s.Records.Highs, dailyRainField)
+
+	return summary
+}
+
+func extreme(extremes map[string]Extreme, jsonName string) (wsupload.NullFloat64, *time.Time) {
+	e, ok := extremes[jsonName]
+	if !ok {
+		return wsupload.NullFloat64{}, nil
+	}
+
+	t := e.Time.UTC()
+
+	return wsupload.NullFloat64{Valid: true, Float64: e.Value}, &t
+}
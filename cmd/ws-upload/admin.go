@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/koesie10/ws-upload/capture"
+	"github.com/koesie10/ws-upload/config"
+	"github.com/koesie10/ws-upload/mqtt"
+	"github.com/koesie10/ws-upload/password"
+	"github.com/koesie10/ws-upload/wsupload"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+type replayResponse struct {
+	Replayed int `json:"replayed"`
+}
+
+// Publisher returns the configuration and the publisher with the given name.
+func (p *observationProcessor) Publisher(name string) (config.Publisher, wsupload.Publisher, bool) {
+	for i, publisherConfig := range p.config.Publishers {
+		if publisherConfig.Name == name && i < len(p.publishers) {
+			return publisherConfig, p.publishers[i], true
+		}
+	}
+
+	return config.Publisher{}, nil, false
+}
+
+// adminAuthMiddleware authenticates requests using the admin token in the Authorization header as a bearer token.
+func adminAuthMiddleware(token string, passwordLockout *lockout) echo.MiddlewareFunc {
+	passwords := password.NewCache()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if ok, err := passwordLockout.Authenticate(c, func() bool {
+				bearer, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+				return ok && passwords.Verify(token, bearer)
+			}); !ok {
+				return err
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// registerAdminRoutes registers the admin API. The reload function recreates the processor from the current config.
+// The capture file is replayed if no uploads are sent to the replay route, it is not available if empty.
+func registerAdminRoutes(g *echo.Group, processors *processorHolder, stations *stationTracker, reload func() error, captureFile string) {
+	g.GET("/publishers", func(c echo.Context) error {
+		processor, release, err := processors.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		return c.JSON(http.StatusOK, processor.Health())
+	})
+
+	g.GET("/stations", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, stations.Statuses())
+	})
+
+	discoveryPublisher := func(c echo.Context, processor *observationProcessor) (mqtt.DiscoveryPublisher, error) {
+		publisherConfig, publisher, ok := processor.Publisher(c.Param("name"))
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusNotFound, "Unknown publisher")
+		}
+
+		discoveryPublisher, ok := publisher.(mqtt.DiscoveryPublisher)
+		if !ok {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Publisher %s of type %s does not support discovery", publisherConfig.Name, publisherConfig.Type))
+		}
+
+		return discoveryPublisher, nil
+	}
+
+	g.POST("/publishers/:name/discovery", func(c echo.Context) error {
+		processor, release, err := processors.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		publisher, err := discoveryPublisher(c, processor)
+		if err != nil {
+			return err
+		}
+
+		if err := publisher.PublishDiscovery(); err != nil {
+			return echo.NewHTTPError(http.StatusBadGateway, "Failed to publish discovery: "+err.Error())
+		}
+
+		logger.Info("Published discovery messages using the admin API", zap.String("publisher.name", c.Param("name")))
+
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	g.DELETE("/publishers/:name/discovery", func(c echo.Context) error {
+		processor, release, err := processors.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		publisher, err := discoveryPublisher(c, processor)
+		if err != nil {
+			return err
+		}
+
+		if err := publisher.ClearDiscovery(); err != nil {
+			return echo.NewHTTPError(http.StatusBadGateway, "Failed to clear discovery: "+err.Error())
+		}
+
+		logger.Info("Cleared discovery messages using the admin API", zap.String("publisher.name", c.Param("name")))
+
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	g.DELETE("/discovery", func(c echo.Context) error {
+		processor, release, err := processors.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		for i, publisher := range processor.publishers {
+			discoveryPublisher, ok := publisher.(mqtt.DiscoveryPublisher)
+			if !ok {
+				continue
+			}
+
+			if err := discoveryPublisher.ClearDiscovery(); err != nil {
+				return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("Failed to clear discovery of publisher %s: %v", processor.config.Publishers[i].Name, err))
+			}
+		}
+
+		logger.Info("Cleared discovery messages of all publishers using the admin API")
+
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	g.POST("/reload", func(c echo.Context) error {
+		if err := reload(); err != nil {
+			logger.Error("Failed to reload config, keeping the current config", zap.Error(err))
+
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to reload config: "+err.Error())
+		}
+
+		logger.Info("Reloaded config using the admin API")
+
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	// The capture file is the only persistent record of uploads, so it is used as the spool. Uploads to replay can also
+	// be given as a capture file in the body.
+	g.POST("/replay", func(c echo.Context) error {
+		var since time.Time
+		if c.QueryParam("since") != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339, c.QueryParam("since"))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid since time, use RFC 3339")
+			}
+		}
+
+		body := bufio.NewReader(c.Request().Body)
+
+		var reader *capture.Reader
+		if _, err := body.Peek(1); err == nil {
+			reader = capture.NewReader(body)
+		} else {
+			if captureFile == "" {
+				return echo.NewHTTPError(http.StatusBadRequest, "No uploads in the body and no capture file is set")
+			}
+			if since.IsZero() {
+				return echo.NewHTTPError(http.StatusBadRequest, "Replaying the capture file requires a since time")
+			}
+
+			f, err := os.Open(captureFile)
+			if errors.Is(err, os.ErrNotExist) {
+				return c.JSON(http.StatusOK, replayResponse{})
+			}
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			reader = capture.NewReader(f)
+		}
+
+		processor, release, err := processors.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		count, err := replay(processor, reader, false, since)
+		if err != nil {
+			// Only reading the uploads can fail, uploads that cannot be processed are skipped
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("Failed to read capture after replaying %d uploads: %v", count, err))
+		}
+
+		logger.Info("Replayed uploads using the admin API", zap.Int("replay.count", count), zap.Time("replay.since", since))
+
+		return c.JSON(http.StatusOK, replayResponse{
+			Replayed: count,
+		})
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/koesie10/ws-upload/capture"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// maxCaptureBodySize is the maximum size of the body of a captured upload, larger uploads are rejected
+const maxCaptureBodySize = 64 << 10
+
+// captureRequest appends the request to the capture file. It is only called for authenticated uploads, so other
+// clients cannot fill the disk.
+func captureRequest(w *capture.Writer, c echo.Context) error {
+	req := c.Request()
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(req.Body, maxCaptureBodySize+1))
+		if err != nil {
+			return err
+		}
+		if len(body) > maxCaptureBodySize {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body too large")
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if err := w.Write(capture.NewRecord(time.Now(), req, body)); err != nil {
+		logger.Error("Failed to capture request", zap.Error(err))
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the config file",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [config file]",
+	Short: "Validate a config file without starting the server",
+	Long:  "Validate a config file without starting the server. If no file is given, the file of --config is validated.",
+	Args:  cobra.MaximumNArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return parseFlags()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			rootConfig.ConfigFile = args[0]
+		}
+		if rootConfig.ConfigFile == "" {
+			return fmt.Errorf("no config file given")
+		}
+
+		c, err := loadConfig("")
+		if err != nil {
+			return err
+		}
+
+		// The server refuses to start if a station has no password
+		if err := c.ValidatePasswords(); err != nil {
+			return err
+		}
+
+		// Creating the processor validates the parts of the config that are only checked when they are used
+		processor, err := newObservationProcessor(c, nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := processor.Close(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(cmd.OutOrStdout(), "%s is valid: %d stations, %d publishers\n", rootConfig.ConfigFile, len(c.Stations), len(c.Publishers))
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configValidateCmd)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/ws-upload/config"
+	"github.com/koesie10/ws-upload/export"
+	"github.com/koesie10/ws-upload/influx"
+	"github.com/koesie10/ws-upload/wsupload"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var exportConfig = struct {
+	StationID string `env:"EXPORT_STATION" flag:"station" desc:"station ID of the observations to export"`
+	From      string `env:"EXPORT_FROM" flag:"from" desc:"start of the export as RFC 3339 time or date (UTC)"`
+	To        string `env:"EXPORT_TO" flag:"to" desc:"end of the export as RFC 3339 time or date (UTC), inclusive, defaults to now"`
+	Format    string `env:"EXPORT_FORMAT" flag:"format" desc:"export format: csv, json or columnar"`
+	Output    string `env:"EXPORT_OUTPUT" flag:"output" desc:"file to write the export to, defaults to stdout"`
+	Publisher string `env:"EXPORT_PUBLISHER" flag:"publisher" desc:"name of the publisher to read the observations from, defaults to the first publisher that stores observations"`
+}{
+	Format: string(export.FormatCSV),
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export stored observations of a station as CSV or JSON",
+	Long: `Export the observations of a station stored by a publisher, such as influx, as CSV or JSON. The fields are
+named after the JSON names of the observation, so a CSV export can be imported again using the import command.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return parseFlags(&exportConfig, &observationConfig)
+	},
+	RunE: RunExport,
+}
+
+func RunExport(cmd *cobra.Command, args []string) error {
+	if exportConfig.StationID == "" {
+		return errors.New("--station is required")
+	}
+
+	format, err := export.ParseFormat(exportConfig.Format)
+	if err != nil {
+		return err
+	}
+
+	if exportConfig.From == "" {
+		return errors.New("--from is required")
+	}
+	start, _, err := parseExportTime(exportConfig.From)
+	if err != nil {
+		return fmt.Errorf("invalid --from: %w", err)
+	}
+
+	end := time.Now()
+	if exportConfig.To != "" {
+		var isDate bool
+		end, isDate, err = parseExportTime(exportConfig.To)
+		if err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+		if isDate {
+			// Include the whole day
+			end = end.Add(24*time.Hour - time.Second)
+		}
+	}
+
+	if end.Before(start) {
+		return errors.New("--to must not be before --from")
+	}
+
+	c, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	publisherConfig, err := exportPublisherConfig(c)
+	if err != nil {
+		return err
+	}
+
+	publishers, err := createPublishers(&config.Config{Publishers: []config.Publisher{publisherConfig}})
+	if err != nil {
+		return err
+	}
+	defer closePublishers(publishers)
+
+	querier, ok := publishers[0].(wsupload.ObservationQuerier)
+	if !ok {
+		return fmt.Errorf("publisher %s of type %s does not store observations", publisherConfig.Name, publisherConfig.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	observations, err := querier.Observations(ctx, exportConfig.StationID, start, end)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+
+	var file *os.File
+	if exportConfig.Output != "" {
+		file, err = os.Create(exportConfig.Output)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+
+		out = file
+	}
+
+	if err := export.Write(out, format, observations); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+	}
+
+	logger.Info(fmt.Sprintf("Exported %d observations", len(observations)), zap.String("publisher.name", publisherConfig.Name))
+
+	return nil
+}
+
+// storingPublisherTypes are the types of publishers which store observations and can be exported from
+var storingPublisherTypes = map[string]bool{
+	influx.PublisherType: true,
+}
+
+// parseExportTime parses an RFC 3339 time or a date in UTC. It returns whether the value is a date.
+func parseExportTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%q is not an RFC 3339 time or a date", value)
+	}
+
+	return t, true, nil
+}
+
+// exportPublisherConfig returns the configuration of the publisher selected using --publisher, or the first publisher
+// of a type which stores observations.
+func exportPublisherConfig(c *config.Config) (config.Publisher, error) {
+	for _, publisherConfig := range c.Publishers {
+		if exportConfig.Publisher != "" && publisherConfig.Name == exportConfig.Publisher {
+			return publisherConfig, nil
+		}
+		if exportConfig.Publisher == "" && storingPublisherTypes[publisherConfig.Type] {
+			return publisherConfig, nil
+		}
+	}
+
+	if exportConfig.Publisher != "" {
+		return config.Publisher{}, fmt.Errorf("unknown publisher %s", exportConfig.Publisher)
+	}
+
+	return config.Publisher{}, errors.New("no publisher that stores observations is configured")
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	if err := pflagenv.Setup(exportCmd.Flags(), &exportConfig); err != nil {
+		log.Fatal(err)
+	}
+	exportCmd.Flags().AddFlagSet(observationFlags)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/koesie10/ws-upload/wsupload"
+	"github.com/labstack/echo/v4"
+)
+
+type readinessResponse struct {
+	Status     wsupload.HealthState      `json:"status"`
+	Publishers []publisherHealthResponse `json:"publishers"`
+}
+
+type publisherHealthResponse struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	wsupload.Health
+}
+
+// Health returns the health of all publishers. The overall state is the worst state of all publishers.
+func (p *observationProcessor) Health() readinessResponse {
+	response := readinessResponse{
+		Status:     wsupload.HealthStateConnected,
+		Publishers: make([]publisherHealthResponse, 0, len(p.publishers)),
+	}
+
+	for i, publisher := range p.publishers {
+		health := wsupload.PublisherHealth(publisher)
+		if health.State.Worse(response.Status) {
+			response.Status = health.State
+		}
+
+		response.Publishers = append(response.Publishers, publisherHealthResponse{
+			Name:   p.config.Publishers[i].Name,
+			Type:   p.config.Publishers[i].Type,
+			Health: health,
+		})
+	}
+
+	return response
+}
+
+// readinessHandler responds with the health of all publishers. It responds with 503 Service Unavailable if any
+// publisher is failing, so it can be used as a readiness probe.
+func readinessHandler(processors *processorHolder) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		processor, release, err := processors.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		response := processor.Health()
+
+		status := http.StatusOK
+		if response.Status == wsupload.HealthStateFailing {
+			status = http.StatusServiceUnavailable
+		}
+
+		return c.JSON(status, response)
+	}
+}
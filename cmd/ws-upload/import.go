@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/ws-upload/config"
+	"github.com/koesie10/ws-upload/importer"
+	"github.com/koesie10/ws-upload/wsupload"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var importConfig = struct {
+	StationID   string   `env:"IMPORT_STATION_ID" flag:"station-id" desc:"station ID of the imported observations"`
+	Timezone    string   `env:"IMPORT_TIMEZONE" flag:"timezone" desc:"IANA time zone of times without a time zone in the CSV file, defaults to the time zone of the station or UTC"`
+	MappingFile string   `env:"IMPORT_MAPPING_FILE" flag:"mapping-file" desc:"YAML or TOML file mapping CSV columns onto observation fields, columns are detected from their header if not mapped"`
+	Publishers  []string `env:"IMPORT_PUBLISHERS" flag:"publishers" desc:"names of the publishers to import into, defaults to all publishers that can skip existing observations"`
+	DryRun      bool     `env:"IMPORT_DRY_RUN" flag:"dry-run" desc:"only read the CSV file and print the number of observations"`
+}{}
+
+var importCmd = &cobra.Command{
+	Use:   "import <csv file>",
+	Short: "Import historical observations from a CSV export into the publishers",
+	Long: `Import historical observations from a CSV export, such as an export of the console or ecowitt.net, into the
+publishers using their original time. Observations which already exist are skipped for publishers that support it,
+such as influx. Other publishers are only used if they are selected using --publishers.`,
+	Args: cobra.ExactArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return parseFlags(&importConfig, &observationConfig)
+	},
+	RunE: RunImport,
+}
+
+func RunImport(cmd *cobra.Command, args []string) error {
+	if importConfig.StationID == "" {
+		return errors.New("--station-id is required")
+	}
+
+	c, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	location := time.UTC
+	timezone := importConfig.Timezone
+	if station := c.Station(importConfig.StationID); timezone == "" && station != nil {
+		timezone = station.Timezone
+	}
+	if timezone != "" {
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("invalid time zone: %w", err)
+		}
+	}
+
+	var mapping importer.Mapping
+	if importConfig.MappingFile != "" {
+		m, err := importer.LoadMapping(importConfig.MappingFile)
+		if err != nil {
+			return err
+		}
+		mapping = *m
+	}
+
+	observations, err := readImport(args[0], mapping, location)
+	if err != nil {
+		return err
+	}
+
+	if len(observations) == 0 {
+		logger.Info("No observations to import")
+		return nil
+	}
+
+	start, end := observations[0].ObservationTime, observations[len(observations)-1].ObservationTime
+
+	logger.Info(fmt.Sprintf("Read %d observations", len(observations)), zap.Time("import.start", start), zap.Time("import.end", end))
+
+	if importConfig.DryRun {
+		return nil
+	}
+
+	publisherConfigs, err := importPublisherConfigs(c)
+	if err != nil {
+		return err
+	}
+
+	publishers, err := createPublishers(&config.Config{Publishers: publisherConfigs})
+	if err != nil {
+		return err
+	}
+	defer closePublishers(publishers)
+
+	for i, publisher := range publishers {
+		entry := logger.With(zap.String("publisher.name", publisherConfigs[i].Name))
+
+		lister, ok := publisher.(wsupload.ObservationTimesLister)
+		if !ok && len(importConfig.Publishers) == 0 {
+			entry.Info("Skipping publisher that cannot skip existing observations, select it using --publishers to import into it anyway")
+			continue
+		}
+
+		existing := make(map[int64]struct{})
+		if ok {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			times, err := lister.ObservationTimes(ctx, importConfig.StationID, start, end)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("failed to list existing observations of publisher %s: %w", publisherConfigs[i].Name, err)
+			}
+
+			for _, t := range times {
+				existing[t.Unix()] = struct{}{}
+			}
+		} else {
+			entry.Warn("Publisher cannot skip existing observations, all observations are imported")
+		}
+
+		var imported, skipped int
+		for _, obs := range observations {
+			if _, ok := existing[obs.ObservationTime.Unix()]; ok {
+				skipped++
+				continue
+			}
+
+			if err := publisher.Publish(obs); err != nil {
+				return fmt.Errorf("failed to publish observation of %s to publisher %s: %w", obs.ObservationTime, publisherConfigs[i].Name, err)
+			}
+			imported++
+		}
+
+		entry.Info(fmt.Sprintf("Imported %d observations, skipped %d existing observations", imported, skipped))
+	}
+
+	return nil
+}
+
+// readImport reads all observations of the CSV file, sorted by time.
+func readImport(path string, mapping importer.Mapping, location *time.Location) ([]*wsupload.Observation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, err := importer.NewReader(logger, f, mapping, importConfig.StationID, location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var observations []*wsupload.Observation
+	for {
+		obs, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		observations = append(observations, obs)
+	}
+
+	sort.SliceStable(observations, func(i, j int) bool {
+		return observations[i].ObservationTime.Before(observations[j].ObservationTime)
+	})
+
+	return observations, nil
+}
+
+// importPublisherConfigs returns the configuration of the publishers selected using --publishers, or all publishers.
+func importPublisherConfigs(c *config.Config) ([]config.Publisher, error) {
+	if len(importConfig.Publishers) == 0 {
+		return c.Publishers, nil
+	}
+
+	var publisherConfigs []config.Publisher
+	for _, name := range importConfig.Publishers {
+		var found bool
+		for _, publisherConfig := range c.Publishers {
+			if publisherConfig.Name == name {
+				publisherConfigs = append(publisherConfigs, publisherConfig)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown publisher %s", name)
+		}
+	}
+
+	return publisherConfigs, nil
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	if err := pflagenv.Setup(importCmd.Flags(), &importConfig); err != nil {
+		log.Fatal(err)
+	}
+	importCmd.Flags().AddFlagSet(observationFlags)
+}
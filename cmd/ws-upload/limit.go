@@ -0,0 +1,330 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+var limitConfig = struct {
+	TrustedProxies []string `env:"TRUSTED_PROXIES" flag:"trusted-proxies" desc:"CIDRs of reverse proxies whose X-Forwarded-For header is trusted, if empty the client IP is the remote address of the connection"`
+
+	AllowCIDRs []string `env:"UPLOAD_ALLOW_CIDRS" flag:"upload-allow-cidrs" desc:"CIDRs that are allowed to upload, if empty all addresses that are not denied are allowed"`
+	DenyCIDRs  []string `env:"UPLOAD_DENY_CIDRS" flag:"upload-deny-cidrs" desc:"CIDRs that are not allowed to upload"`
+
+	IPRateLimit      float64 `env:"UPLOAD_IP_RATE_LIMIT" flag:"upload-ip-rate-limit" desc:"maximum number of uploads per second per IP address, set to 0 to disable, requires --trusted-proxies behind a reverse proxy"`
+	IPRateBurst      int     `env:"UPLOAD_IP_RATE_BURST" flag:"upload-ip-rate-burst" desc:"maximum burst of uploads per IP address"`
+	StationRateLimit float64 `env:"UPLOAD_STATION_RATE_LIMIT" flag:"upload-station-rate-limit" desc:"maximum number of uploads per second per station, set to 0 to disable"`
+	StationRateBurst int     `env:"UPLOAD_STATION_RATE_BURST" flag:"upload-station-rate-burst" desc:"maximum burst of uploads per station"`
+
+	LockoutAttempts int           `env:"LOCKOUT_ATTEMPTS" flag:"lockout-attempts" desc:"number of bad passwords after which an IP address is locked out, set to 0 to disable, requires --trusted-proxies behind a reverse proxy"`
+	LockoutDuration time.Duration `env:"LOCKOUT_DURATION" flag:"lockout-duration" desc:"how long an IP address is locked out after too many bad passwords"`
+}{
+	// Rate limits per IP address are opt-in, since all stations share the IP address of a reverse proxy if the proxy is
+	// not trusted. The lockout is enabled, since a correct password forgets all bad passwords of the IP address.
+	IPRateBurst:      20,
+	StationRateLimit: 0.5,
+	StationRateBurst: 10,
+
+	LockoutAttempts: 10,
+	LockoutDuration: 15 * time.Minute,
+}
+
+// limiterIdleTimeout is the time after which the state of an idle IP address or station is forgotten
+const limiterIdleTimeout = 10 * time.Minute
+
+// parseCIDRs parses CIDRs, a single IP address is interpreted as a CIDR containing only that address.
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %s", value)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %s: %w", value, err)
+		}
+
+		networks = append(networks, network)
+	}
+
+	return networks, nil
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newIPExtractor returns an IP extractor that only trusts the X-Forwarded-For header if the request comes from one of
+// the trusted proxies.
+func newIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	networks, err := parseCIDRs(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(networks) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	trustOptions := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, network := range networks {
+		trustOptions = append(trustOptions, echo.TrustIPRange(network))
+	}
+
+	return echo.ExtractIPFromXFFHeader(trustOptions...), nil
+}
+
+// ipFilterMiddleware rejects requests from denied IP addresses, and from IP addresses that are not allowed if any
+// allowed CIDRs are given.
+func ipFilterMiddleware(allowCIDRs, denyCIDRs []string) (echo.MiddlewareFunc, error) {
+	allowed, err := parseCIDRs(allowCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowed CIDRs: %w", err)
+	}
+	denied, err := parseCIDRs(denyCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid denied CIDRs: %w", err)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := net.ParseIP(c.RealIP())
+
+			if ip == nil || containsIP(denied, ip) || (len(allowed) > 0 && !containsIP(allowed, ip)) {
+				uploadsRejected.WithLabelValues("ip_denied").Inc()
+				logger.Warn("Rejected upload from denied IP address", zap.String("http.remote_ip", c.RealIP()))
+
+				return c.String(http.StatusForbidden, "Forbidden")
+			}
+
+			return next(c)
+		}
+	}, nil
+}
+
+// keyedLimiter is a rate limiter per key, such as an IP address or station ID.
+type keyedLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	limiters  map[string]*limiterEntry
+	lastSweep time.Time
+}
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newKeyedLimiter(limit float64, burst int) *keyedLimiter {
+	return &keyedLimiter{
+		limit:    rate.Limit(limit),
+		burst:    burst,
+		limiters: make(map[string]*limiterEntry),
+	}
+}
+
+func (l *keyedLimiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	entry, ok := l.limiters[key]
+	if !ok {
+		entry = &limiterEntry{
+			limiter: rate.NewLimiter(l.limit, l.burst),
+		}
+		l.limiters[key] = entry
+	}
+	entry.lastSeen = now
+
+	return entry.limiter.AllowN(now, 1)
+}
+
+// sweep removes idle limiters, so the number of limiters does not grow without bound.
+func (l *keyedLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) > limiterIdleTimeout {
+			delete(l.limiters, key)
+		}
+	}
+}
+
+// ipRateLimitMiddleware rejects requests from IP addresses that exceed the rate limit.
+func ipRateLimitMiddleware(limiter *keyedLimiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !limiter.Allow(c.RealIP()) {
+				uploadsRejected.WithLabelValues("ip_rate_limited").Inc()
+				logger.Debug("Rate limited upload", zap.String("http.remote_ip", c.RealIP()))
+
+				return c.String(http.StatusTooManyRequests, "Too many requests")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// lockout locks out IP addresses after too many bad passwords. Failures are forgotten once the lockout duration has
+// passed without any new failures.
+type lockout struct {
+	attempts int
+	duration time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*lockoutEntry
+}
+
+type lockoutEntry struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+func newLockout(attempts int, duration time.Duration) *lockout {
+	return &lockout{
+		attempts: attempts,
+		duration: duration,
+		entries:  make(map[string]*lockoutEntry),
+	}
+}
+
+// LockedOut returns whether the IP address is currently locked out.
+func (l *lockout) LockedOut(ip string) bool {
+	if l.attempts <= 0 {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[ip]
+
+	return ok && time.Now().Before(entry.lockedUntil)
+}
+
+// Failure records a bad password for the IP address. It returns whether the IP address is now locked out.
+func (l *lockout) Failure(ip string) bool {
+	if l.attempts <= 0 {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	for key, entry := range l.entries {
+		if now.Sub(entry.lastFailure) > l.duration && now.After(entry.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+
+	entry, ok := l.entries[ip]
+	if !ok {
+		entry = &lockoutEntry{}
+		l.entries[ip] = entry
+	}
+
+	entry.failures++
+	entry.lastFailure = now
+
+	if entry.failures < l.attempts {
+		return false
+	}
+
+	entry.failures = 0
+	entry.lockedUntil = now.Add(l.duration)
+
+	return true
+}
+
+// Success forgets all bad passwords for the IP address.
+func (l *lockout) Success(ip string) {
+	if l.attempts <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, ip)
+}
+
+// Authenticate rejects requests from locked out IP addresses, and otherwise calls authenticate and records the result.
+// It returns false if the request was rejected, in which case a response has already been written.
+func (l *lockout) Authenticate(c echo.Context, authenticate func() bool) (bool, error) {
+	ip := c.RealIP()
+
+	if l.LockedOut(ip) {
+		uploadsRejected.WithLabelValues("locked_out").Inc()
+
+		return false, c.String(http.StatusTooManyRequests, "Too many bad passwords")
+	}
+
+	if !authenticate() {
+		uploadsRejected.WithLabelValues("bad_password").Inc()
+		logger.Warn("Bad password", zap.String("http.remote_ip", ip), zap.String("http.path", c.Path()))
+
+		if l.Failure(ip) {
+			ipLockouts.Inc()
+			logger.Warn("Locked out IP address after too many bad passwords", zap.String("http.remote_ip", ip), zap.Duration("ws_upload.lockout_duration", l.duration))
+		}
+
+		return false, c.String(http.StatusUnauthorized, "Bad password")
+	}
+
+	l.Success(ip)
+
+	return true, nil
+}
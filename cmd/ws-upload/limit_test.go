@@ -0,0 +1,188 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", values: nil, want: nil},
+		{name: "blank values", values: []string{"", "  "}, want: nil},
+		{name: "cidr", values: []string{"192.168.1.0/24"}, want: []string{"192.168.1.0/24"}},
+		{name: "cidr with host bits", values: []string{"192.168.1.7/24"}, want: []string{"192.168.1.0/24"}},
+		{name: "ipv4 address", values: []string{"10.0.0.1"}, want: []string{"10.0.0.1/32"}},
+		{name: "ipv6 address", values: []string{"::1"}, want: []string{"::1/128"}},
+		{name: "ipv6 cidr", values: []string{"fd00::/8"}, want: []string{"fd00::/8"}},
+		{name: "whitespace", values: []string{" 10.0.0.0/8 ", "127.0.0.1"}, want: []string{"10.0.0.0/8", "127.0.0.1/32"}},
+		{name: "invalid address", values: []string{"10.0.0"}, wantErr: true},
+		{name: "invalid cidr", values: []string{"10.0.0.0/33"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			networks, err := parseCIDRs(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCIDRs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, network := range networks {
+				got = append(got, network.String())
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseCIDRs() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("parseCIDRs()[%d] = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestContainsIP(t *testing.T) {
+	networks, err := parseCIDRs([]string{"192.168.1.0/24", "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.168.1.1", true},
+		{"192.168.2.1", false},
+		{"10.0.0.1", true},
+		{"10.0.0.2", false},
+		{"::ffff:192.168.1.1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := containsIP(networks, net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("containsIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit float64
+		burst int
+		// requests is the number of requests per key made at once
+		requests int
+		want     int
+	}{
+		{name: "disabled", limit: 0, burst: 0, requests: 100, want: 100},
+		{name: "within burst", limit: 1, burst: 5, requests: 5, want: 5},
+		{name: "exceeds burst", limit: 1, burst: 5, requests: 8, want: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newKeyedLimiter(tt.limit, tt.burst)
+
+			for _, key := range []string{"a", "b"} {
+				allowed := 0
+				for i := 0; i < tt.requests; i++ {
+					if limiter.Allow(key) {
+						allowed++
+					}
+				}
+
+				if allowed != tt.want {
+					t.Errorf("key %s: allowed %d requests, want %d", key, allowed, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyedLimiterSweep(t *testing.T) {
+	limiter := newKeyedLimiter(1, 1)
+	limiter.Allow("idle")
+	limiter.Allow("active")
+
+	now := time.Now().Add(limiterIdleTimeout + time.Minute)
+	limiter.limiters["active"].lastSeen = now
+
+	limiter.sweep(now)
+
+	if _, ok := limiter.limiters["idle"]; ok {
+		t.Error("idle limiter was not removed")
+	}
+	if _, ok := limiter.limiters["active"]; !ok {
+		t.Error("active limiter was removed")
+	}
+}
+
+func TestLockout(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		// results are the authentication results in order, true for a good password
+		results      []bool
+		wantLocked   bool
+		wantFailures int
+	}{
+		{name: "disabled", attempts: 0, results: []bool{false, false, false, false}, wantLocked: false},
+		{name: "below attempts", attempts: 3, results: []bool{false, false}, wantLocked: false, wantFailures: 2},
+		{name: "reaches attempts", attempts: 3, results: []bool{false, false, false}, wantLocked: true},
+		{name: "success resets", attempts: 3, results: []bool{false, false, true, false, false}, wantLocked: false, wantFailures: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLockout(tt.attempts, time.Minute)
+
+			for _, ok := range tt.results {
+				if ok {
+					l.Success("1.2.3.4")
+				} else {
+					l.Failure("1.2.3.4")
+				}
+			}
+
+			if got := l.LockedOut("1.2.3.4"); got != tt.wantLocked {
+				t.Errorf("LockedOut() = %v, want %v", got, tt.wantLocked)
+			}
+			if l.LockedOut("5.6.7.8") {
+				t.Error("other IP address is locked out")
+			}
+
+			if tt.wantFailures > 0 {
+				if entry, ok := l.entries["1.2.3.4"]; !ok || entry.failures != tt.wantFailures {
+					t.Errorf("failures = %v, want %d", l.entries["1.2.3.4"], tt.wantFailures)
+				}
+			}
+		})
+	}
+}
+
+func TestLockoutExpires(t *testing.T) {
+	l := newLockout(1, time.Minute)
+
+	if !l.Failure("1.2.3.4") {
+		t.Fatal("Failure() = false, want lockout after one attempt")
+	}
+	if !l.LockedOut("1.2.3.4") {
+		t.Fatal("LockedOut() = false, want true")
+	}
+
+	l.entries["1.2.3.4"].lockedUntil = time.Now().Add(-time.Second)
+
+	if l.LockedOut("1.2.3.4") {
+		t.Error("LockedOut() = true after the lockout duration, want false")
+	}
+}
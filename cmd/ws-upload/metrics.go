@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	observationClockSkew = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "observation_clock_skew_seconds",
+		Help:      "Difference between the observation time sent by the station and the server time",
+		Namespace: "ws_upload",
+	}, []string{"station_id"})
+
+	uploadsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "uploads_rejected_total",
+		Help:      "Number of uploads rejected before processing, by reason",
+		Namespace: "ws_upload",
+	}, []string{"reason"})
+
+	stationLastSeen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "station_last_seen_timestamp_seconds",
+		Help:      "Unix time of the last upload of the station",
+		Namespace: "ws_upload",
+	}, []string{"station_id"})
+
+	stationOnline = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "station_online",
+		Help:      "Whether the station is online, which is the case until it has not uploaded for the offline duration",
+		Namespace: "ws_upload",
+	}, []string{"station_id"})
+
+	ipLockouts = promauto.NewCounter(prometheus.CounterOpts{
+		Name:      "lockouts_total",
+		Help:      "Number of times an IP address was locked out after too many bad passwords",
+		Namespace: "ws_upload",
+	})
+)
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/ws-upload/alert"
+	"github.com/koesie10/ws-upload/climate"
+	"github.com/koesie10/ws-upload/config"
+	"github.com/koesie10/ws-upload/influx"
+	"github.com/koesie10/ws-upload/jsondebug"
+	"github.com/koesie10/ws-upload/mqtt"
+	"github.com/koesie10/ws-upload/password"
+	"github.com/koesie10/ws-upload/wsupload"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+var (
+	// errInvalidObservation is returned for observations that should be rejected
+	errInvalidObservation = errors.New("invalid observation")
+	// errDiscardedObservation is returned for observations that are accepted but not published
+	errDiscardedObservation = errors.New("discarded observation")
+)
+
+// observationConfig contains the options for processing and publishing observations. Its flags are shared between
+// all commands that publish observations. It is only used if no config file is given.
+var observationConfig = struct {
+	StationTimezones map[string]string `env:"STATION_TIMEZONES" flag:"station-timezones" desc:"time zones of stations that upload local time, as station ID=IANA time zone pairs"`
+
+	ClockSkewPolicy string        `env:"CLOCK_SKEW_POLICY" flag:"clock-skew-policy" desc:"what to do with observations exceeding the maximum clock skew: trust-station, trust-server or reject"`
+	MaxClockSkew    time.Duration `env:"MAX_CLOCK_SKEW" flag:"max-clock-skew" desc:"maximum difference between the observation time and the server time, set to 0 to disable"`
+
+	Influx influx.PublisherOptions `env:",squash"`
+	MQTT   mqtt.PublisherOptions   `env:",squash"`
+
+	EnableJSONDebug   bool `env:"ENABLE_JSON_DEBUG" flag:"enable-json-debug" desc:"enable json debug output"`
+	EnableInfluxDebug bool `env:"ENABLE_INFLUX_DEBUG" flag:"enable-influx-debug" desc:"enable influx debug output"`
+
+	InfluxDebugFile influx.DebugFileOptions `env:",squash"`
+
+	Climate climate.Options `env:",squash"`
+}{
+	ClockSkewPolicy: string(wsupload.ClockSkewPolicyTrustStation),
+	MaxClockSkew:    5 * time.Minute,
+
+	Influx: influx.DefaultPublisherOptions(),
+	MQTT:   mqtt.DefaultPublisherOptions(),
+
+	Climate: climate.DefaultOptions(),
+}
+
+var observationFlags = newObservationFlags()
+
+func newObservationFlags() *pflag.FlagSet {
+	fset := pflag.NewFlagSet("observation", pflag.ContinueOnError)
+
+	if err := pflagenv.Setup(fset, &observationConfig); err != nil {
+		log.Fatal(err)
+	}
+
+	return fset
+}
+
+// loadConfig loads the config file if one is given, or creates the config from the flags and environment variables
+// otherwise. The station password is only used for the latter.
+func loadConfig(stationPassword string) (*config.Config, error) {
+	if rootConfig.ConfigFile != "" {
+		c, err := config.Load(rootConfig.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validatePublishers(c); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", rootConfig.ConfigFile, err)
+		}
+
+		return c, nil
+	}
+
+	c := &config.Config{
+		ClockSkewPolicy: observationConfig.ClockSkewPolicy,
+		MaxClockSkew:    observationConfig.MaxClockSkew,
+
+		Climate: observationConfig.Climate,
+
+		Stations: []config.Station{
+			{
+				ID:       config.AnyStation,
+				Password: stationPassword,
+			},
+		},
+	}
+
+	for stationID, timezone := range observationConfig.StationTimezones {
+		c.Stations = append(c.Stations, config.Station{
+			ID:       stationID,
+			Password: stationPassword,
+			Timezone: timezone,
+		})
+	}
+
+	if observationConfig.EnableJSONDebug {
+		c.Publishers = append(c.Publishers, config.Publisher{
+			Type: jsondebug.DebugPublisherType,
+		})
+	}
+	if observationConfig.Influx.Addr != "" {
+		c.Publishers = append(c.Publishers, config.Publisher{
+			Type:    influx.PublisherType,
+			Options: observationConfig.Influx,
+		})
+	}
+	if observationConfig.EnableInfluxDebug {
+		c.Publishers = append(c.Publishers, config.Publisher{
+			Type: influx.DebugPublisherType,
+			Options: influx.DebugPublisherOptions{
+				MeasurementName: observationConfig.Influx.MeasurementName,
+				Schema:          observationConfig.Influx.Schema,
+				File:            observationConfig.InfluxDebugFile,
+			},
+		})
+	}
+	if len(observationConfig.MQTT.Brokers) > 0 {
+		c.Publishers = append(c.Publishers, config.Publisher{
+			Type:    mqtt.PublisherType,
+			Options: observationConfig.MQTT,
+		})
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+type observationProcessor struct {
+	config *config.Config
+
+	clockSkewPolicy  wsupload.ClockSkewPolicy
+	stationLocations map[string]*time.Location
+	publishers       []wsupload.Publisher
+	// passwords caches the station passwords verified against hashes, it is shared with the replaced processors
+	passwords *password.Cache
+
+	// climate tracks the climate records, it is nil if they are disabled
+	climate *climate.Tracker
+	// alerts evaluates the alert rules, it is nil if there are none
+	alerts *alert.Engine
+
+	inflight sync.WaitGroup
+}
+
+// newObservationProcessor creates a processor. If it replaces a previous processor, it takes over the state of its
+// alerts, climate records and stateful publishers, so the state is not lost when the configuration is reloaded.
+// Observations of the previous processor are handled by the new processor afterwards, so it must be swapped in
+// immediately.
+func newObservationProcessor(c *config.Config, publishers []wsupload.Publisher, previous *observationProcessor) (*observationProcessor, error) {
+	clockSkewPolicy, err := wsupload.ParseClockSkewPolicy(c.ClockSkewPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	stationLocations := make(map[string]*time.Location, len(c.Stations))
+	for _, station := range c.Stations {
+		if station.Timezone == "" {
+			continue
+		}
+
+		location, err := time.LoadLocation(station.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone for station %s: %w", station.ID, err)
+		}
+
+		stationLocations[station.ID] = location
+	}
+
+	p := &observationProcessor{
+		config: c,
+
+		clockSkewPolicy:  clockSkewPolicy,
+		stationLocations: stationLocations,
+		publishers:       publishers,
+		passwords:        password.NewCache(),
+	}
+
+	if c.Climate.Enabled {
+		p.climate, err = climate.NewTracker(logger.With(zap.String("component", "climate")), c.Climate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.Alerts.Rules) > 0 {
+		p.alerts, err = alert.NewEngine(logger.With(zap.String("component", "alert")), c.Alerts, p.stationIDs())
+		if err != nil {
+			if p.climate != nil {
+				p.climate.Close()
+			}
+			return nil, fmt.Errorf("invalid alerts: %w", err)
+		}
+	}
+
+	if previous != nil {
+		p.takeState(previous)
+	}
+
+	return p, nil
+}
+
+// takeState moves the state of the previous processor to the processor.
+func (p *observationProcessor) takeState(previous *observationProcessor) {
+	// The cache is keyed by hash, so a changed password is verified again
+	p.passwords = previous.passwords
+
+	if p.climate != nil && previous.climate != nil {
+		p.climate.TakeState(previous.climate)
+	}
+
+	if p.alerts != nil && previous.alerts != nil {
+		p.alerts.TakeState(previous.alerts)
+	}
+
+	for i, publisher := range p.publishers {
+		statefulPublisher, ok := publisher.(wsupload.StatefulPublisher)
+		if !ok {
+			continue
+		}
+
+		for j, previousConfig := range previous.config.Publishers {
+			if previousConfig.Name == p.config.Publishers[i].Name && previousConfig.Type == p.config.Publishers[i].Type && j < len(previous.publishers) {
+				statefulPublisher.TakeState(previous.publishers[j])
+			}
+		}
+	}
+}
+
+// Authenticate returns whether the password is valid for the station.
+func (p *observationProcessor) Authenticate(stationID, stationPassword string) bool {
+	station := p.config.Station(stationID)
+
+	return station != nil && station.Password != "" && p.passwords.Verify(station.Password, stationPassword)
+}
+
+// stationLocation returns the location of the station if it has a time zone, or nil otherwise.
+func (p *observationProcessor) stationLocation(stationID string) *time.Location {
+	if location, ok := p.stationLocations[stationID]; ok {
+		return location
+	}
+
+	return p.stationLocations[config.AnyStation]
+}
+
+// Observe parses and validates an observation. The now time is used as the server time when checking the clock skew.
+func (p *observationProcessor) Observe(params url.Values, now time.Time, entry *zap.Logger) (*wsupload.Observation, error) {
+	parseOptions := wsupload.ParseOptions{
+		Location: p.stationLocation(params.Get("ID")),
+		Now:      now,
+	}
+
+	obs, err := wsupload.Parse(params, parseOptions, entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse observation: %w", err)
+	}
+
+	skew, err := wsupload.ApplyClockSkewPolicy(obs, now, p.config.MaxClockSkew, p.clockSkewPolicy)
+	observationClockSkew.WithLabelValues(obs.StationID).Set(skew.Seconds())
+	if err != nil {
+		entry.Error("Rejected observation", zap.Duration("ws_upload.clock_skew", skew), zap.Error(err))
+		return nil, fmt.Errorf("%w: %w", errInvalidObservation, err)
+	}
+
+	if !obs.IndoorTemperatureCelsius.Valid || obs.IndoorTemperatureCelsius.Float64 < -50 || obs.IndoorTemperatureCelsius.Float64 > 80 {
+		entry.Error("Invalid indoor temperature", zap.Bool("ws_upload.indoor_temperature_celsius_valid", obs.IndoorTemperatureCelsius.Valid), zap.Float64("ws_upload.indoor_temperature_celsius", obs.IndoorTemperatureCelsius.Float64))
+		return obs, fmt.Errorf("%w: invalid indoor temperature", errDiscardedObservation)
+	}
+
+	return obs, nil
+}
+
+// Process observes an observation and publishes it to all publishers.
+func (p *observationProcessor) Process(params url.Values, now time.Time, entry *zap.Logger) (*wsupload.Observation, error) {
+	// The station is still uploading if the observation is discarded or invalid, so the no-upload rules are resolved
+	if p.alerts != nil {
+		p.alerts.Seen(params.Get("ID"), now)
+	}
+
+	obs, err := p.Observe(params, now, entry)
+	if err != nil {
+		return obs, err
+	}
+
+	for _, publisher := range p.publishers {
+		if err := publisher.Publish(obs); err != nil {
+			entry.Error("Failed to publish observation", zap.Error(err))
+		}
+	}
+
+	p.updateClimate(obs, entry)
+
+	if p.alerts != nil {
+		p.alerts.Observe(obs, now)
+	}
+
+	return obs, nil
+}
+
+// updateClimate updates the climate records with the observation and publishes them to the publishers that support
+// it.
+func (p *observationProcessor) updateClimate(obs *wsupload.Observation, entry *zap.Logger) {
+	if p.climate == nil {
+		return
+	}
+
+	location := p.stationLocation(obs.StationID)
+	if location == nil {
+		location = time.UTC
+	}
+
+	station := p.climate.Update(obs, location)
+	if station == nil {
+		return
+	}
+
+	summary := station.Summary()
+	for _, publisher := range p.publishers {
+		if climatePublisher, ok := publisher.(climate.Publisher); ok {
+			if err := climatePublisher.PublishClimate(summary); err != nil {
+				entry.Error("Failed to publish climate records", zap.Error(err))
+			}
+		}
+	}
+}
+
+// PublishAvailability publishes whether the station is online to the publishers that support it.
+func (p *observationProcessor) PublishAvailability(stationID string, online bool) {
+	for i, publisher := range p.publishers {
+		if availabilityPublisher, ok := publisher.(wsupload.AvailabilityPublisher); ok {
+			if err := availabilityPublisher.PublishAvailability(stationID, online); err != nil {
+				logger.Error("Failed to publish station availability", zap.String("ws_upload.station_id", stationID), zap.String("publisher.name", p.config.Publishers[i].Name), zap.Error(err))
+			}
+		}
+	}
+}
+
+// stationIDs returns the IDs of the configured stations, excluding AnyStation.
+func (p *observationProcessor) stationIDs() []string {
+	stationIDs := make([]string, 0, len(p.config.Stations))
+	for _, station := range p.config.Stations {
+		if station.ID != config.AnyStation {
+			stationIDs = append(stationIDs, station.ID)
+		}
+	}
+
+	return stationIDs
+}
+
+func (p *observationProcessor) Close() error {
+	closePublishers(p.publishers)
+
+	if p.alerts != nil {
+		if err := p.alerts.Close(); err != nil {
+			logger.Error("Failed to close alerts", zap.Error(err))
+		}
+	}
+
+	if p.climate != nil {
+		if err := p.climate.Close(); err != nil {
+			logger.Error("Failed to close climate records", zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+func closePublishers(publishers []wsupload.Publisher) {
+	for _, publisher := range publishers {
+		if err := publisher.Close(); err != nil {
+			logger.Error("Failed to close publisher", zap.Error(err))
+		}
+	}
+}
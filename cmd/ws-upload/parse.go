@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/koesie10/ws-upload/config"
+	"github.com/koesie10/ws-upload/influx"
+	"github.com/koesie10/ws-upload/mqtt"
+	"github.com/koesie10/ws-upload/wsupload"
+	"github.com/spf13/cobra"
+)
+
+var parseCmd = &cobra.Command{
+	Use:   "parse [query string or URL...]",
+	Short: "Parse station uploads and print the messages that would be published",
+	Long: `Parse station uploads and print the resulting observation as JSON, InfluxDB line protocol and MQTT messages
+without connecting to anything. If no arguments are given, each line of stdin is parsed as an upload.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return parseFlags(&observationConfig)
+	},
+	RunE: RunParse,
+}
+
+func RunParse(cmd *cobra.Command, args []string) error {
+	c, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	processor, err := newObservationProcessor(c, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer processor.Close()
+
+	out := cmd.OutOrStdout()
+
+	for _, publisherConfig := range c.Publishers {
+		if publisherConfig.Type != mqtt.PublisherType {
+			continue
+		}
+
+		_, options, err := config.DecodePublisherOptions(publisherConfig)
+		if err != nil {
+			return err
+		}
+
+		mqttOptions := options.(*mqtt.PublisherOptions)
+		if !mqttOptions.HomeAssistant.DiscoveryEnabled {
+			continue
+		}
+
+		messages, err := mqtt.DiscoveryMessages(*mqttOptions)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "# MQTT discovery (%s)\n", publisherConfig.Name)
+		for _, message := range messages {
+			printMessage(out, message)
+		}
+		fmt.Fprintln(out)
+	}
+
+	if len(args) > 0 {
+		for _, arg := range args {
+			if err := parseUpload(out, c, processor, arg); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	scanner := bufio.NewScanner(cmd.InOrStdin())
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if err := parseUpload(out, c, processor, line); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func parseUpload(out io.Writer, c *config.Config, processor *observationProcessor, upload string) error {
+	query := upload
+	if i := strings.IndexByte(upload, '?'); i >= 0 {
+		query = upload[i+1:]
+	}
+
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return fmt.Errorf("failed to parse query %q: %w", upload, err)
+	}
+
+	obs, err := processor.Observe(params, time.Now(), logger)
+	if errors.Is(err, errDiscardedObservation) {
+		fmt.Fprintf(out, "# Observation would be discarded: %v\n", err)
+	} else if err != nil {
+		fmt.Fprintf(out, "# Observation would be rejected: %v\n\n", err)
+		return nil
+	}
+
+	data, err := json.MarshalIndent(obs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal observation to JSON: %w", err)
+	}
+
+	fmt.Fprintln(out, "# Observation")
+	fmt.Fprintln(out, string(data))
+	fmt.Fprintln(out)
+
+	for _, publisherConfig := range c.Publishers {
+		_, options, err := config.DecodePublisherOptions(publisherConfig)
+		if err != nil {
+			return err
+		}
+
+		switch o := options.(type) {
+		case *influx.PublisherOptions:
+			if err := printPoint(out, publisherConfig.Name, obs, o.MeasurementName, o.Schema, time.Second); err != nil {
+				return err
+			}
+		case *influx.DebugPublisherOptions:
+			if err := printPoint(out, publisherConfig.Name, obs, o.MeasurementName, o.Schema, time.Millisecond); err != nil {
+				return err
+			}
+		case *influx.V1PublisherOptions:
+			if err := printPoint(out, publisherConfig.Name, obs, o.MeasurementName, o.Schema, time.Second); err != nil {
+				return err
+			}
+		case *influx.UDPPublisherOptions:
+			if err := printPoint(out, publisherConfig.Name, obs, o.MeasurementName, o.Schema, time.Nanosecond); err != nil {
+				return err
+			}
+		case *influx.TCPPublisherOptions:
+			if err := printPoint(out, publisherConfig.Name, obs, o.MeasurementName, o.Schema, time.Nanosecond); err != nil {
+				return err
+			}
+		case *mqtt.PublisherOptions:
+			message, err := mqtt.StateMessage(*o, obs)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(out, "# MQTT state (%s)\n", publisherConfig.Name)
+			printMessage(out, message)
+			fmt.Fprintln(out)
+		}
+	}
+
+	return nil
+}
+
+func printPoint(out io.Writer, name string, obs *wsupload.Observation, measurementName string, schemaOptions influx.SchemaOptions, precision time.Duration) error {
+	schema, err := influx.NewSchema(measurementName, schemaOptions)
+	if err != nil {
+		return fmt.Errorf("invalid schema for publisher %s: %w", name, err)
+	}
+
+	line, err := schema.LineProtocol(obs, precision)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "# InfluxDB line protocol (%s)\n", name)
+	fmt.Fprintf(out, "%s\n", line)
+
+	return nil
+}
+
+func printMessage(out io.Writer, message mqtt.Message) {
+	fmt.Fprintf(out, "%s (qos=%d, retained=%t): %s\n", message.Topic, message.QoS, message.Retained, message.Payload)
+}
+
+func init() {
+	rootCmd.AddCommand(parseCmd)
+
+	parseCmd.Flags().AddFlagSet(observationFlags)
+}
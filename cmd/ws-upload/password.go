@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/ws-upload/password"
+	"github.com/labstack/echo/v4"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+var hashPasswordConfig = struct {
+	Algorithm  string `env:"HASH_PASSWORD_ALGORITHM" flag:"algorithm" desc:"hash algorithm, bcrypt or argon2id"`
+	BcryptCost int    `env:"HASH_PASSWORD_BCRYPT_COST" flag:"bcrypt-cost" desc:"bcrypt cost, set to 0 for the default cost"`
+}{
+	Algorithm: password.AlgorithmBcrypt,
+}
+
+var hashPasswordCmd = &cobra.Command{
+	Use:   "hash-password [password]",
+	Short: "Hash a station password for use in the config",
+	Long:  "Hash a station password for use as --station-password or as the password of a station in the config file. If no password is given, it is read from stdin, which keeps it out of the shell history.",
+	Args:  cobra.MaximumNArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return parseFlags(&hashPasswordConfig)
+	},
+	RunE: RunHashPassword,
+}
+
+func RunHashPassword(cmd *cobra.Command, args []string) error {
+	var stationPassword string
+	if len(args) > 0 {
+		stationPassword = args[0]
+	} else {
+		if isatty.IsTerminal(os.Stdin.Fd()) {
+			fmt.Fprint(os.Stderr, "Password: ")
+		}
+
+		line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		stationPassword = strings.TrimRight(line, "\r\n")
+	}
+
+	if stationPassword == "" {
+		return errors.New("password must not be empty")
+	}
+
+	hash, err := password.Hash(stationPassword, hashPasswordConfig.Algorithm, hashPasswordConfig.BcryptCost)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), hash)
+
+	return nil
+}
+
+// redactRequestURIMiddleware redacts station passwords from the request URI, which is only used for logging. The
+// query parameters are parsed from the request URL, which is left intact.
+func redactRequestURIMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Request().RequestURI = password.RedactRequestURI(c.Request().RequestURI)
+
+		return next(c)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(hashPasswordCmd)
+
+	if err := pflagenv.Setup(hashPasswordCmd.Flags(), &hashPasswordConfig); err != nil {
+		log.Fatal(err)
+	}
+}
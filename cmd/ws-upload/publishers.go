@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/koesie10/ws-upload/config"
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+
+	// Register all publisher types
+	_ "github.com/koesie10/ws-upload/aggregate"
+	_ "github.com/koesie10/ws-upload/influx"
+	_ "github.com/koesie10/ws-upload/jsondebug"
+	_ "github.com/koesie10/ws-upload/mqtt"
+)
+
+func validatePublishers(c *config.Config) error {
+	for _, publisherConfig := range c.Publishers {
+		if _, _, err := config.DecodePublisherOptions(publisherConfig); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createPublishers(c *config.Config) (publishers []wsupload.Publisher, err error) {
+	defer func() {
+		if err != nil {
+			closePublishers(publishers)
+		}
+	}()
+
+	for _, publisherConfig := range c.Publishers {
+		factory, options, err := config.DecodePublisherOptions(publisherConfig)
+		if err != nil {
+			return publishers, err
+		}
+
+		entry := logger.With(zap.String("publisher.name", publisherConfig.Name), zap.String("publisher.type", publisherConfig.Type))
+
+		publisher, err := factory.New(entry, options)
+		if err != nil {
+			return publishers, fmt.Errorf("failed to create publisher %s: %w", publisherConfig.Name, err)
+		}
+		publishers = append(publishers, publisher)
+
+		entry.Info("Publisher enabled")
+	}
+
+	return publishers, nil
+}
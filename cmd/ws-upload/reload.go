@@ -0,0 +1,133 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// errShuttingDown is returned when acquiring the processor after the holder has been closed
+var errShuttingDown = echo.NewHTTPError(http.StatusServiceUnavailable, "Server is shutting down")
+
+// processorHolder holds the current processor, which is replaced when the configuration is reloaded. A replaced
+// processor is closed once all uploads that are using it have finished.
+type processorHolder struct {
+	mu        sync.RWMutex
+	processor *observationProcessor
+
+	// closing tracks replaced processors that have not been closed yet
+	closing sync.WaitGroup
+}
+
+// Acquire returns the current processor. The returned function must be called once the processor is no longer used.
+// It returns errShuttingDown if the holder has been closed.
+func (h *processorHolder) Acquire() (*observationProcessor, func(), error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	p := h.processor
+	if p == nil {
+		return nil, nil, errShuttingDown
+	}
+	p.inflight.Add(1)
+
+	return p, p.inflight.Done, nil
+}
+
+func (h *processorHolder) Swap(processor *observationProcessor) {
+	h.mu.Lock()
+	old := h.processor
+	h.processor = processor
+	h.mu.Unlock()
+
+	if old != nil {
+		h.closing.Add(1)
+		go func() {
+			defer h.closing.Done()
+
+			old.inflight.Wait()
+			old.Close()
+		}()
+	}
+}
+
+// Close waits for all uploads to finish and closes the current processor and any replaced processors.
+func (h *processorHolder) Close() error {
+	h.mu.Lock()
+	p := h.processor
+	h.processor = nil
+	h.mu.Unlock()
+
+	h.closing.Wait()
+
+	if p == nil {
+		return nil
+	}
+
+	p.inflight.Wait()
+
+	return p.Close()
+}
+
+// watchConfig calls reload when the process receives SIGHUP or when the config file changes. Changes are debounced
+// since editors often write a file in multiple steps.
+func watchConfig(path string, reload func(), done <-chan struct{}) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	// Watch the directory instead of the file, so the watch survives editors replacing the file
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer watcher.Close()
+		defer signal.Stop(signals)
+
+		var debounce <-chan time.Time
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				logger.Info("Received SIGHUP, reloading config")
+				reload()
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != filepath.Clean(path) || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					continue
+				}
+
+				debounce = time.After(500 * time.Millisecond)
+			case <-debounce:
+				logger.Info("Config file changed, reloading config", zap.String("ws_upload.config_file", path))
+				reload()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				logger.Warn("Failed to watch config file", zap.Error(err))
+			}
+		}
+	}()
+
+	return nil
+}
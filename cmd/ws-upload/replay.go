@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/ws-upload/capture"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var replayConfig = struct {
+	OriginalPace bool `env:"REPLAY_ORIGINAL_PACE" flag:"original-pace" desc:"replay the uploads at the pace they were captured at instead of as fast as possible"`
+}{}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay <capture file>",
+	Short: "Replay captured station uploads through the parser and publishers",
+	Args:  cobra.ExactArgs(1),
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return parseFlags(&replayConfig, &observationConfig)
+	},
+	RunE: RunReplay,
+}
+
+func RunReplay(cmd *cobra.Command, args []string) error {
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c, err := loadConfig("")
+	if err != nil {
+		return err
+	}
+
+	publishers, err := createPublishers(c)
+	if err != nil {
+		return err
+	}
+
+	processor, err := newObservationProcessor(c, publishers, nil)
+	if err != nil {
+		closePublishers(publishers)
+		return err
+	}
+	defer processor.Close()
+
+	count, err := replay(processor, capture.NewReader(f), replayConfig.OriginalPace, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	logger.Info(fmt.Sprintf("Replayed %d observations", count))
+
+	return nil
+}
+
+// replay processes the captured uploads of the reader that were received at or after since, or all uploads if since is
+// zero, and returns the number of uploads that were processed successfully. Uploads that cannot be processed are logged
+// and skipped.
+func replay(processor *observationProcessor, reader *capture.Reader, originalPace bool, since time.Time) (int, error) {
+	var count int
+	var previous time.Time
+
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if record.Time.Before(since) {
+			continue
+		}
+
+		if originalPace && !previous.IsZero() && record.Time.After(previous) {
+			time.Sleep(record.Time.Sub(previous))
+		}
+		previous = record.Time
+
+		entry := logger.With(
+			zap.String("http.method", record.Method),
+			zap.String("http.path", record.Path),
+			zap.Time("replay.time", record.Time),
+		)
+
+		params, err := record.Params()
+		if err != nil {
+			entry.Error("Failed to read captured request", zap.Error(err))
+			continue
+		}
+
+		if _, err := processor.Process(params, record.Time, entry); err != nil {
+			entry.Error("Failed to process observation", zap.Error(err))
+			continue
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+
+	if err := pflagenv.Setup(replayCmd.Flags(), &replayConfig); err != nil {
+		log.Fatal(err)
+	}
+	replayCmd.Flags().AddFlagSet(observationFlags)
+}
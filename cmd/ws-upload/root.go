@@ -2,7 +2,9 @@ package main
 
 import (
 	"fmt"
+	"log"
 
+	"github.com/koesie10/pflagenv"
 	"github.com/koesie10/ws-upload/version"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -10,6 +12,10 @@ import (
 
 var logger, _ = zap.NewDevelopment()
 
+var rootConfig = struct {
+	ConfigFile string `env:"CONFIG_FILE" flag:"config" desc:"YAML or TOML config file with stations and publishers, replaces the station and publisher flags"`
+}{}
+
 var rootCmd = &cobra.Command{
 	Use: "ws-upload",
 	Version: fmt.Sprintf("%s (%s at %s)",
@@ -18,3 +24,24 @@ var rootCmd = &cobra.Command{
 		version.BuildDate,
 	),
 }
+
+// parseFlags parses the root flags and the given configs from the flags and environment variables.
+func parseFlags(configs ...interface{}) error {
+	if err := pflagenv.Parse(&rootConfig); err != nil {
+		return err
+	}
+
+	for _, c := range configs {
+		if err := pflagenv.Parse(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	if err := pflagenv.Setup(rootCmd.PersistentFlags(), &rootConfig); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,22 +1,27 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/brpaz/echozap"
 	"github.com/koesie10/pflagenv"
-	"github.com/koesie10/ws-upload/influx"
-	"github.com/koesie10/ws-upload/jsondebug"
-	"github.com/koesie10/ws-upload/mqtt"
-	"github.com/koesie10/ws-upload/wsupload"
+	"github.com/koesie10/ws-upload/capture"
+	"github.com/koesie10/ws-upload/password"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/mattn/go-isatty"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
@@ -25,126 +30,208 @@ import (
 )
 
 var serverConfig = struct {
-	Addr string `env:"ADDR" flag:"addr" desc:"the address for the HTTP server to listen on"`
+	Addr string `env:"ADDR" flag:"addr" desc:"the address for the HTTP server to listen on, leave empty to disable"`
 
-	StationPassword string `env:"STATION_PASSWORD" flag:"station-password,p" desc:"the station password that will be accepted"`
+	TLSAddr         string `env:"TLS_ADDR" flag:"tls-addr" desc:"the address for the HTTPS server to listen on, leave empty to disable"`
+	TLSCertFile     string `env:"TLS_CERT_FILE" flag:"tls-cert-file" desc:"TLS certificate file, reloaded automatically when it changes"`
+	TLSKeyFile      string `env:"TLS_KEY_FILE" flag:"tls-key-file" desc:"TLS key file, reloaded automatically when it changes"`
+	TLSClientCAFile string `env:"TLS_CLIENT_CA_FILE" flag:"tls-client-ca-file" desc:"CA certificates for client certificates, if set the API and admin routes require a client certificate over HTTPS"`
 
-	Influx influx.PublisherOptions `env:",squash"`
-	MQTT   mqtt.PublisherOptions   `env:",squash"`
+	StationPassword string `env:"STATION_PASSWORD" flag:"station-password,p" desc:"the station password that will be accepted, either in plaintext or as a bcrypt or argon2id hash created with the hash-password command"`
 
-	EnableJSONDebug   bool `env:"ENABLE_JSON_DEBUG" flag:"enable-json-debug" desc:"enable json debug output"`
-	EnableInfluxDebug bool `env:"ENABLE_INFLUX_DEBUG" flag:"enable-influx-debug" desc:"enable influx debug output"`
+	CaptureFile string `env:"CAPTURE_FILE" flag:"capture-file" desc:"append all raw station uploads to this file as NDJSON, leave empty to disable"`
+
+	StationOfflineAfter time.Duration `env:"STATION_OFFLINE_AFTER" flag:"station-offline-after" desc:"time without uploads after which a station is considered offline, set to 0 to disable"`
+
+	AdminToken string `env:"ADMIN_TOKEN" flag:"admin-token" desc:"bearer token for the admin API, either in plaintext or as a bcrypt or argon2id hash, leave empty to disable the admin API"`
+
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" desc:"maximum time to wait for in-flight requests when shutting down"`
 }{
 	Addr: ":9108",
 
-	Influx: influx.PublisherOptions{
-		Addr:            "http://localhost:8086",
-		Bucket:          "weather",
-		MeasurementName: "weather",
-	},
+	StationOfflineAfter: 10 * time.Minute,
 
-	MQTT: mqtt.PublisherOptions{
-		Brokers: []string{"tcp://127.0.0.1:1883"},
-		Topic:   "homeassistant/sensor/sensorWeatherStation/state",
-		HomeAssistant: mqtt.HomeAssistantOptions{
-			DiscoveryEnabled:  true,
-			DiscoveryInterval: 30 * time.Second,
-			DiscoveryQoS:      1, // At least once
-			DiscoveryPrefix:   "homeassistant",
-			DevicePrefix:      "weatherstation_",
-		},
-	},
+	ShutdownTimeout: 30 * time.Second,
 }
 
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start the ws-upload server",
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-		if err := pflagenv.Parse(&serverConfig); err != nil {
-			return err
-		}
-
-		return nil
+		return parseFlags(&serverConfig, &limitConfig, &observationConfig)
 	},
 	RunE: RunServer,
 }
 
 func RunServer(cmd *cobra.Command, args []string) error {
-	if serverConfig.StationPassword == "" {
+	if serverConfig.Addr == "" && serverConfig.TLSAddr == "" {
+		return errors.New("at least one of --addr and --tls-addr must be set")
+	}
+	if serverConfig.TLSAddr != "" && (serverConfig.TLSCertFile == "" || serverConfig.TLSKeyFile == "") {
+		return errors.New("--tls-cert-file and --tls-key-file are required when --tls-addr is set")
+	}
+	if serverConfig.TLSClientCAFile != "" && serverConfig.TLSAddr == "" {
+		return errors.New("--tls-client-ca-file requires --tls-addr to be set")
+	}
+
+	if err := password.Validate(serverConfig.AdminToken); err != nil {
+		return fmt.Errorf("invalid admin token: %w", err)
+	}
+
+	// Stations in a config file have their own passwords
+	if serverConfig.StationPassword == "" && rootConfig.ConfigFile == "" {
 		key := make([]byte, 8)
 		if _, err := rand.Read(key); err != nil {
 			return err
 		}
 
 		serverConfig.StationPassword = hex.EncodeToString(key)
-		logger.Info("Station password has been generated automatically, please set it using the STATION_PASSWORD environment variable or the --station-password/-p flag", zap.String("ws_upload.station_password", serverConfig.StationPassword))
-	}
 
-	var publishers []wsupload.Publisher
+		// The password is never logged, so it only ends up on an interactive terminal
+		if isatty.IsTerminal(os.Stderr.Fd()) {
+			fmt.Fprintf(os.Stderr, "Generated station password: %s\n", serverConfig.StationPassword)
+			logger.Warn("Station password has been generated automatically, please set it using the STATION_PASSWORD environment variable or the --station-password/-p flag")
+		} else {
+			logger.Warn("Station password has been generated automatically and is not shown since it would be logged, all uploads will be rejected until it is set using the STATION_PASSWORD environment variable or the --station-password/-p flag")
+		}
+	}
 
-	if serverConfig.EnableJSONDebug {
-		publisher, err := jsondebug.NewDebugPublisher()
+	// createProcessor creates a processor from the current config, which takes over the state of the previous
+	// processor if it is not nil
+	createProcessor := func(previous *observationProcessor) (*observationProcessor, error) {
+		c, err := loadConfig(serverConfig.StationPassword)
 		if err != nil {
-			return fmt.Errorf("failed to create JSON debug publisher: %w", err)
+			return nil, err
 		}
-		defer publisher.Close()
-		publishers = append(publishers, publisher)
 
-		logger.Info("JSON debug publisher enabled")
-	}
+		if err := c.ValidatePasswords(); err != nil {
+			return nil, err
+		}
 
-	if serverConfig.Influx.Addr != "" {
-		publisher, err := influx.NewPublisher(serverConfig.Influx)
+		publishers, err := createPublishers(c)
 		if err != nil {
-			return fmt.Errorf("failed to create Influx publisher: %w", err)
+			return nil, err
 		}
-		defer publisher.Close()
-		publishers = append(publishers, publisher)
 
-		logger.Info("Influx publisher enabled")
+		processor, err := newObservationProcessor(c, publishers, previous)
+		if err != nil {
+			closePublishers(publishers)
+			return nil, err
+		}
+
+		return processor, nil
 	}
 
-	if serverConfig.EnableInfluxDebug {
-		publisher, err := influx.NewDebugPublisher(influx.DebugPublisherOptions{
-			MeasurementName: "weather",
-		})
+	processor, err := createProcessor(nil)
+	if err != nil {
+		return err
+	}
+
+	processors := &processorHolder{}
+	processors.Swap(processor)
+	defer processors.Close()
+
+	stations := newStationTracker(serverConfig.StationOfflineAfter, func(stationID string, online bool) {
+		processor, release, err := processors.Acquire()
 		if err != nil {
-			return fmt.Errorf("failed to create Influx debug publisher: %w", err)
+			return
 		}
-		defer publisher.Close()
-		publishers = append(publishers, publisher)
+		defer release()
 
-		logger.Info("Influx debug publisher enabled")
-	}
+		processor.PublishAvailability(stationID, online)
+	})
+	defer stations.Close()
+	stations.Track(processor.stationIDs(), time.Now())
+	// The sensors are unavailable until the availability is published, which would otherwise only happen on the first
+	// upload
+	stations.Republish()
+
+	// reloadMu prevents concurrent reloads from taking over the state of the same processor
+	var reloadMu sync.Mutex
+	reload := func() error {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+
+		previous, release, err := processors.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
 
-	if len(serverConfig.MQTT.Brokers) > 0 {
-		publisher, err := mqtt.NewPublisher(logger, serverConfig.MQTT)
+		processor, err := createProcessor(previous)
 		if err != nil {
-			return fmt.Errorf("failed to create MQTT publisher: %w", err)
+			return err
 		}
-		defer publisher.Close()
-		publishers = append(publishers, publisher)
 
-		logger.Info("MQTT publisher enabled")
+		processors.Swap(processor)
+		stations.Track(processor.stationIDs(), time.Now())
+
+		// The new publishers do not know which stations are online
+		stations.Republish()
+
+		return nil
 	}
 
-	l, err := net.Listen("tcp", serverConfig.Addr)
-	if err != nil {
-		return err
+	if rootConfig.ConfigFile != "" {
+		done := make(chan struct{})
+		defer close(done)
+
+		watchReload := func() {
+			if err := reload(); err != nil {
+				logger.Error("Failed to reload config, keeping the current config", zap.Error(err))
+				return
+			}
+
+			logger.Info("Reloaded config")
+		}
+
+		if err := watchConfig(rootConfig.ConfigFile, watchReload, done); err != nil {
+			return fmt.Errorf("failed to watch config file: %w", err)
+		}
 	}
 
 	e := echo.New()
 	e.HideBanner = true
 	e.HidePort = true
+	e.Pre(redactRequestURIMiddleware)
 	e.Use(middleware.Recover())
 	e.Use(echozap.ZapLogger(logger.With(zap.String("component", "echo"))))
 	e.Use(middleware.RequestID())
-	e.Listener = l
+
+	e.IPExtractor, err = newIPExtractor(limitConfig.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
 
 	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 	e.GET("/health", func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
+	e.GET("/health/ready", readinessHandler(processors))
+
+	ipFilter, err := ipFilterMiddleware(limitConfig.AllowCIDRs, limitConfig.DenyCIDRs)
+	if err != nil {
+		return err
+	}
+
+	ipLimiter := newKeyedLimiter(limitConfig.IPRateLimit, limitConfig.IPRateBurst)
+	stationLimiter := newKeyedLimiter(limitConfig.StationRateLimit, limitConfig.StationRateBurst)
+	passwordLockout := newLockout(limitConfig.LockoutAttempts, limitConfig.LockoutDuration)
+
+	observeMiddleware := []echo.MiddlewareFunc{
+		ipFilter,
+		ipRateLimitMiddleware(ipLimiter),
+	}
+	var captureWriter *capture.Writer
+	if serverConfig.CaptureFile != "" {
+		captureWriter, err = capture.NewWriter(serverConfig.CaptureFile)
+		if err != nil {
+			return err
+		}
+		defer captureWriter.Close()
+
+		logger.Info("Capturing station uploads", zap.String("ws_upload.capture_file", serverConfig.CaptureFile))
+	}
 
 	observeHandler := func(c echo.Context) error {
 		entry := logger.With(
@@ -155,52 +242,193 @@ func RunServer(cmd *cobra.Command, args []string) error {
 			zap.String("http.request_id", c.Response().Header().Get(echo.HeaderXRequestID)),
 		)
 
-		if c.QueryParam("PASSWORD") != serverConfig.StationPassword {
-			return c.String(http.StatusUnauthorized, "Bad password")
+		processor, release, err := processors.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		if ok, err := passwordLockout.Authenticate(c, func() bool {
+			return processor.Authenticate(c.QueryParam("ID"), c.QueryParam("PASSWORD"))
+		}); !ok {
+			return err
+		}
+
+		if captureWriter != nil {
+			if err := captureRequest(captureWriter, c); err != nil {
+				return err
+			}
+		}
+
+		if !stationLimiter.Allow(c.QueryParam("ID")) {
+			uploadsRejected.WithLabelValues("station_rate_limited").Inc()
+			entry.Debug("Rate limited upload", zap.String("ws_upload.station_id", c.QueryParam("ID")))
+
+			return c.String(http.StatusTooManyRequests, "Too many requests")
 		}
 
 		if c.QueryParam("action") != "updateraw" && c.QueryParam("action") != "updateraww" {
 			return c.String(http.StatusBadRequest, "Invalid action")
 		}
 
-		obs, err := wsupload.Parse(c.QueryParams(), logger)
+		// The station is online even if the observation is invalid, since it is still uploading
+		stations.Seen(c.QueryParam("ID"), time.Now())
+
+		if _, err := processor.Process(c.QueryParams(), time.Now(), entry); err != nil {
+			if errors.Is(err, errDiscardedObservation) {
+				return c.String(http.StatusOK, "OK")
+			}
+			if errors.Is(err, errInvalidObservation) {
+				return c.String(http.StatusBadRequest, "Invalid observation")
+			}
+
+			entry.Error("Failed to process observation", zap.Error(err))
+			return err
+		}
+
+		return c.String(http.StatusOK, "OK")
+	}
+
+	e.GET("/api/v1/observe", observeHandler, observeMiddleware...)
+	e.GET("/weatherstation/updateweatherstation.php", observeHandler, observeMiddleware...)
+
+	// The console cannot use HTTPS, so only the upload routes are exempt from client certificate authentication
+	var apiMiddleware []echo.MiddlewareFunc
+	if serverConfig.TLSClientCAFile != "" {
+		apiMiddleware = append(apiMiddleware, requireClientCertificate)
+	}
+
+	e.GET("/api/v1/climate/:station", func(c echo.Context) error {
+		processor, release, err := processors.Acquire()
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		if ok, err := passwordLockout.Authenticate(c, func() bool {
+			return processor.Authenticate(c.Param("station"), c.QueryParam("password"))
+		}); !ok {
+			return err
+		}
+
+		if processor.climate == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "Climate records are not enabled")
+		}
+
+		station := processor.climate.Station(c.Param("station"))
+		if station == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "No climate records for station")
+		}
+
+		return c.JSON(http.StatusOK, station)
+	}, apiMiddleware...)
+
+	e.GET("/api/v1/stations/:station", func(c echo.Context) error {
+		processor, release, err := processors.Acquire()
 		if err != nil {
-			entry.Error("Failed to parse observation", zap.Error(err))
 			return err
 		}
+		defer release()
 
-		if !obs.IndoorTemperatureCelsius.Valid || obs.IndoorTemperatureCelsius.Float64 < -50 || obs.IndoorTemperatureCelsius.Float64 > 80 {
-			entry.Error("Invalid indoor temperature", zap.Bool("ws_upload.indoor_temperature_celsius_valid", obs.IndoorTemperatureCelsius.Valid), zap.Float64("ws_upload.indoor_temperature_celsius", obs.IndoorTemperatureCelsius.Float64))
-			return c.String(http.StatusOK, "OK")
+		if ok, err := passwordLockout.Authenticate(c, func() bool {
+			return processor.Authenticate(c.Param("station"), c.QueryParam("password"))
+		}); !ok {
+			return err
 		}
 
-		for _, publisher := range publishers {
-			if err := publisher.Publish(obs); err != nil {
-				entry.Error("Failed to publish observation", zap.Error(err))
-			}
+		status, ok := stations.Status(c.Param("station"))
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "Station has not uploaded since the server started")
 		}
 
-		return c.String(http.StatusOK, "OK")
+		return c.JSON(http.StatusOK, status)
+	}, apiMiddleware...)
+
+	if serverConfig.AdminToken != "" {
+		adminMiddleware := append(append([]echo.MiddlewareFunc{}, apiMiddleware...), adminAuthMiddleware(serverConfig.AdminToken, passwordLockout))
+
+		registerAdminRoutes(e.Group("/api/v1/admin", adminMiddleware...), processors, stations, reload, serverConfig.CaptureFile)
 	}
 
-	e.GET("/api/v1/observe", observeHandler)
-	e.GET("/weatherstation/updateweatherstation.php", observeHandler)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	e.POST("/api/v1/mqtt/homeassistant/delete-all-devices", func(c echo.Context) error {
-		if c.QueryParam("password") != serverConfig.StationPassword {
-			return c.String(http.StatusUnauthorized, "Bad password")
+	errCh := make(chan error, 2)
+
+	if serverConfig.Addr != "" {
+		l, err := net.Listen("tcp", serverConfig.Addr)
+		if err != nil {
+			return err
 		}
+		e.Listener = l
 
-		if err := mqtt.DeleteAllDevices(serverConfig.MQTT); err != nil {
+		logger.Info("Starting HTTP server", zap.String("net.addr", serverConfig.Addr))
+
+		go func() {
+			errCh <- e.Start(serverConfig.Addr)
+		}()
+	}
+
+	var tlsServer *http.Server
+	if serverConfig.TLSAddr != "" {
+		tlsConfig, err := newTLSConfig(serverConfig.TLSCertFile, serverConfig.TLSKeyFile, serverConfig.TLSClientCAFile)
+		if err != nil {
 			return err
 		}
 
-		return c.String(http.StatusOK, "OK")
-	})
+		l, err := net.Listen("tcp", serverConfig.TLSAddr)
+		if err != nil {
+			return err
+		}
+
+		tlsServer = &http.Server{
+			Handler:   e,
+			TLSConfig: tlsConfig,
+		}
+
+		logger.Info("Starting HTTPS server", zap.String("net.addr", serverConfig.TLSAddr), zap.Bool("tls.client_auth", serverConfig.TLSClientCAFile != ""))
 
-	logger.Info("Starting HTTP server", zap.String("net.addr", serverConfig.Addr))
+		go func() {
+			errCh <- tlsServer.ServeTLS(l, "", "")
+		}()
+	}
 
-	return e.Start(serverConfig.Addr)
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	// A second signal will terminate the process immediately
+	stop()
+
+	logger.Info("Shutting down HTTP server", zap.Duration("ws_upload.shutdown_timeout", serverConfig.ShutdownTimeout))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), serverConfig.ShutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("Failed to shut down HTTP server gracefully", zap.Error(err))
+	}
+	if tlsServer != nil {
+		if err := tlsServer.Shutdown(shutdownCtx); err != nil {
+			logger.Warn("Failed to shut down HTTPS server gracefully", zap.Error(err))
+		}
+	}
+
+	// The HTTP server no longer accepts uploads, so all publishers can be drained
+	logger.Info("Draining publishers")
+
+	// No availability must be published once the publishers are closed
+	stations.Close()
+
+	if err := processors.Close(); err != nil {
+		return fmt.Errorf("failed to close publishers: %w", err)
+	}
+
+	logger.Info("Shutdown complete")
+
+	return nil
 }
 
 func init() {
@@ -209,4 +437,8 @@ func init() {
 	if err := pflagenv.Setup(serverCmd.Flags(), &serverConfig); err != nil {
 		log.Fatal(err)
 	}
+	if err := pflagenv.Setup(serverCmd.Flags(), &limitConfig); err != nil {
+		log.Fatal(err)
+	}
+	serverCmd.Flags().AddFlagSet(observationFlags)
 }
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/ws-upload/simulate"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// defaultSimulateTarget is the upload endpoint of a local ws-upload server
+const defaultSimulateTarget = "http://localhost:9108/api/v1/observe"
+
+var simulateConfig = struct {
+	Target   string        `env:"SIMULATE_TARGET" flag:"target" desc:"URL to upload to, defaults to http://localhost:9108/api/v1/observe for the wunderground protocol and is required for the ecowitt protocol"`
+	Protocol string        `env:"SIMULATE_PROTOCOL" flag:"protocol" desc:"upload protocol: wunderground or ecowitt"`
+	Interval time.Duration `env:"SIMULATE_INTERVAL" flag:"interval" desc:"upload interval per station"`
+	Duration time.Duration `env:"SIMULATE_DURATION" flag:"duration" desc:"stop after this duration, set to 0 to run until interrupted"`
+
+	Stations        int    `env:"SIMULATE_STATIONS" flag:"stations" desc:"number of simulated stations"`
+	StationIDPrefix string `env:"SIMULATE_STATION_ID_PREFIX" flag:"station-id-prefix" desc:"prefix of the station IDs, the station number is appended"`
+	Password        string `env:"SIMULATE_PASSWORD" flag:"password" desc:"station password to send with the wunderground protocol, the ecowitt passkey is derived from the station ID"`
+	Seed            int64  `env:"SIMULATE_SEED" flag:"seed" desc:"random seed of the weather, set to 0 to use a random seed"`
+}{
+	Protocol: string(simulate.ProtocolWunderground),
+	Interval: 16 * time.Second,
+
+	Stations:        1,
+	StationIDPrefix: "simulator",
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate",
+	Short: "Upload synthetic weather from simulated stations",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return parseFlags(&simulateConfig)
+	},
+	RunE: RunSimulate,
+}
+
+func RunSimulate(cmd *cobra.Command, args []string) error {
+	protocol, err := simulate.ParseProtocol(simulateConfig.Protocol)
+	if err != nil {
+		return err
+	}
+
+	if simulateConfig.Interval <= 0 {
+		return fmt.Errorf("invalid interval %s", simulateConfig.Interval)
+	}
+
+	if simulateConfig.Stations <= 0 {
+		return fmt.Errorf("invalid number of stations %d, at least one station is required", simulateConfig.Stations)
+	}
+
+	if simulateConfig.Target == "" {
+		// ws-upload itself only accepts Wunderground uploads, so Ecowitt uploads need another receiver
+		if protocol == simulate.ProtocolEcowitt {
+			return errors.New("--target is required for the ecowitt protocol, since ws-upload only accepts Wunderground uploads")
+		}
+
+		simulateConfig.Target = defaultSimulateTarget
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if simulateConfig.Duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, simulateConfig.Duration)
+		defer cancel()
+	}
+
+	seed := simulateConfig.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	logger.Info("Starting simulation", zap.Int("simulate.stations", simulateConfig.Stations), zap.String("simulate.protocol", string(protocol)), zap.String("simulate.target", simulateConfig.Target))
+
+	var wg sync.WaitGroup
+	for i := 1; i <= simulateConfig.Stations; i++ {
+		wg.Add(1)
+		go func(stationID string, seed int64) {
+			defer wg.Done()
+
+			simulateStation(ctx, client, protocol, stationID, simulate.NewWeather(seed))
+		}(fmt.Sprintf("%s%d", simulateConfig.StationIDPrefix, i), seed+int64(i))
+	}
+
+	wg.Wait()
+
+	return nil
+}
+
+func simulateStation(ctx context.Context, client *http.Client, protocol simulate.Protocol, stationID string, weather *simulate.Weather) {
+	entry := logger.With(zap.String("simulate.station_id", stationID))
+
+	if protocol == simulate.ProtocolEcowitt {
+		mac := simulate.EcowittMAC(stationID)
+		entry.Info("Simulating Ecowitt console", zap.String("simulate.mac", mac), zap.String("simulate.passkey", simulate.EcowittPasskey(mac)))
+	}
+
+	// Spread the uploads of the stations over the interval
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Duration(rand.Int63n(int64(simulateConfig.Interval)))):
+	}
+
+	t := time.NewTicker(simulateConfig.Interval)
+	defer t.Stop()
+
+	for {
+		if err := upload(ctx, client, protocol, stationID, weather.Next(time.Now())); err != nil {
+			entry.Warn("Failed to upload observation", zap.Error(err))
+		} else {
+			entry.Debug("Uploaded observation")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func upload(ctx context.Context, client *http.Client, protocol simulate.Protocol, stationID string, sample simulate.Sample) error {
+	var req *http.Request
+	var err error
+
+	switch protocol {
+	case simulate.ProtocolEcowitt:
+		values := simulate.EcowittValues(stationID, sample)
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, simulateConfig.Target, strings.NewReader(values.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	default:
+		values := simulate.WundergroundValues(stationID, simulateConfig.Password, sample)
+
+		separator := "?"
+		if strings.Contains(simulateConfig.Target, "?") {
+			separator = "&"
+		}
+
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, simulateConfig.Target+separator+values.Encode(), nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(simulateCmd)
+
+	if err := pflagenv.Setup(simulateCmd.Flags(), &simulateConfig); err != nil {
+		log.Fatal(err)
+	}
+}
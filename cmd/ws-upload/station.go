@@ -0,0 +1,230 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// stationCheckInterval is how often stations are checked for being offline
+const stationCheckInterval = 10 * time.Second
+
+type stationState string
+
+const (
+	// stationStateUnknown is the state of a configured station that has not uploaded since the server started
+	stationStateUnknown stationState = "unknown"
+	stationStateOnline  stationState = "online"
+	stationStateOffline stationState = "offline"
+)
+
+type stationStatus struct {
+	StationID string       `json:"station_id"`
+	State     stationState `json:"state"`
+	// LastSeen is the server time of the last upload, or nil if the station has not uploaded since the server started
+	LastSeen *time.Time `json:"last_seen"`
+}
+
+type stationEntry struct {
+	state    stationState
+	lastSeen time.Time
+	// since is the time the station was last seen, or the time it started being tracked if it has not been seen
+	since time.Time
+}
+
+// stationTracker tracks when stations were last seen. A station is offline once it has not uploaded for the offline
+// duration, and onChange is called whenever a station comes online or goes offline.
+type stationTracker struct {
+	offlineAfter time.Duration
+	onChange     func(stationID string, online bool)
+
+	// changeMu is held across a change of the state of a station and the call of onChange, so onChange is called in
+	// the order of the changes. It is taken before mu.
+	changeMu sync.Mutex
+
+	mu       sync.Mutex
+	stations map[string]*stationEntry
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+func newStationTracker(offlineAfter time.Duration, onChange func(stationID string, online bool)) *stationTracker {
+	t := &stationTracker{
+		offlineAfter: offlineAfter,
+		onChange:     onChange,
+
+		stations: make(map[string]*stationEntry),
+
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	go t.run()
+
+	return t
+}
+
+// Track starts tracking the stations, so they go offline if they never upload.
+func (t *stationTracker) Track(stationIDs []string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, stationID := range stationIDs {
+		if _, ok := t.stations[stationID]; !ok {
+			t.stations[stationID] = &stationEntry{
+				state: stationStateUnknown,
+				since: now,
+			}
+		}
+	}
+}
+
+// Seen records an upload of the station.
+func (t *stationTracker) Seen(stationID string, now time.Time) {
+	t.changeMu.Lock()
+	defer t.changeMu.Unlock()
+
+	t.mu.Lock()
+
+	entry, ok := t.stations[stationID]
+	if !ok {
+		entry = &stationEntry{}
+		t.stations[stationID] = entry
+	}
+
+	previous := entry.state
+	offlineFor := now.Sub(entry.since)
+
+	entry.state = stationStateOnline
+	entry.lastSeen = now
+	entry.since = now
+
+	t.mu.Unlock()
+
+	stationLastSeen.WithLabelValues(stationID).Set(float64(now.Unix()))
+
+	if previous == stationStateOnline {
+		return
+	}
+
+	stationOnline.WithLabelValues(stationID).Set(1)
+
+	if previous == stationStateOffline {
+		logger.Info("Station is online again", zap.String("ws_upload.station_id", stationID), zap.Duration("ws_upload.offline_duration", offlineFor))
+	} else {
+		logger.Info("Station is online", zap.String("ws_upload.station_id", stationID))
+	}
+
+	t.onChange(stationID, true)
+}
+
+// check marks stations that have not uploaded for the offline duration as offline.
+func (t *stationTracker) check(now time.Time) {
+	if t.offlineAfter <= 0 {
+		return
+	}
+
+	t.changeMu.Lock()
+	defer t.changeMu.Unlock()
+
+	var offline []string
+
+	t.mu.Lock()
+	for stationID, entry := range t.stations {
+		if entry.state != stationStateOffline && now.Sub(entry.since) >= t.offlineAfter {
+			entry.state = stationStateOffline
+			offline = append(offline, stationID)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, stationID := range offline {
+		stationOnline.WithLabelValues(stationID).Set(0)
+
+		logger.Warn("Station is offline", zap.String("ws_upload.station_id", stationID), zap.Duration("ws_upload.offline_after", t.offlineAfter))
+
+		t.onChange(stationID, false)
+	}
+}
+
+// Republish calls onChange for every station, so new publishers know which stations are online. Stations that have
+// not uploaded since the server started are presumed online until they go offline.
+func (t *stationTracker) Republish() {
+	t.changeMu.Lock()
+	defer t.changeMu.Unlock()
+
+	for _, status := range t.Statuses() {
+		t.onChange(status.StationID, status.State != stationStateOffline)
+	}
+}
+
+// Status returns the status of the station, or false if it is not tracked.
+func (t *stationTracker) Status(stationID string) (stationStatus, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.stations[stationID]
+	if !ok {
+		return stationStatus{}, false
+	}
+
+	return entry.status(stationID), true
+}
+
+// Statuses returns the status of all stations, sorted by station ID.
+func (t *stationTracker) Statuses() []stationStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := make([]stationStatus, 0, len(t.stations))
+	for stationID, entry := range t.stations {
+		statuses = append(statuses, entry.status(stationID))
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].StationID < statuses[j].StationID
+	})
+
+	return statuses
+}
+
+func (e *stationEntry) status(stationID string) stationStatus {
+	status := stationStatus{
+		StationID: stationID,
+		State:     e.state,
+	}
+	if !e.lastSeen.IsZero() {
+		lastSeen := e.lastSeen
+		status.LastSeen = &lastSeen
+	}
+
+	return status
+}
+
+func (t *stationTracker) run() {
+	defer close(t.stopped)
+
+	ticker := time.NewTicker(stationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case now := <-ticker.C:
+			t.check(now)
+		}
+	}
+}
+
+// Close stops checking for offline stations. It can be called multiple times.
+func (t *stationTracker) Close() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+	<-t.stopped
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type availabilityChange struct {
+	stationID string
+	online    bool
+}
+
+type changeRecorder struct {
+	mu      sync.Mutex
+	changes []availabilityChange
+}
+
+func (r *changeRecorder) onChange(stationID string, online bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.changes = append(r.changes, availabilityChange{stationID: stationID, online: online})
+}
+
+func (r *changeRecorder) recorded() []availabilityChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]availabilityChange(nil), r.changes...)
+}
+
+func TestStationTracker(t *testing.T) {
+	logger = zap.NewNop()
+
+	recorder := &changeRecorder{}
+	tracker := newStationTracker(10*time.Minute, recorder.onChange)
+	defer tracker.Close()
+
+	now := time.Now()
+
+	tracker.Track([]string{"a", "b"}, now)
+	// Stations that have not uploaded yet are presumed online
+	tracker.Republish()
+
+	tracker.Seen("a", now.Add(time.Minute))
+	tracker.Seen("a", now.Add(2*time.Minute))
+	tracker.check(now.Add(10 * time.Minute))
+	tracker.check(now.Add(11 * time.Minute))
+	tracker.check(now.Add(12 * time.Minute))
+	tracker.Seen("a", now.Add(13*time.Minute))
+	tracker.Republish()
+
+	want := []availabilityChange{
+		{"a", true},
+		{"b", true},
+		{"a", true},
+		{"b", false},
+		{"a", false},
+		{"a", true},
+		{"a", true},
+		{"b", false},
+	}
+
+	got := recorder.recorded()
+	if len(got) != len(want) {
+		t.Fatalf("got changes %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got change %d %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	status, ok := tracker.Status("b")
+	if !ok || status.State != stationStateOffline || status.LastSeen != nil {
+		t.Errorf("got status %+v, want offline without last seen", status)
+	}
+}
+
+func TestStationTrackerOrder(t *testing.T) {
+	logger = zap.NewNop()
+
+	recorder := &changeRecorder{}
+	tracker := newStationTracker(time.Millisecond, recorder.onChange)
+	defer tracker.Close()
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			tracker.Seen("station", start.Add(time.Duration(i)*time.Millisecond))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			tracker.check(start.Add(time.Duration(i)*time.Millisecond + 500*time.Microsecond).Add(time.Millisecond))
+		}
+	}()
+	wg.Wait()
+
+	changes := recorder.recorded()
+	if len(changes) == 0 {
+		t.Fatal("got no changes")
+	}
+
+	// Every change is a transition, so the changes alternate and the last change is the current state
+	for i := 1; i < len(changes); i++ {
+		if changes[i].online == changes[i-1].online {
+			t.Fatalf("got change %d online = %v after the same change", i, changes[i].online)
+		}
+	}
+
+	status, _ := tracker.Status("station")
+	if online := status.State == stationStateOnline; changes[len(changes)-1].online != online {
+		t.Errorf("last change online = %v, but the station is %s", changes[len(changes)-1].online, status.State)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// certificateReloader loads a certificate and reloads it when the certificate or key file is modified, so rotated
+// certificates are used without restarting the server.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	r := &certificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+
+	if _, err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// load loads the certificate if the files were modified since the last load. It returns whether it was reloaded.
+func (r *certificateReloader) load() (bool, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat TLS certificate: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat TLS key: %w", err)
+	}
+
+	if r.certificate != nil && certInfo.ModTime().Equal(r.certModTime) && keyInfo.ModTime().Equal(r.keyModTime) {
+		return false, nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.certificate = &certificate
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+
+	return true, nil
+}
+
+func (r *certificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reloaded, err := r.load()
+	if err != nil {
+		// The files may be in the middle of being replaced, so keep using the current certificate
+		logger.Warn("Failed to reload TLS certificate, keeping the current certificate", zap.Error(err))
+	} else if reloaded {
+		logger.Info("Reloaded TLS certificate", zap.String("tls.cert_file", r.certFile))
+	}
+
+	return r.certificate, nil
+}
+
+func newTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	reloader, err := newCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if clientCAFile != "" {
+		data, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS client CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in TLS client CA file %s", clientCAFile)
+		}
+
+		// Client certificates are only required for some routes, which is enforced by requireClientCertificate
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
+
+// requireClientCertificate rejects requests that were not made over TLS using a verified client certificate.
+func requireClientCertificate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().TLS == nil || len(c.Request().TLS.VerifiedChains) == 0 {
+			return c.String(http.StatusForbidden, "Client certificate required")
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/koesie10/pflagenv"
+	"github.com/koesie10/ws-upload/alert"
+	"github.com/koesie10/ws-upload/climate"
+	"github.com/koesie10/ws-upload/password"
+	"github.com/koesie10/ws-upload/wsupload"
+	"github.com/mitchellh/mapstructure"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// AnyStation is the station ID of a station that matches all station IDs which are not configured explicitly
+const AnyStation = "*"
+
+// Config is the configuration of the stations and publishers. The keys in a configuration file are the same as
+// the names of the corresponding flags, without any prefix.
+type Config struct {
+	ClockSkewPolicy string        `flag:"clock-skew-policy"`
+	MaxClockSkew    time.Duration `flag:"max-clock-skew"`
+
+	Stations   []Station   `flag:"stations"`
+	Publishers []Publisher `flag:"publishers"`
+
+	Climate climate.Options `flag:"climate"`
+
+	// Alerts can only be configured in a configuration file
+	Alerts alert.Options `flag:"alerts"`
+}
+
+type Station struct {
+	// ID is the station ID sent by the console, or AnyStation
+	ID string `flag:"id"`
+	// Password is the password the station must send, either in plaintext or as a bcrypt or argon2id hash. Uploads of
+	// stations without password are rejected.
+	Password string `flag:"password"`
+	// Timezone is the IANA time zone of the console if it uploads local time
+	Timezone string `flag:"timezone"`
+}
+
+type Publisher struct {
+	Type string `flag:"type"`
+	// Name identifies the publisher in logs, defaults to the type
+	Name string `flag:"name"`
+	// Options are the options of the publisher, either as read from a configuration file or as an options struct
+	Options interface{} `flag:"options"`
+}
+
+// Load reads and validates a YAML or TOML configuration file.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var raw map[string]interface{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %s, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	config := &Config{
+		ClockSkewPolicy: string(wsupload.ClockSkewPolicyTrustStation),
+		MaxClockSkew:    5 * time.Minute,
+		Climate:         climate.DefaultOptions(),
+	}
+	if err := Decode(raw, config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Decode decodes a map as read from a configuration file into result. Unknown keys are reported as errors. Lists and
+// maps in the input replace the defaults in result instead of being merged with them.
+func Decode(input interface{}, result interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           result,
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		ZeroFields:       true,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+			stringMapHook(),
+		),
+		TagName: "flag",
+	})
+	if err != nil {
+		return err
+	}
+
+	return decoder.Decode(input)
+}
+
+// stringMapHook decodes maps given as name=value strings like the flags do, while maps in the configuration file
+// itself are decoded as is.
+func stringMapHook() mapstructure.DecodeHookFunc {
+	hook := pflagenv.StringMapHook().(func(reflect.Type, reflect.Type, interface{}) (interface{}, error))
+
+	return func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+		if f.Kind() == reflect.Map {
+			return data, nil
+		}
+
+		return hook(f, t, data)
+	}
+}
+
+func (c *Config) Validate() error {
+	if _, err := wsupload.ParseClockSkewPolicy(c.ClockSkewPolicy); err != nil {
+		return err
+	}
+
+	stationIDs := make(map[string]struct{}, len(c.Stations))
+	for i, station := range c.Stations {
+		if station.ID == "" {
+			return fmt.Errorf("station %d has no ID, use %q to match all stations", i, AnyStation)
+		}
+		if _, ok := stationIDs[station.ID]; ok {
+			return fmt.Errorf("duplicate station %s", station.ID)
+		}
+		stationIDs[station.ID] = struct{}{}
+
+		if err := password.Validate(station.Password); err != nil {
+			return fmt.Errorf("invalid password for station %s: %w", station.ID, err)
+		}
+
+		if station.Timezone != "" {
+			if _, err := time.LoadLocation(station.Timezone); err != nil {
+				return fmt.Errorf("invalid time zone for station %s: %w", station.ID, err)
+			}
+		}
+	}
+
+	publisherNames := make(map[string]struct{}, len(c.Publishers))
+	for i := range c.Publishers {
+		publisher := &c.Publishers[i]
+		if publisher.Type == "" {
+			return fmt.Errorf("publisher %d has no type", i)
+		}
+		if publisher.Name == "" {
+			publisher.Name = publisher.Type
+		}
+		if _, ok := publisherNames[publisher.Name]; ok {
+			return fmt.Errorf("duplicate publisher %s, set a unique name", publisher.Name)
+		}
+		publisherNames[publisher.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// ValidatePasswords returns an error if a station has no password. Uploads of such stations would always be rejected,
+// so the server requires them, while other commands can use the config without passwords.
+func (c *Config) ValidatePasswords() error {
+	for _, station := range c.Stations {
+		if station.Password == "" {
+			return fmt.Errorf("station %s has no password", station.ID)
+		}
+	}
+
+	return nil
+}
+
+// Station returns the station with the given ID, falling back to the AnyStation station. It returns nil if there is
+// no matching station.
+func (c *Config) Station(id string) *Station {
+	var anyStation *Station
+
+	for i := range c.Stations {
+		if c.Stations[i].ID == id {
+			return &c.Stations[i]
+		}
+		if c.Stations[i].ID == AnyStation {
+			anyStation = &c.Stations[i]
+		}
+	}
+
+	return anyStation
+}
+
+// DecodePublisherOptions decodes the options of the publisher configuration into the options struct of its type.
+func DecodePublisherOptions(publisherConfig Publisher) (wsupload.PublisherFactory, interface{}, error) {
+	factory, ok := wsupload.LookupPublisher(publisherConfig.Type)
+	if !ok {
+		return factory, nil, fmt.Errorf("unknown publisher type %s for publisher %s, available types are %v", publisherConfig.Type, publisherConfig.Name, wsupload.PublisherTypes())
+	}
+
+	if factory.NewOptions == nil {
+		if publisherConfig.Options != nil {
+			return factory, nil, fmt.Errorf("publisher %s does not have any options", publisherConfig.Name)
+		}
+
+		return factory, nil, nil
+	}
+
+	options := factory.NewOptions()
+
+	if publisherConfig.Options != nil {
+		if err := Decode(publisherConfig.Options, options); err != nil {
+			return factory, nil, fmt.Errorf("invalid options for publisher %s: %w", publisherConfig.Name, err)
+		}
+	}
+
+	return factory, options, nil
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecode(t *testing.T) {
+	type options struct {
+		Intervals []time.Duration   `flag:"intervals"`
+		Names     []string          `flag:"names"`
+		Tags      map[string]string `flag:"tags"`
+		Delay     time.Duration     `flag:"delay"`
+	}
+
+	defaults := func() options {
+		return options{
+			Intervals: []time.Duration{5 * time.Minute, time.Hour, 24 * time.Hour},
+			Names:     []string{"a", "b"},
+			Tags:      map[string]string{"default": "true"},
+			Delay:     time.Minute,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		input   map[string]interface{}
+		want    options
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			input: map[string]interface{}{},
+			want:  defaults(),
+		},
+		{
+			name:  "shorter list replaces default",
+			input: map[string]interface{}{"intervals": []interface{}{"1h"}},
+			want: options{
+				Intervals: []time.Duration{time.Hour},
+				Names:     []string{"a", "b"},
+				Tags:      map[string]string{"default": "true"},
+				Delay:     time.Minute,
+			},
+		},
+		{
+			name:  "comma separated list",
+			input: map[string]interface{}{"names": "c,d,e"},
+			want: options{
+				Intervals: []time.Duration{5 * time.Minute, time.Hour, 24 * time.Hour},
+				Names:     []string{"c", "d", "e"},
+				Tags:      map[string]string{"default": "true"},
+				Delay:     time.Minute,
+			},
+		},
+		{
+			name: "maps replace default",
+			input: map[string]interface{}{
+				"tags":  "location=garden",
+				"delay": "30s",
+			},
+			want: options{
+				Intervals: []time.Duration{5 * time.Minute, time.Hour, 24 * time.Hour},
+				Names:     []string{"a", "b"},
+				Tags:      map[string]string{"location": "garden"},
+				Delay:     30 * time.Second,
+			},
+		},
+		{
+			name:    "unknown key",
+			input:   map[string]interface{}{"interval": "1h"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := defaults()
+			err := Decode(tt.input, &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePasswords(t *testing.T) {
+	tests := []struct {
+		name     string
+		stations []Station
+		wantErr  bool
+	}{
+		{name: "no stations"},
+		{
+			name: "passwords",
+			stations: []Station{
+				{ID: "station", Password: "secretpassword1"},
+				{ID: AnyStation, Password: "secretpassword2"},
+			},
+		},
+		{
+			name: "missing password",
+			stations: []Station{
+				{ID: "station", Password: "secretpassword1"},
+				{ID: AnyStation},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Config{Stations: tt.stations}
+			if err := c.ValidatePasswords(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidatePasswords() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+type Format string
+
+const (
+	// FormatCSV writes a header row with the JSON names of the fields followed by a row per observation
+	FormatCSV Format = "csv"
+	// FormatJSON writes a JSON array of observations
+	FormatJSON Format = "json"
+	// FormatColumnar writes a JSON object containing an array of values per field, in the same order as the
+	// observations
+	FormatColumnar Format = "columnar"
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case FormatCSV, FormatJSON, FormatColumnar:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid format %q, use %s, %s or %s", s, FormatCSV, FormatJSON, FormatColumnar)
+	}
+}
+
+// Write writes the observations in the format. Fields are named after their JSON name.
+func Write(w io.Writer, format Format, observations []*wsupload.Observation) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, observations)
+	case FormatJSON:
+		return writeJSON(w, observations)
+	case FormatColumnar:
+		return writeColumnar(w, observations)
+	default:
+		return fmt.Errorf("unsupported format %s", format)
+	}
+}
+
+// fields returns the fields of observations which have a JSON name, in the order of the schema.
+func fields() []*wsupload.Field {
+	var fields []*wsupload.Field
+	for _, field := range wsupload.ObservationSchema.Fields {
+		if field.JSONName != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
+// value returns the value of the field, or nil if it is null.
+func value(obs *wsupload.Observation, field *wsupload.Field) interface{} {
+	v := field.Value(obs).Interface()
+
+	if nullable, ok := v.(wsupload.Nullable); ok {
+		if nullable.IsNull() {
+			return nil
+		}
+
+		return nullable.Value()
+	}
+
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339)
+	}
+
+	return v
+}
+
+func writeCSV(w io.Writer, observations []*wsupload.Observation) error {
+	fields := fields()
+
+	writer := csv.NewWriter(w)
+
+	record := make([]string, len(fields))
+	for i, field := range fields {
+		record[i] = field.JSONName
+	}
+	if err := writer.Write(record); err != nil {
+		return err
+	}
+
+	for _, obs := range observations {
+		for i, field := range fields {
+			switch v := value(obs, field).(type) {
+			case nil:
+				record[i] = ""
+			case float64:
+				record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+			default:
+				record[i] = fmt.Sprint(v)
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func writeJSON(w io.Writer, observations []*wsupload.Observation) error {
+	// Times are written in UTC, the same as the other formats
+	utc := make([]wsupload.Observation, len(observations))
+	for i, obs := range observations {
+		utc[i] = *obs
+		utc[i].ObservationTime = obs.ObservationTime.UTC()
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(utc)
+}
+
+func writeColumnar(w io.Writer, observations []*wsupload.Observation) error {
+	bw := bufio.NewWriter(w)
+
+	// The object is written manually to keep the columns in the order of the schema
+	bw.WriteString("{")
+
+	for i, field := range fields() {
+		values := make([]interface{}, len(observations))
+		for j, obs := range observations {
+			values[j] = value(obs, field)
+		}
+
+		name, err := json.Marshal(field.JSONName)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("\n  ")
+		bw.Write(name)
+		bw.WriteString(": ")
+		bw.Write(data)
+	}
+
+	bw.WriteString("\n}\n")
+
+	return bw.Flush()
+}
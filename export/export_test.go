@@ -0,0 +1,201 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Format
+		wantErr bool
+	}{
+		{value: "csv", want: FormatCSV},
+		{value: "json", want: FormatJSON},
+		{value: "columnar", want: FormatColumnar},
+		{value: "CSV", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseFormat(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFormat() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func testObservations() []*wsupload.Observation {
+	return []*wsupload.Observation{
+		{
+			StationID:                 "station",
+			ObservationTime:           time.Date(2024, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+			OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: 21.5},
+			WindDirectionDegrees:      wsupload.NullInt64{Valid: true, Int64: 180},
+		},
+		{
+			StationID:       "station",
+			ObservationTime: time.Date(2024, 6, 1, 10, 5, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format Format
+		// parse returns the values of the observation_time, outside_temperature_celsius and wind_direction_degrees
+		// fields of every observation as strings, with null values as empty strings
+		parse func(t *testing.T, data []byte) [][]string
+	}{
+		{
+			format: FormatCSV,
+			parse: func(t *testing.T, data []byte) [][]string {
+				records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if records[0][0] != "station_id" {
+					t.Errorf("first column = %q, want station_id", records[0][0])
+				}
+
+				indexes := make(map[string]int)
+				for i, header := range records[0] {
+					indexes[header] = i
+				}
+
+				var result [][]string
+				for _, record := range records[1:] {
+					result = append(result, []string{
+						record[indexes["observation_time"]],
+						record[indexes["outside_temperature_celsius"]],
+						record[indexes["wind_direction_degrees"]],
+					})
+				}
+				return result
+			},
+		},
+		{
+			format: FormatJSON,
+			parse: func(t *testing.T, data []byte) [][]string {
+				var observations []map[string]interface{}
+				if err := json.Unmarshal(data, &observations); err != nil {
+					t.Fatal(err)
+				}
+
+				var result [][]string
+				for _, obs := range observations {
+					result = append(result, []string{
+						jsonString(obs["observation_time"]),
+						jsonString(obs["outside_temperature_celsius"]),
+						jsonString(obs["wind_direction_degrees"]),
+					})
+				}
+				return result
+			},
+		},
+		{
+			format: FormatColumnar,
+			parse: func(t *testing.T, data []byte) [][]string {
+				if !strings.HasPrefix(string(data), "{\n  \"station_id\": [") {
+					t.Errorf("columns are not in the order of the schema: %s", data)
+				}
+
+				var columns map[string][]interface{}
+				if err := json.Unmarshal(data, &columns); err != nil {
+					t.Fatal(err)
+				}
+
+				var result [][]string
+				for i := range columns["station_id"] {
+					result = append(result, []string{
+						jsonString(columns["observation_time"][i]),
+						jsonString(columns["outside_temperature_celsius"][i]),
+						jsonString(columns["wind_direction_degrees"][i]),
+					})
+				}
+				return result
+			},
+		},
+	}
+
+	want := [][]string{
+		{"2024-06-01T10:00:00Z", "21.5", "180"},
+		{"2024-06-01T10:05:00Z", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, tt.format, testObservations()); err != nil {
+				t.Fatal(err)
+			}
+
+			got := tt.parse(t, buf.Bytes())
+			if len(got) != len(want) {
+				t.Fatalf("got %d observations, want %d:\n%s", len(got), len(want), buf.String())
+			}
+			for i := range want {
+				for j := range want[i] {
+					if got[i][j] != want[i][j] {
+						t.Errorf("observation %d = %q, want %q", i, got[i], want[i])
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWriteEmpty(t *testing.T) {
+	tests := []struct {
+		format Format
+		want   string
+	}{
+		{format: FormatCSV, want: "station_id,software_type,observation_time,"},
+		{format: FormatJSON, want: "[]\n"},
+		{format: FormatColumnar, want: "{\n  \"station_id\": [],"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, tt.format, nil); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(buf.String(), tt.want) {
+				t.Errorf("Write() = %q, want prefix %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteUnsupportedFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, Format("xml"), nil); err == nil {
+		t.Error("Write() error = nil, want an error")
+	}
+}
+
+func jsonString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
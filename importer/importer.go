@@ -0,0 +1,227 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+)
+
+// timeLayouts are the layouts tried to parse the observation time if no layout is given. Numbers are parsed as Unix
+// timestamps in seconds.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/1/2 15:04:05",
+	"2006/1/2 15:04",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+}
+
+type column struct {
+	index   int
+	header  string
+	field   *wsupload.Field
+	convert func(float64) float64
+}
+
+// Reader reads observations from a CSV file with a header row.
+type Reader struct {
+	reader    *csv.Reader
+	stationID string
+	location  *time.Location
+
+	timeIndex  int
+	timeLayout string
+	columns    []column
+
+	line int
+}
+
+// NewReader reads the header of the CSV file and maps the columns onto observation fields. Times without a time zone
+// are parsed in the given location.
+func NewReader(logger *zap.Logger, r io.Reader, mapping Mapping, stationID string, location *time.Location) (*Reader, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	csvReader := csv.NewReader(r)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+
+	headers, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if len(headers) > 0 {
+		// Exports created by spreadsheet applications may start with a byte order mark
+		headers[0] = strings.TrimPrefix(headers[0], "\ufeff")
+	}
+
+	fields := make(map[string]*wsupload.Field)
+	for _, field := range wsupload.ObservationSchema.Fields {
+		fields[field.JSONName] = field
+	}
+
+	reader := &Reader{
+		reader:     csvReader,
+		stationID:  stationID,
+		location:   location,
+		timeIndex:  -1,
+		timeLayout: mapping.TimeLayout,
+		line:       1,
+	}
+
+	mappedFields := make(map[string]string)
+
+	for i, header := range headers {
+		name, unit := splitHeader(header)
+
+		if (mapping.TimeColumn != "" && header == mapping.TimeColumn) || (mapping.TimeColumn == "" && reader.timeIndex < 0 && isTimeColumn(name)) {
+			reader.timeIndex = i
+			continue
+		}
+
+		fieldName := detectField(name)
+
+		if c, ok := mapping.Columns[header]; ok {
+			fieldName = c.Field
+			if c.Unit != "" {
+				unit = c.Unit
+			}
+		}
+
+		if fieldName == "" || fieldName == Ignore {
+			logger.Info("Ignoring column", zap.String("import.column", header))
+			continue
+		}
+
+		if other, ok := mappedFields[fieldName]; ok {
+			return nil, fmt.Errorf("columns %q and %q are both mapped to field %s", other, header, fieldName)
+		}
+		mappedFields[fieldName] = header
+
+		convert, err := conversion(fieldName, unit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid column %q: %w", header, err)
+		}
+
+		if unit == "" && fieldQuantities[fieldName] != quantityUVIndex {
+			logger.Warn("No unit found for column, assuming it is in the unit of the field", zap.String("import.column", header), zap.String("import.field", fieldName))
+		}
+
+		logger.Info("Importing column", zap.String("import.column", header), zap.String("import.field", fieldName), zap.String("import.unit", unit))
+
+		reader.columns = append(reader.columns, column{
+			index:   i,
+			header:  header,
+			field:   fields[fieldName],
+			convert: convert,
+		})
+	}
+
+	if reader.timeIndex < 0 {
+		if mapping.TimeColumn != "" {
+			return nil, fmt.Errorf("time column %q not found", mapping.TimeColumn)
+		}
+		return nil, errors.New("no time column found, set the time column in the mapping")
+	}
+
+	if len(reader.columns) == 0 {
+		return nil, errors.New("no columns could be mapped onto observation fields")
+	}
+
+	return reader, nil
+}
+
+// Next returns the next observation, or io.EOF if there are no more observations. Empty values are left unset.
+func (r *Reader) Next() (*wsupload.Observation, error) {
+	for {
+		record, err := r.reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		r.line++
+
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		if r.timeIndex >= len(record) {
+			return nil, fmt.Errorf("missing time on line %d", r.line)
+		}
+
+		t, err := r.parseTime(strings.TrimSpace(record[r.timeIndex]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid time on line %d: %w", r.line, err)
+		}
+
+		obs := &wsupload.Observation{
+			StationID:       r.stationID,
+			ObservationTime: t.UTC(),
+		}
+
+		for _, c := range r.columns {
+			if c.index >= len(record) {
+				continue
+			}
+
+			value := strings.TrimSpace(record[c.index])
+			if value == "" || value == "-" || value == "--" {
+				continue
+			}
+
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for column %q on line %d: %w", value, c.header, r.line, err)
+			}
+
+			setField(obs, c.field, c.convert(v))
+		}
+
+		return obs, nil
+	}
+}
+
+func (r *Reader) parseTime(value string) (time.Time, error) {
+	if r.timeLayout != "" {
+		return time.ParseInLocation(r.timeLayout, value, r.location)
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, r.location); err == nil {
+			// Use the layout for all following lines to not mix up day and month
+			r.timeLayout = layout
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown time format %q, set the time layout in the mapping", value)
+}
+
+func setField(obs *wsupload.Observation, field *wsupload.Field, v float64) {
+	fieldValue := field.Value(obs)
+
+	switch fieldValue.Interface().(type) {
+	case wsupload.NullFloat64:
+		fieldValue.Set(reflect.ValueOf(wsupload.NullFloat64{Valid: true, Float64: v}))
+	case wsupload.NullInt64:
+		fieldValue.Set(reflect.ValueOf(wsupload.NullInt64{Valid: true, Int64: int64(math.Round(v))}))
+	}
+}
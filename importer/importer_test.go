@@ -0,0 +1,346 @@
+package importer
+
+import (
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+func TestSplitHeader(t *testing.T) {
+	tests := []struct {
+		header   string
+		wantName string
+		wantUnit string
+	}{
+		{header: "Outdoor Temperature(℃)", wantName: "Outdoor Temperature", wantUnit: "℃"},
+		{header: "Wind Speed [km/h]", wantName: "Wind Speed", wantUnit: "km/h"},
+		{header: " Rel. Pressure ( hPa ) ", wantName: "Rel. Pressure", wantUnit: "hPa"},
+		{header: "UVI", wantName: "UVI"},
+		{header: "(mm)", wantName: "(mm)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			name, unit := splitHeader(tt.header)
+			if name != tt.wantName || unit != tt.wantUnit {
+				t.Errorf("splitHeader() = %q, %q, want %q, %q", name, unit, tt.wantName, tt.wantUnit)
+			}
+		})
+	}
+}
+
+func TestDetectField(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "Outdoor Temperature", want: "outside_temperature_celsius"},
+		{name: "outTemp", want: "outside_temperature_celsius"},
+		{name: "Rel. Pressure", want: "relative_atmospheric_pressure_pascal"},
+		{name: "Wind Gust", want: "wind_gust_meters_per_second"},
+		{name: "daily_rain_millimeters", want: "daily_rain_millimeters"},
+		{name: "Battery"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectField(tt.name); got != tt.want {
+				t.Errorf("detectField() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversion(t *testing.T) {
+	tests := []struct {
+		field   string
+		unit    string
+		value   float64
+		want    float64
+		wantErr bool
+	}{
+		{field: "outside_temperature_celsius", unit: "℉", value: 50, want: 10},
+		{field: "outside_temperature_celsius", unit: "°C", value: 10, want: 10},
+		{field: "outside_temperature_celsius", unit: "K", value: 283.15, want: 10},
+		{field: "relative_atmospheric_pressure_pascal", unit: "hPa", value: 1013.25, want: 101325},
+		{field: "relative_atmospheric_pressure_pascal", unit: "inHg", value: 1, want: 3386},
+		{field: "wind_speed_meters_per_second", unit: "km/h", value: 36, want: 10},
+		{field: "wind_speed_meters_per_second", unit: "knots", value: 1, want: 0.514444},
+		{field: "wind_speed_meters_per_second", unit: "mph", value: 10, want: 4.4704},
+		{field: "daily_rain_millimeters", unit: "inches", value: 1, want: 25.4},
+		{field: "solar_radiation_watt_per_meter_squared", unit: "W/m²", value: 100, want: 100},
+		{field: "uv_index", unit: "UVI", value: 3, want: 3},
+		{field: "outside_relative_humidity", value: 80, want: 80},
+		{field: "outside_relative_humidity", unit: "hPa", wantErr: true},
+		{field: "daily_rain_millimeters", unit: "l/m2", wantErr: true},
+		{field: "station_id", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.field+" "+tt.unit, func(t *testing.T) {
+			convert, err := conversion(tt.field, tt.unit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("conversion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := convert(tt.value); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("conversion()(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		csv     string
+		mapping Mapping
+		want    []*wsupload.Observation
+		wantErr bool
+	}{
+		{
+			name: "detected columns",
+			csv: "\ufeffTime,Outdoor Temperature(℉),Outdoor Humidity(%),Wind Direction(°),Wind Speed(km/h),Battery\n" +
+				"2024-06-01 12:00,50,80,181.6,36,1\n" +
+				"\n" +
+				"2024-06-01 12:05,--,,90,,1\n",
+			want: []*wsupload.Observation{
+				{
+					StationID:                 "station",
+					ObservationTime:           time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+					OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: 10},
+					OutsideRelativeHumidity:   wsupload.NullFloat64{Valid: true, Float64: 80},
+					WindDirectionDegrees:      wsupload.NullInt64{Valid: true, Int64: 182},
+					WindSpeedMetersPerSecond:  wsupload.NullFloat64{Valid: true, Float64: 10},
+				},
+				{
+					StationID:            "station",
+					ObservationTime:      time.Date(2024, 6, 1, 10, 5, 0, 0, time.UTC),
+					WindDirectionDegrees: wsupload.NullInt64{Valid: true, Int64: 90},
+				},
+			},
+		},
+		{
+			name: "mapping",
+			csv: "When,Temp,Hum,Temperature\n" +
+				"01.06.2024 12:00,10,80,20\n",
+			mapping: Mapping{
+				TimeColumn: "When",
+				TimeLayout: "02.01.2006 15:04",
+				Columns: map[string]Column{
+					"Temp":        {Field: "indoor_temperature_celsius", Unit: "C"},
+					"Hum":         {Field: "indoor_relative_humidity"},
+					"Temperature": {Field: Ignore},
+				},
+			},
+			want: []*wsupload.Observation{
+				{
+					StationID:                "station",
+					ObservationTime:          time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+					IndoorTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: 10},
+					IndoorRelativeHumidity:   wsupload.NullFloat64{Valid: true, Float64: 80},
+				},
+			},
+		},
+		{
+			name: "unix timestamps",
+			csv: "timestamp,daily_rain_millimeters (in)\n" +
+				"1717236000,1\n",
+			want: []*wsupload.Observation{
+				{
+					StationID:            "station",
+					ObservationTime:      time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+					DailyRainMillimeters: wsupload.NullFloat64{Valid: true, Float64: 25.4},
+				},
+			},
+		},
+		{
+			name:    "no time column",
+			csv:     "Outdoor Temperature(℃)\n10\n",
+			wantErr: true,
+		},
+		{
+			name:    "no mapped columns",
+			csv:     "Time,Battery\n2024-06-01 12:00,1\n",
+			wantErr: true,
+		},
+		{
+			name:    "duplicate field",
+			csv:     "Time,Temperature(℃),Outdoor Temperature(℃)\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported unit",
+			csv:     "Time,Temperature(hPa)\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewReader(nil, strings.NewReader(tt.csv), tt.mapping, "station", amsterdam)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var got []*wsupload.Observation
+			for {
+				obs, err := reader.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, obs)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d observations, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if !observationsEqual(got[i], tt.want[i]) {
+					t.Errorf("observation %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReaderInvalidValue(t *testing.T) {
+	reader, err := NewReader(nil, strings.NewReader("Time,Temperature(℃)\n2024-06-01 12:00,warm\n"), Mapping{}, "station", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.Next(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Next() error = %v, want an error for line 2", err)
+	}
+}
+
+func TestLoadMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    Mapping
+		wantErr bool
+	}{
+		{
+			name: "yaml",
+			file: "mapping.yaml",
+			content: "time-column: When\n" +
+				"columns:\n" +
+				"  Temp:\n" +
+				"    field: outside_temperature_celsius\n" +
+				"    unit: F\n",
+			want: Mapping{
+				TimeColumn: "When",
+				Columns: map[string]Column{
+					"Temp": {Field: "outside_temperature_celsius", Unit: "F"},
+				},
+			},
+		},
+		{
+			name: "toml",
+			file: "mapping.toml",
+			content: "time-layout = \"2006-01-02\"\n" +
+				"[columns.Battery]\n" +
+				"field = \"-\"\n",
+			want: Mapping{
+				TimeLayout: "2006-01-02",
+				Columns: map[string]Column{
+					"Battery": {Field: Ignore},
+				},
+			},
+		},
+		{
+			name:    "unknown field",
+			file:    "mapping.yaml",
+			content: "columns:\n  Battery:\n    field: battery\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported unit",
+			file:    "mapping.yaml",
+			content: "columns:\n  Temp:\n    field: outside_temperature_celsius\n    unit: hPa\n",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported extension",
+			file:    "mapping.json",
+			content: "{}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadMapping(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadMapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.TimeColumn != tt.want.TimeColumn || got.TimeLayout != tt.want.TimeLayout || len(got.Columns) != len(tt.want.Columns) {
+				t.Fatalf("LoadMapping() = %+v, want %+v", got, tt.want)
+			}
+			for header, column := range tt.want.Columns {
+				if got.Columns[header] != column {
+					t.Errorf("column %q = %+v, want %+v", header, got.Columns[header], column)
+				}
+			}
+		})
+	}
+}
+
+func observationsEqual(a, b *wsupload.Observation) bool {
+	if !a.ObservationTime.Equal(b.ObservationTime) {
+		return false
+	}
+
+	for _, field := range wsupload.ObservationSchema.Fields {
+		if field.Name == "ObservationTime" {
+			continue
+		}
+		if va, vb := field.Value(a).Interface(), field.Value(b).Interface(); !floatsEqual(va, vb) && va != vb {
+			return false
+		}
+	}
+
+	return true
+}
+
+func floatsEqual(a, b interface{}) bool {
+	fa, ok := a.(wsupload.NullFloat64)
+	if !ok {
+		return false
+	}
+	fb := b.(wsupload.NullFloat64)
+
+	return fa.Valid == fb.Valid && math.Abs(fa.Float64-fb.Float64) < 1e-9
+}
@@ -0,0 +1,161 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/koesie10/ws-upload/config"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Ignore is the field of columns that should not be imported
+const Ignore = "-"
+
+// Mapping maps the columns of a CSV file onto observation fields. Columns which are not in the mapping are detected
+// from their header.
+type Mapping struct {
+	// TimeColumn is the header of the column containing the observation time, detected if empty
+	TimeColumn string `flag:"time-column"`
+	// TimeLayout is the Go time layout of the observation time, detected if empty
+	TimeLayout string `flag:"time-layout"`
+	// Columns contains the mapping of columns by header
+	Columns map[string]Column `flag:"columns"`
+}
+
+type Column struct {
+	// Field is the JSON name of the observation field, or Ignore
+	Field string `flag:"field"`
+	// Unit is the unit of the values, detected from the header if empty
+	Unit string `flag:"unit"`
+}
+
+// LoadMapping reads a mapping from a YAML or TOML file.
+func LoadMapping(path string) (*Mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mapping file: %w", err)
+	}
+
+	var raw map[string]interface{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported mapping file extension %s, use .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mapping file %s: %w", path, err)
+	}
+
+	var mapping Mapping
+	if err := config.Decode(raw, &mapping); err != nil {
+		return nil, fmt.Errorf("invalid mapping file %s: %w", path, err)
+	}
+
+	for header, column := range mapping.Columns {
+		if column.Field == Ignore {
+			continue
+		}
+		if _, err := conversion(column.Field, column.Unit); err != nil {
+			return nil, fmt.Errorf("invalid mapping for column %q: %w", header, err)
+		}
+	}
+
+	return &mapping, nil
+}
+
+// timeColumnNames are the normalized headers of columns that are detected as the observation time
+var timeColumnNames = []string{"time", "date", "datetime", "timestamp", "observationtime"}
+
+// columnNames maps normalized headers as used in exports of consoles and ecowitt.net to observation fields. The JSON
+// names of the fields are also detected.
+var columnNames = map[string]string{
+	"outdoortemperature": "outside_temperature_celsius",
+	"outsidetemperature": "outside_temperature_celsius",
+	"outtemp":            "outside_temperature_celsius",
+	"temperature":        "outside_temperature_celsius",
+	"indoortemperature":  "indoor_temperature_celsius",
+	"insidetemperature":  "indoor_temperature_celsius",
+	"intemp":             "indoor_temperature_celsius",
+	"dewpoint":           "dewpoint_celsius",
+	"windchill":          "windchill_celsius",
+	"outdoorhumidity":    "outside_relative_humidity",
+	"outsidehumidity":    "outside_relative_humidity",
+	"outhumi":            "outside_relative_humidity",
+	"humidity":           "outside_relative_humidity",
+	"indoorhumidity":     "indoor_relative_humidity",
+	"insidehumidity":     "indoor_relative_humidity",
+	"inhumi":             "indoor_relative_humidity",
+	"relpressure":        "relative_atmospheric_pressure_pascal",
+	"relativepressure":   "relative_atmospheric_pressure_pascal",
+	"relbaro":            "relative_atmospheric_pressure_pascal",
+	"abspressure":        "absolute_atmospheric_pressure_pascal",
+	"absolutepressure":   "absolute_atmospheric_pressure_pascal",
+	"absbaro":            "absolute_atmospheric_pressure_pascal",
+	"uv":                 "uv_index",
+	"uvi":                "uv_index",
+	"uvindex":            "uv_index",
+	"solarrad":           "solar_radiation_watt_per_meter_squared",
+	"solarradiation":     "solar_radiation_watt_per_meter_squared",
+	"winddirection":      "wind_direction_degrees",
+	"winddir":            "wind_direction_degrees",
+	"wind":               "wind_speed_meters_per_second",
+	"windspeed":          "wind_speed_meters_per_second",
+	"gust":               "wind_gust_meters_per_second",
+	"windgust":           "wind_gust_meters_per_second",
+	"hourlyrain":         "hourly_rain_millimeters",
+	"dailyrain":          "daily_rain_millimeters",
+	"weeklyrain":         "weekly_rain_millimeters",
+	"monthlyrain":        "monthly_rain_millimeters",
+}
+
+// splitHeader splits a header such as "Outdoor Temperature(℃)" into the name and the unit.
+func splitHeader(header string) (string, string) {
+	header = strings.TrimSpace(header)
+
+	for _, brackets := range []string{"()", "[]"} {
+		if strings.HasSuffix(header, brackets[1:]) {
+			if i := strings.LastIndex(header, brackets[:1]); i > 0 {
+				return strings.TrimSpace(header[:i]), strings.TrimSpace(header[i+1 : len(header)-1])
+			}
+		}
+	}
+
+	return header, ""
+}
+
+func normalizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// detectField returns the observation field of a column header, or an empty string if it is not detected.
+func detectField(name string) string {
+	if _, ok := fieldQuantities[name]; ok {
+		return name
+	}
+
+	return columnNames[normalizeName(name)]
+}
+
+func isTimeColumn(name string) bool {
+	normalized := normalizeName(name)
+	for _, timeColumnName := range timeColumnNames {
+		if normalized == timeColumnName {
+			return true
+		}
+	}
+
+	return false
+}
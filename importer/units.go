@@ -0,0 +1,151 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// quantity is the physical quantity of an observation field, which determines the units a column can be in
+type quantity string
+
+const (
+	quantityTemperature quantity = "temperature"
+	quantityHumidity    quantity = "humidity"
+	quantityPressure    quantity = "pressure"
+	quantitySpeed       quantity = "speed"
+	quantityDirection   quantity = "direction"
+	quantityRain        quantity = "rain"
+	quantityRadiation   quantity = "radiation"
+	quantityUVIndex     quantity = "uv_index"
+)
+
+// fieldQuantities contains the quantities of the observation fields that can be imported, by JSON name
+var fieldQuantities = map[string]quantity{
+	"outside_temperature_celsius":            quantityTemperature,
+	"indoor_temperature_celsius":             quantityTemperature,
+	"dewpoint_celsius":                       quantityTemperature,
+	"windchill_celsius":                      quantityTemperature,
+	"outside_relative_humidity":              quantityHumidity,
+	"indoor_relative_humidity":               quantityHumidity,
+	"relative_atmospheric_pressure_pascal":   quantityPressure,
+	"absolute_atmospheric_pressure_pascal":   quantityPressure,
+	"uv_index":                               quantityUVIndex,
+	"solar_radiation_watt_per_meter_squared": quantityRadiation,
+	"wind_direction_degrees":                 quantityDirection,
+	"wind_speed_meters_per_second":           quantitySpeed,
+	"wind_gust_meters_per_second":            quantitySpeed,
+	"hourly_rain_millimeters":                quantityRain,
+	"daily_rain_millimeters":                 quantityRain,
+	"weekly_rain_millimeters":                quantityRain,
+	"monthly_rain_millimeters":               quantityRain,
+}
+
+// units contains the conversions of all supported units to the unit of the observation fields, by quantity and
+// normalized unit name.
+var units = map[quantity]map[string]func(float64) float64{
+	quantityTemperature: {
+		"c": identity,
+		"f": func(v float64) float64 { return (v - 32.0) * 5.0 / 9.0 },
+		"k": func(v float64) float64 { return v - 273.15 },
+	},
+	quantityHumidity: {
+		"%": identity,
+	},
+	quantityPressure: {
+		"pa":   identity,
+		"hpa":  func(v float64) float64 { return v * 100 },
+		"mbar": func(v float64) float64 { return v * 100 },
+		"kpa":  func(v float64) float64 { return v * 1000 },
+		"inhg": func(v float64) float64 { return v * 3386 },
+		"mmhg": func(v float64) float64 { return v * 133.322 },
+	},
+	quantitySpeed: {
+		"m/s":  identity,
+		"km/h": func(v float64) float64 { return v / 3.6 },
+		"mph":  func(v float64) float64 { return v * 0.44704 },
+		"knot": func(v float64) float64 { return v * 0.514444 },
+		"ft/s": func(v float64) float64 { return v * 0.3048 },
+	},
+	quantityDirection: {
+		"°": identity,
+	},
+	quantityRain: {
+		"mm": identity,
+		"in": func(v float64) float64 { return v * 25.4 },
+	},
+	quantityRadiation: {
+		"w/m2": identity,
+		// The same approximation for sunlight as used by Ecowitt consoles
+		"lux": func(v float64) float64 { return v / 126.7 },
+	},
+	quantityUVIndex: {
+		"": identity,
+	},
+}
+
+// unitAliases maps the ways units are written in exports to the names used in units
+var unitAliases = map[string]string{
+	"℃":          "c",
+	"°c":         "c",
+	"celsius":    "c",
+	"℉":          "f",
+	"°f":         "f",
+	"fahrenheit": "f",
+	"kelvin":     "k",
+	"percent":    "%",
+	"mb":         "mbar",
+	"in/hg":      "inhg",
+	"inch hg":    "inhg",
+	"mm hg":      "mmhg",
+	"kmh":        "km/h",
+	"kph":        "km/h",
+	"m/sec":      "m/s",
+	"mps":        "m/s",
+	"knots":      "knot",
+	"kn":         "knot",
+	"kt":         "knot",
+	"fps":        "ft/s",
+	"deg":        "°",
+	"degrees":    "°",
+	"inch":       "in",
+	"inches":     "in",
+	"w/m²":       "w/m2",
+	"w/㎡":        "w/m2",
+	"wm2":        "w/m2",
+	"lx":         "lux",
+	"uvi":        "",
+	"index":      "",
+}
+
+func identity(v float64) float64 {
+	return v
+}
+
+func normalizeUnit(unit string) string {
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	if alias, ok := unitAliases[unit]; ok {
+		return alias
+	}
+
+	return unit
+}
+
+// conversion returns the function converting values of the field in the given unit to the unit of the field. An empty
+// unit means the column is in the unit of the field.
+func conversion(field string, unit string) (func(float64) float64, error) {
+	q, ok := fieldQuantities[field]
+	if !ok {
+		return nil, fmt.Errorf("field %s cannot be imported", field)
+	}
+
+	if unit == "" {
+		return identity, nil
+	}
+
+	convert, ok := units[q][normalizeUnit(unit)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s unit %q for field %s", q, unit, field)
+	}
+
+	return convert, nil
+}
@@ -2,39 +2,174 @@ package influx
 
 import (
 	"fmt"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/koesie10/ws-upload/rotate"
 	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
 )
 
+const DebugPublisherType = "influx_debug"
+
 var _ wsupload.Publisher = (*debugPublisher)(nil)
+var _ wsupload.StatefulPublisher = (*debugPublisher)(nil)
+
+func init() {
+	wsupload.RegisterPublisher(wsupload.PublisherFactory{
+		Type: DebugPublisherType,
+		NewOptions: func() interface{} {
+			options := DefaultDebugPublisherOptions()
+			return &options
+		},
+		New: func(logger *zap.Logger, options interface{}) (wsupload.Publisher, error) {
+			return NewDebugPublisher(logger, *options.(*DebugPublisherOptions))
+		},
+	})
+}
 
+// debugPublisher writes line protocol with millisecond precision to stdout, or to a file that can be imported into
+// InfluxDB later.
 type debugPublisher struct {
-	options DebugPublisherOptions
+	logger *zap.Logger
+	schema *Schema
+
+	path        string
+	fileOptions rotate.Options
+
+	mu   sync.Mutex
+	file *rotate.Writer
+	// replacement is the publisher that took over the file of this publisher, observations are published to it
+	replacement *debugPublisher
 }
 
-func NewDebugPublisher(options DebugPublisherOptions) (wsupload.Publisher, error) {
-	return &debugPublisher{
-		options: options,
-	}, nil
+func NewDebugPublisher(logger *zap.Logger, options DebugPublisherOptions) (wsupload.Publisher, error) {
+	schema, err := NewSchema(options.MeasurementName, options.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	p := &debugPublisher{
+		logger: logger,
+		schema: schema,
+
+		path: options.File.Path,
+		fileOptions: rotate.Options{
+			MaxSize:  int64(options.File.MaxSize),
+			Daily:    options.File.RotateDaily,
+			Compress: options.File.Compress,
+		},
+	}
+
+	if p.path != "" {
+		p.file, err = rotate.NewWriter(logger, p.path, p.fileOptions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open line protocol file: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+func DefaultDebugPublisherOptions() DebugPublisherOptions {
+	return DebugPublisherOptions{
+		MeasurementName: "weather",
+		Schema:          DefaultSchemaOptions(),
+	}
 }
 
 type DebugPublisherOptions struct {
 	MeasurementName string `env:"MEASUREMENT_NAME" flag:"measurement-name" desc:"InfluxDB measurement name"`
+
+	Schema SchemaOptions    `env:",squash" flag:"schema"`
+	File   DebugFileOptions `env:",squash" flag:"file"`
+}
+
+type DebugFileOptions struct {
+	Path        string `env:"INFLUX_DEBUG_FILE_PATH" flag:"path" desc:"file to append line protocol to instead of printing it, rotated files are renamed to include the time of rotation"`
+	MaxSize     uint   `env:"INFLUX_DEBUG_FILE_MAX_SIZE" flag:"max-size" desc:"size in bytes after which the line protocol file is rotated, set to 0 to disable"`
+	RotateDaily bool   `env:"INFLUX_DEBUG_FILE_ROTATE_DAILY" flag:"rotate-daily" desc:"rotate the line protocol file every day (UTC)"`
+	Compress    bool   `env:"INFLUX_DEBUG_FILE_COMPRESS" flag:"compress" desc:"compress rotated line protocol files using gzip"`
+	MaxFiles    uint   `env:"INFLUX_DEBUG_FILE_MAX_FILES" flag:"max-files" desc:"number of rotated line protocol files to keep, the oldest files are removed, set to 0 to keep all files"`
 }
 
 func (p *debugPublisher) Publish(obs *wsupload.Observation) error {
-	point, err := CreatePoint(obs, p.options.MeasurementName)
+	p.mu.Lock()
+	replacement, file := p.replacement, p.file
+	p.mu.Unlock()
+
+	if replacement != nil {
+		return replacement.Publish(obs)
+	}
+
+	if file != nil {
+		line, err := p.schema.LineProtocol(obs, time.Millisecond)
+		if err != nil {
+			return err
+		}
+
+		if _, err := file.Write(line); err != nil {
+			return fmt.Errorf("failed to write line protocol: %w", err)
+		}
+
+		return nil
+	}
+
+	points, err := p.schema.Points(obs)
 	if err != nil {
-		return fmt.Errorf("failed to create point: %w", err)
+		return fmt.Errorf("failed to create points: %w", err)
 	}
 
-	fmt.Printf("INFLUX DEBUG: %s", write.PointToLineProtocol(point, time.Millisecond))
+	for _, point := range points {
+		fmt.Printf("INFLUX DEBUG: %s", write.PointToLineProtocol(point, time.Millisecond))
+	}
 
 	return nil
 }
 
+// TakeState takes over the file of the previous publisher if both write to the same file, so the file is never
+// written and rotated by two writers at once. The file opened by this publisher is closed before anything is written
+// to it, and the rotation options of this publisher are used from then on.
+func (p *debugPublisher) TakeState(previous wsupload.Publisher) {
+	prev, ok := previous.(*debugPublisher)
+	if !ok {
+		return
+	}
+
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if prev.file == nil || p.file == nil || filepath.Clean(prev.path) != filepath.Clean(p.path) {
+		return
+	}
+
+	if err := p.file.Close(); err != nil {
+		p.logger.Error("Failed to close line protocol file", zap.Error(err))
+	}
+
+	p.file = prev.file
+	p.file.SetOptions(p.fileOptions)
+	prev.file = nil
+	prev.replacement = p
+}
+
 func (p *debugPublisher) Close() error {
+	p.mu.Lock()
+	file := p.file
+	p.file = nil
+	p.mu.Unlock()
+
+	if file != nil {
+		return file.Close()
+	}
+
 	return nil
 }
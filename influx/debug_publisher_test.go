@@ -0,0 +1,74 @@
+package influx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+func TestDebugPublisherTakeState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "influx.lp")
+
+	options := DefaultDebugPublisherOptions()
+	options.File.Path = path
+
+	previous, err := NewDebugPublisher(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obs := func(i int) *wsupload.Observation {
+		return &wsupload.Observation{
+			StationID:                 "station",
+			ObservationTime:           time.Date(2024, 6, 1, 12, i, 0, 0, time.UTC),
+			OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: float64(i)},
+		}
+	}
+
+	if err := previous.Publish(obs(0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new options apply to the file taken over from the previous publisher
+	options.File.MaxSize = 1 << 20
+	p, err := NewDebugPublisher(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.(wsupload.StatefulPublisher).TakeState(previous)
+
+	// Observations published to the previous publisher are written by the new publisher
+	if err := previous.Publish(obs(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := previous.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Publish(obs(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files, want 1", len(entries))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 3 {
+		t.Errorf("got %d lines, want 3:\n%s", len(lines), data)
+	}
+}
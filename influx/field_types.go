@@ -0,0 +1,124 @@
+package influx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+)
+
+// fieldTypeCheckRange is how far back the existing field types are queried
+const fieldTypeCheckRange = 30 * 24 * time.Hour
+
+// fieldTypeCheckTimeout is the timeout of the query for the existing field types
+const fieldTypeCheckTimeout = 30 * time.Second
+
+// warnFieldTypeConflicts logs a warning for every field of the schema whose type differs from the type of the existing
+// values of the field. Writes of such fields are rejected by InfluxDB.
+func warnFieldTypeConflicts(logger *zap.Logger, schema *Schema, existing []SchemaField) {
+	existingTypes := make(map[string][]string)
+	for _, field := range existing {
+		key := field.Measurement + " " + field.Field
+		existingTypes[key] = append(existingTypes[key], string(field.Type))
+	}
+
+	for _, field := range schema.Fields() {
+		types := existingTypes[field.Measurement+" "+field.Field]
+
+		var conflict bool
+		for _, t := range types {
+			if t != string(field.Type) {
+				conflict = true
+			}
+		}
+		if !conflict {
+			continue
+		}
+
+		sort.Strings(types)
+
+		logger.Warn(
+			"Field type differs from the type of existing values, writes of this field will be rejected by InfluxDB",
+			zap.String("influx.measurement", field.Measurement),
+			zap.String("influx.field", field.Field),
+			zap.String("influx.type", string(field.Type)),
+			zap.Strings("influx.existing_types", types),
+		)
+	}
+}
+
+// measurementNames returns the names of all measurements of the schema.
+func measurementNames(schema *Schema) []string {
+	seen := make(map[string]struct{})
+	var names []string
+
+	for _, field := range schema.Fields() {
+		if _, ok := seen[field.Measurement]; ok {
+			continue
+		}
+		seen[field.Measurement] = struct{}{}
+		names = append(names, field.Measurement)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// queryFieldTypes returns the types of the values of the fields of the schema in the bucket.
+func queryFieldTypes(ctx context.Context, queryAPI api.QueryAPI, bucket string, schema *Schema) ([]SchemaField, error) {
+	measurements := measurementNames(schema)
+
+	quoted := make([]string, len(measurements))
+	for i, name := range measurements {
+		quoted[i] = strconv.Quote(name)
+	}
+
+	query := fmt.Sprintf(`from(bucket: %s)
+  |> range(start: -%dh)
+  |> filter(fn: (r) => contains(value: r._measurement, set: [%s]))
+  |> last()`, strconv.Quote(bucket), int(fieldTypeCheckRange.Hours()), strings.Join(quoted, ", "))
+
+	result, err := queryAPI.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query field types: %w", err)
+	}
+	defer result.Close()
+
+	var fields []SchemaField
+	for result.Next() {
+		record := result.Record()
+
+		fields = append(fields, SchemaField{
+			Measurement: record.Measurement(),
+			Field:       record.Field(),
+			Type:        valueType(record.Value()),
+		})
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query field types: %w", err)
+	}
+
+	return fields, nil
+}
+
+func valueType(value interface{}) wsupload.InfluxType {
+	switch value.(type) {
+	case float64:
+		return wsupload.InfluxTypeFloat
+	case int64:
+		return wsupload.InfluxTypeInt
+	case bool:
+		return wsupload.InfluxTypeBool
+	case string:
+		return wsupload.InfluxTypeString
+	default:
+		return wsupload.InfluxType(fmt.Sprintf("%T", value))
+	}
+}
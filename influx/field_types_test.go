@@ -0,0 +1,169 @@
+package influx
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestConvertFieldValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		t       wsupload.InfluxType
+		want    interface{}
+		wantErr bool
+	}{
+		{"float to float", 21.5, wsupload.InfluxTypeFloat, 21.5, false},
+		{"float to int", 21.5, wsupload.InfluxTypeInt, int64(22), false},
+		{"negative float to int", -21.5, wsupload.InfluxTypeInt, int64(-22), false},
+		{"float to bool", 0.5, wsupload.InfluxTypeBool, true, false},
+		{"zero float to bool", 0.0, wsupload.InfluxTypeBool, false, false},
+		{"float to string", 21.5, wsupload.InfluxTypeString, "21.5", false},
+		{"int to float", int64(180), wsupload.InfluxTypeFloat, 180.0, false},
+		{"int to int", int64(180), wsupload.InfluxTypeInt, int64(180), false},
+		{"int to bool", int64(0), wsupload.InfluxTypeBool, false, false},
+		{"int to string", int64(180), wsupload.InfluxTypeString, "180", false},
+		{"bool to float", true, wsupload.InfluxTypeFloat, 1.0, false},
+		{"bool to int", false, wsupload.InfluxTypeInt, int64(0), false},
+		{"bool to bool", true, wsupload.InfluxTypeBool, true, false},
+		{"bool to string", true, wsupload.InfluxTypeString, "true", false},
+		{"string to float", "21.5", wsupload.InfluxTypeFloat, 21.5, false},
+		{"string to int", "180", wsupload.InfluxTypeInt, int64(180), false},
+		{"string to bool", "true", wsupload.InfluxTypeBool, true, false},
+		{"string to string", "EasyWeather", wsupload.InfluxTypeString, "EasyWeather", false},
+		{"invalid string to float", "EasyWeather", wsupload.InfluxTypeFloat, nil, true},
+		{"float string to int", "21.5", wsupload.InfluxTypeInt, nil, true},
+		{"invalid string to bool", "yes", wsupload.InfluxTypeBool, nil, true},
+		{"unsupported value", int32(1), wsupload.InfluxTypeInt, nil, true},
+		{"unsupported type", 21.5, wsupload.InfluxType("double"), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertFieldValue(tt.value, tt.t)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("convertFieldValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertFieldValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWarnFieldTypeConflicts(t *testing.T) {
+	type conflict struct {
+		measurement   string
+		field         string
+		fieldType     string
+		existingTypes []interface{}
+	}
+
+	tests := []struct {
+		name     string
+		options  func(options *SchemaOptions)
+		existing []SchemaField
+		want     []conflict
+	}{
+		{
+			name: "no existing fields",
+		},
+		{
+			name: "same types",
+			existing: []SchemaField{
+				{Measurement: "weather", Field: "outside_temperature_celsius", Type: wsupload.InfluxTypeFloat},
+				{Measurement: "weather", Field: "wind_direction_degrees", Type: wsupload.InfluxTypeInt},
+			},
+		},
+		{
+			name: "different type",
+			existing: []SchemaField{
+				{Measurement: "weather", Field: "outside_temperature_celsius", Type: wsupload.InfluxTypeFloat},
+				{Measurement: "weather", Field: "wind_direction_degrees", Type: wsupload.InfluxTypeFloat},
+			},
+			want: []conflict{
+				{"weather", "wind_direction_degrees", "int", []interface{}{"float"}},
+			},
+		},
+		{
+			name: "multiple existing types",
+			existing: []SchemaField{
+				{Measurement: "weather", Field: "wind_direction_degrees", Type: wsupload.InfluxTypeString},
+				{Measurement: "weather", Field: "wind_direction_degrees", Type: wsupload.InfluxTypeInt},
+				{Measurement: "weather", Field: "wind_direction_degrees", Type: wsupload.InfluxTypeFloat},
+			},
+			want: []conflict{
+				{"weather", "wind_direction_degrees", "int", []interface{}{"float", "int", "string"}},
+			},
+		},
+		{
+			name: "other measurement",
+			existing: []SchemaField{
+				{Measurement: "weather_hourly", Field: "wind_direction_degrees", Type: wsupload.InfluxTypeFloat},
+			},
+		},
+		{
+			name: "field type option",
+			options: func(options *SchemaOptions) {
+				options.FieldTypes = map[string]string{"wind_direction_degrees": "float"}
+			},
+			existing: []SchemaField{
+				{Measurement: "weather", Field: "wind_direction_degrees", Type: wsupload.InfluxTypeInt},
+			},
+			want: []conflict{
+				{"weather", "wind_direction_degrees", "float", []interface{}{"int"}},
+			},
+		},
+		{
+			name: "narrow layout",
+			options: func(options *SchemaOptions) {
+				options.Layout = LayoutNarrow
+				options.Measurements = map[string]string{"outside_temperature_celsius": "temperature,sensor=outdoor"}
+			},
+			existing: []SchemaField{
+				{Measurement: "temperature", Field: "value", Type: wsupload.InfluxTypeString},
+				{Measurement: "wind_direction_degrees", Field: "value", Type: wsupload.InfluxTypeInt},
+			},
+			want: []conflict{
+				{"temperature", "value", "float", []interface{}{"string"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultSchemaOptions()
+			if tt.options != nil {
+				tt.options(&options)
+			}
+
+			schema, err := NewSchema("weather", options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			core, logs := observer.New(zapcore.WarnLevel)
+			warnFieldTypeConflicts(zap.New(core), schema, tt.existing)
+
+			var got []conflict
+			for _, entry := range logs.All() {
+				fields := entry.ContextMap()
+				got = append(got, conflict{
+					measurement:   fields["influx.measurement"].(string),
+					field:         fields["influx.field"].(string),
+					fieldType:     fields["influx.type"].(string),
+					existingTypes: fields["influx.existing_types"].([]interface{}),
+				})
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got conflicts %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
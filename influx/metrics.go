@@ -0,0 +1,20 @@
+package influx
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pointsWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "influx_points_written_total",
+		Help:      "Number of points queued for writing to InfluxDB",
+		Namespace: "ws_upload",
+	}, []string{"addr", "bucket"})
+
+	writeErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "influx_write_errors_total",
+		Help:      "Number of failed writes to InfluxDB, including writes that are retried",
+		Namespace: "ws_upload",
+	}, []string{"addr", "bucket"})
+)
@@ -2,82 +2,409 @@ package influx
 
 import (
 	"fmt"
-	"reflect"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/fatih/structtag"
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/koesie10/ws-upload/wsupload"
-	"github.com/koesie10/ws-upload/x"
 )
 
-func CreatePoint(obs *wsupload.Observation, measurementName string) (*write.Point, error) {
-	fields := make(map[string]interface{})
-	tags := make(map[string]string)
+const (
+	// LayoutWide writes a single point per observation containing all fields
+	LayoutWide = "wide"
+	// LayoutNarrow writes a point per field, each in its own measurement with a single value field
+	LayoutNarrow = "narrow"
+)
 
-	var ts time.Time
+func DefaultSchemaOptions() SchemaOptions {
+	return SchemaOptions{
+		Layout:     LayoutWide,
+		ValueField: "value",
+	}
+}
 
-	v := reflect.ValueOf(obs)
-	reflectValue := v.Elem()
+type SchemaOptions struct {
+	Tags         map[string]string `env:"INFLUX_TAGS" flag:"tags" desc:"static tags added to every point, as name=value pairs"`
+	Layout       string            `env:"INFLUX_LAYOUT" flag:"layout" desc:"wide to write all fields in a single point, or narrow to write a point per field"`
+	FieldNames   map[string]string `env:"INFLUX_FIELD_NAMES" flag:"field-names" desc:"InfluxDB names of fields, as JSON name=InfluxDB name pairs"`
+	FieldTypes   map[string]string `env:"INFLUX_FIELD_TYPES" flag:"field-types" desc:"types of fields to use instead of the default types, as JSON name=float, int, bool or string pairs"`
+	Measurements map[string]string `env:"INFLUX_MEASUREMENTS" flag:"measurements" desc:"measurement and tags of fields in the narrow layout, as JSON name=measurement,tag=value pairs"`
+	ValueField   string            `env:"INFLUX_VALUE_FIELD" flag:"value-field" desc:"name of the value field in the narrow layout"`
+}
 
-	for i := 0; i < reflectValue.NumField(); i++ {
-		fieldValueType := reflectValue.Field(i)
-		fieldValue := fieldValueType.Interface()
-		field := reflectValue.Type().Field(i)
+// Schema converts observations to points according to the schema options.
+type Schema struct {
+	measurementName string
+	layout          string
+	valueField      string
+	tags            map[string]string
+	stationIDTag    string
+	aggregateTag    string
 
-		tag, err := structtag.Parse(string(field.Tag))
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse struct tag for %s: %w", field.Name, err)
+	// fieldNames contains the names of all fields written as InfluxDB fields, by JSON name
+	fieldNames map[string]string
+	// fieldTypes contains the types of all fields written as InfluxDB fields, by JSON name
+	fieldTypes map[string]wsupload.InfluxType
+	// measurements contains the measurement and tags of the fields in the narrow layout, by JSON name
+	measurements map[string]narrowMeasurement
+}
+
+type narrowMeasurement struct {
+	name string
+	tags map[string]string
+}
+
+func NewSchema(measurementName string, options SchemaOptions) (*Schema, error) {
+	s := &Schema{
+		measurementName: measurementName,
+		layout:          options.Layout,
+		valueField:      options.ValueField,
+		tags:            options.Tags,
+		fieldNames:      make(map[string]string),
+		fieldTypes:      make(map[string]wsupload.InfluxType),
+		measurements:    make(map[string]narrowMeasurement),
+	}
+
+	switch s.layout {
+	case LayoutWide:
+		if measurementName == "" {
+			return nil, fmt.Errorf("measurement name is required for the %s layout", LayoutWide)
 		}
+	case LayoutNarrow:
+		if s.valueField == "" {
+			return nil, fmt.Errorf("value field is required for the %s layout", LayoutNarrow)
+		}
+	default:
+		return nil, fmt.Errorf("invalid layout %q, use %s or %s", s.layout, LayoutWide, LayoutNarrow)
+	}
 
-		influxTag, _ := tag.Get("influx")
-		jsonTag, _ := tag.Get("json")
+	for _, field := range wsupload.ObservationSchema.Fields {
+		if field.Influx == nil {
+			continue
+		}
 
-		if influxTag != nil && influxTag.Name == "ts" {
-			if !ts.IsZero() {
-				return nil, fmt.Errorf("multiple timestamps found for %s", field.Name)
+		if field.Influx.Role == wsupload.InfluxRoleTag {
+			if _, ok := s.tags[field.Influx.Name]; ok {
+				return nil, fmt.Errorf("static tag %s conflicts with the tag of field %s", field.Influx.Name, field.JSONName)
 			}
 
-			ts = fieldValue.(time.Time)
+			switch field.Name {
+			case "StationID":
+				s.stationIDTag = field.Influx.Name
+			case "Aggregate":
+				s.aggregateTag = field.Influx.Name
+			}
+		}
 
-			continue
+		if field.Influx.Role == wsupload.InfluxRoleField {
+			s.fieldNames[field.JSONName] = field.Influx.Name
+			s.fieldTypes[field.JSONName] = field.Influx.Type
 		}
+	}
 
-		var fieldName string
-		var options map[string]string
-		if jsonTag != nil {
-			fieldName = jsonTag.Name
+	for jsonName, name := range options.FieldNames {
+		if _, ok := s.fieldNames[jsonName]; !ok {
+			return nil, fmt.Errorf("unknown field %s in field names", jsonName)
 		}
-		if influxTag != nil {
-			fieldName = influxTag.Name
-			options = x.ParseStructTagOptions(influxTag.Options)
+		if name == "" {
+			return nil, fmt.Errorf("empty field name for field %s", jsonName)
 		}
 
-		if fieldName == "" || fieldName == "-" {
-			fmt.Println("skipping")
-			continue
+		s.fieldNames[jsonName] = name
+	}
+
+	for jsonName, v := range options.FieldTypes {
+		if _, ok := s.fieldTypes[jsonName]; !ok {
+			return nil, fmt.Errorf("unknown field %s in field types", jsonName)
 		}
 
-		if _, ok := options["tag"]; ok {
-			tags[fieldName] = fieldValueType.String()
-			continue
+		t, err := wsupload.ParseInfluxType(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type for field %s: %w", jsonName, err)
+		}
+
+		s.fieldTypes[jsonName] = t
+	}
+
+	for jsonName, spec := range options.Measurements {
+		if _, ok := s.fieldNames[jsonName]; !ok {
+			return nil, fmt.Errorf("unknown field %s in measurements", jsonName)
 		}
 
-		if v, ok := fieldValue.(wsupload.Nullable); ok {
-			if v.IsNull() {
-				continue
+		measurement, err := parseNarrowMeasurement(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid measurement for field %s: %w", jsonName, err)
+		}
+
+		s.measurements[jsonName] = measurement
+	}
+
+	// Every field must be written to its own series, and fields written to the same InfluxDB field must have the same
+	// type, otherwise InfluxDB rejects the writes
+	series := make(map[string]string)
+	types := make(map[string]string)
+	for jsonName, field := range s.fields() {
+		key := field.Measurement + " " + field.Field
+		seriesKey := key + " " + fmt.Sprint(s.measurements[jsonName].tags)
+
+		if other, ok := series[seriesKey]; ok {
+			return nil, fmt.Errorf("fields %s and %s are both written to field %s of measurement %s", other, jsonName, field.Field, field.Measurement)
+		}
+		series[seriesKey] = jsonName
+
+		if other, ok := types[key]; ok && s.fieldTypes[other] != field.Type {
+			return nil, fmt.Errorf("fields %s and %s are both written to field %s of measurement %s with different types", other, jsonName, field.Field, field.Measurement)
+		}
+		types[key] = jsonName
+	}
+
+	return s, nil
+}
+
+// SchemaField is a field as written to InfluxDB
+type SchemaField struct {
+	Measurement string
+	Field       string
+	Type        wsupload.InfluxType
+}
+
+// Fields returns all fields that can be written by the schema.
+func (s *Schema) Fields() []SchemaField {
+	fields := make([]SchemaField, 0, len(s.fieldNames))
+	for _, field := range s.fields() {
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+// fields returns all fields that can be written by the schema, by JSON name.
+func (s *Schema) fields() map[string]SchemaField {
+	fields := make(map[string]SchemaField, len(s.fieldNames))
+
+	for jsonName, name := range s.fieldNames {
+		field := SchemaField{
+			Measurement: s.measurementName,
+			Field:       name,
+			Type:        s.fieldTypes[jsonName],
+		}
+
+		if s.layout == LayoutNarrow {
+			field.Measurement = name
+			if measurement, ok := s.measurements[jsonName]; ok {
+				field.Measurement = measurement.name
 			}
+			field.Field = s.valueField
+		}
+
+		fields[jsonName] = field
+	}
+
+	return fields
+}
+
+// parseNarrowMeasurement parses a measurement with optional tags in the same format as line protocol, for example
+// temperature,sensor=outdoor. Escaping is not supported.
+func parseNarrowMeasurement(spec string) (narrowMeasurement, error) {
+	parts := strings.Split(spec, ",")
+
+	measurement := narrowMeasurement{
+		name: parts[0],
+		tags: make(map[string]string, len(parts)-1),
+	}
+	if measurement.name == "" {
+		return measurement, fmt.Errorf("empty measurement name in %q", spec)
+	}
 
-			fieldValue = v.Value()
+	for _, part := range parts[1:] {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || key == "" || value == "" {
+			return measurement, fmt.Errorf("invalid tag %q in %q, use name=value", part, spec)
 		}
 
-		fields[fieldName] = fieldValue
+		measurement.tags[key] = value
+	}
+
+	return measurement, nil
+}
+
+// Points converts the observation to points. Fields without a value are not written.
+func (s *Schema) Points(obs *wsupload.Observation) ([]*write.Point, error) {
+	fields := make(map[string]interface{})
+	tags := make(map[string]string, len(s.tags)+1)
+
+	for k, v := range s.tags {
+		tags[k] = v
+	}
+
+	var ts time.Time
+
+	for _, field := range wsupload.ObservationSchema.Fields {
+		if field.Influx == nil {
+			continue
+		}
+
+		fieldValueType := field.Value(obs)
+
+		switch field.Influx.Role {
+		case wsupload.InfluxRoleTimestamp:
+			ts = fieldValueType.Interface().(time.Time)
+		case wsupload.InfluxRoleTag:
+			if v := fieldValueType.String(); v != "" {
+				tags[field.Influx.Name] = v
+			}
+		default:
+			fieldValue := fieldValueType.Interface()
+
+			if v, ok := fieldValue.(wsupload.Nullable); ok {
+				if v.IsNull() {
+					continue
+				}
+
+				fieldValue = v.Value()
+			}
+
+			fieldValue, err := convertFieldValue(fieldValue, s.fieldTypes[field.JSONName])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for field %s: %w", field.JSONName, err)
+			}
+
+			fields[field.JSONName] = fieldValue
+		}
 	}
 
 	if ts.IsZero() {
 		ts = time.Now()
 	}
 
-	return influxdb2.NewPoint(measurementName, tags, fields, ts), nil
+	if s.layout == LayoutWide {
+		namedFields := make(map[string]interface{}, len(fields))
+		for jsonName, value := range fields {
+			namedFields[s.fieldNames[jsonName]] = value
+		}
+
+		return []*write.Point{influxdb2.NewPoint(s.measurementName, tags, namedFields, ts)}, nil
+	}
+
+	points := make([]*write.Point, 0, len(fields))
+
+	// Iterate over the schema instead of the fields map to write the points in a stable order
+	for _, field := range wsupload.ObservationSchema.Fields {
+		value, ok := fields[field.JSONName]
+		if !ok {
+			continue
+		}
+
+		measurement, ok := s.measurements[field.JSONName]
+		if !ok {
+			measurement.name = s.fieldNames[field.JSONName]
+		}
+
+		pointTags := make(map[string]string, len(tags)+len(measurement.tags))
+		for k, v := range tags {
+			pointTags[k] = v
+		}
+		for k, v := range measurement.tags {
+			pointTags[k] = v
+		}
+
+		points = append(points, influxdb2.NewPoint(measurement.name, pointTags, map[string]interface{}{
+			s.valueField: value,
+		}, ts))
+	}
+
+	return points, nil
+}
+
+// CreatePoint converts the observation to a single point using the default schema, which writes all fields to the
+// measurement.
+func CreatePoint(obs *wsupload.Observation, measurementName string) (*write.Point, error) {
+	schema, err := NewSchema(measurementName, DefaultSchemaOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := schema.Points(obs)
+	if err != nil {
+		return nil, err
+	}
+
+	return points[0], nil
+}
+
+// LineProtocol returns the observation as line protocol, with a trailing newline after every line.
+func (s *Schema) LineProtocol(obs *wsupload.Observation, precision time.Duration) ([]byte, error) {
+	points, err := s.Points(obs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create points: %w", err)
+	}
+
+	var b strings.Builder
+	for _, point := range points {
+		b.WriteString(write.PointToLineProtocol(point, precision))
+	}
+
+	return []byte(b.String()), nil
+}
+
+// convertFieldValue converts a field value to the InfluxDB type of the field. Floats are rounded when converted to
+// integers.
+func convertFieldValue(value interface{}, t wsupload.InfluxType) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		switch t {
+		case wsupload.InfluxTypeFloat:
+			return v, nil
+		case wsupload.InfluxTypeInt:
+			return int64(math.Round(v)), nil
+		case wsupload.InfluxTypeBool:
+			return v != 0, nil
+		case wsupload.InfluxTypeString:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+	case int64:
+		switch t {
+		case wsupload.InfluxTypeFloat:
+			return float64(v), nil
+		case wsupload.InfluxTypeInt:
+			return v, nil
+		case wsupload.InfluxTypeBool:
+			return v != 0, nil
+		case wsupload.InfluxTypeString:
+			return strconv.FormatInt(v, 10), nil
+		}
+	case bool:
+		switch t {
+		case wsupload.InfluxTypeFloat:
+			if v {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		case wsupload.InfluxTypeInt:
+			if v {
+				return int64(1), nil
+			}
+			return int64(0), nil
+		case wsupload.InfluxTypeBool:
+			return v, nil
+		case wsupload.InfluxTypeString:
+			return strconv.FormatBool(v), nil
+		}
+	case string:
+		switch t {
+		case wsupload.InfluxTypeFloat:
+			return strconv.ParseFloat(v, 64)
+		case wsupload.InfluxTypeInt:
+			return strconv.ParseInt(v, 10, 64)
+		case wsupload.InfluxTypeBool:
+			return strconv.ParseBool(v)
+		case wsupload.InfluxTypeString:
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("cannot convert %T to %s", value, t)
 }
@@ -0,0 +1,252 @@
+package influx
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+func TestNewSchema(t *testing.T) {
+	tests := []struct {
+		name            string
+		measurementName string
+		options         func(options *SchemaOptions)
+		wantErr         bool
+	}{
+		{"default", "weather", nil, false},
+		{"wide without measurement name", "", nil, true},
+		{"narrow without measurement name", "", func(options *SchemaOptions) {
+			options.Layout = LayoutNarrow
+		}, false},
+		{"narrow without value field", "weather", func(options *SchemaOptions) {
+			options.Layout = LayoutNarrow
+			options.ValueField = ""
+		}, true},
+		{"invalid layout", "weather", func(options *SchemaOptions) {
+			options.Layout = "tall"
+		}, true},
+		{"static tags", "weather", func(options *SchemaOptions) {
+			options.Tags = map[string]string{"location": "garden", "site": "home"}
+		}, false},
+		{"static tag conflicts with station ID", "weather", func(options *SchemaOptions) {
+			options.Tags = map[string]string{"station_id": "station"}
+		}, true},
+		{"field names", "weather", func(options *SchemaOptions) {
+			options.FieldNames = map[string]string{"outside_temperature_celsius": "temperature"}
+		}, false},
+		{"unknown field in field names", "weather", func(options *SchemaOptions) {
+			options.FieldNames = map[string]string{"temperature": "temperature"}
+		}, true},
+		{"tag in field names", "weather", func(options *SchemaOptions) {
+			options.FieldNames = map[string]string{"station_id": "station"}
+		}, true},
+		{"empty field name", "weather", func(options *SchemaOptions) {
+			options.FieldNames = map[string]string{"outside_temperature_celsius": ""}
+		}, true},
+		{"field names conflict", "weather", func(options *SchemaOptions) {
+			options.FieldNames = map[string]string{"indoor_temperature_celsius": "outside_temperature_celsius"}
+		}, true},
+		{"field types", "weather", func(options *SchemaOptions) {
+			options.FieldTypes = map[string]string{"wind_direction_degrees": "float"}
+		}, false},
+		{"unknown field in field types", "weather", func(options *SchemaOptions) {
+			options.FieldTypes = map[string]string{"temperature": "float"}
+		}, true},
+		{"invalid field type", "weather", func(options *SchemaOptions) {
+			options.FieldTypes = map[string]string{"wind_direction_degrees": "double"}
+		}, true},
+		{"narrow measurements with different tags", "", func(options *SchemaOptions) {
+			options.Layout = LayoutNarrow
+			options.Measurements = map[string]string{
+				"outside_temperature_celsius": "temperature,sensor=outdoor",
+				"indoor_temperature_celsius":  "temperature,sensor=indoor",
+			}
+		}, false},
+		{"narrow measurements with the same tags", "", func(options *SchemaOptions) {
+			options.Layout = LayoutNarrow
+			options.Measurements = map[string]string{
+				"outside_temperature_celsius": "temperature,sensor=outdoor",
+				"indoor_temperature_celsius":  "temperature,sensor=outdoor",
+			}
+		}, true},
+		{"narrow measurements with different types", "", func(options *SchemaOptions) {
+			options.Layout = LayoutNarrow
+			options.Measurements = map[string]string{
+				"outside_temperature_celsius": "wind,sensor=temperature",
+				"wind_direction_degrees":      "wind,sensor=direction",
+			}
+		}, true},
+		{"narrow measurement conflicts with field name", "", func(options *SchemaOptions) {
+			options.Layout = LayoutNarrow
+			options.Measurements = map[string]string{
+				"indoor_temperature_celsius": "outside_temperature_celsius",
+			}
+		}, true},
+		{"unknown field in measurements", "", func(options *SchemaOptions) {
+			options.Layout = LayoutNarrow
+			options.Measurements = map[string]string{"temperature": "temperature"}
+		}, true},
+		{"invalid measurement", "", func(options *SchemaOptions) {
+			options.Layout = LayoutNarrow
+			options.Measurements = map[string]string{"outside_temperature_celsius": "temperature,sensor"}
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultSchemaOptions()
+			if tt.options != nil {
+				tt.options(&options)
+			}
+
+			_, err := NewSchema(tt.measurementName, options)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSchema() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseNarrowMeasurement(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    narrowMeasurement
+		wantErr bool
+	}{
+		{"temperature", narrowMeasurement{name: "temperature", tags: map[string]string{}}, false},
+		{"temperature,sensor=outdoor", narrowMeasurement{name: "temperature", tags: map[string]string{"sensor": "outdoor"}}, false},
+		{"temperature,sensor=outdoor,unit=celsius", narrowMeasurement{name: "temperature", tags: map[string]string{"sensor": "outdoor", "unit": "celsius"}}, false},
+		{"temperature,sensor=a=b", narrowMeasurement{name: "temperature", tags: map[string]string{"sensor": "a=b"}}, false},
+		{"", narrowMeasurement{}, true},
+		{",sensor=outdoor", narrowMeasurement{}, true},
+		{"temperature,", narrowMeasurement{}, true},
+		{"temperature,sensor", narrowMeasurement{}, true},
+		{"temperature,=outdoor", narrowMeasurement{}, true},
+		{"temperature,sensor=", narrowMeasurement{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseNarrowMeasurement(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNarrowMeasurement() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNarrowMeasurement() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaLineProtocol(t *testing.T) {
+	tests := []struct {
+		name            string
+		measurementName string
+		options         func(options *SchemaOptions)
+		obs             func(obs *wsupload.Observation)
+		want            string
+	}{
+		{
+			name:            "wide",
+			measurementName: "weather",
+			want:            testLine + " 1717243200\n",
+		},
+		{
+			name:            "wide with static tags and field names",
+			measurementName: "weather",
+			options: func(options *SchemaOptions) {
+				options.Tags = map[string]string{"site": "home", "location": "garden"}
+				options.FieldNames = map[string]string{"outside_temperature_celsius": "temperature", "wind_direction_degrees": "wind_direction"}
+			},
+			want: `weather,location=garden,site=home,station_id=station software_type="",temperature=21.5,wind_direction=180i 1717243200` + "\n",
+		},
+		{
+			name:            "wide with aggregate tags",
+			measurementName: "weather_hourly",
+			obs: func(obs *wsupload.Observation) {
+				obs.Aggregate = "mean"
+				obs.AggregateInterval = "1h"
+			},
+			want: `weather_hourly,aggregate=mean,aggregate_interval=1h,station_id=station outside_temperature_celsius=21.5,software_type="",wind_direction_degrees=180i 1717243200` + "\n",
+		},
+		{
+			name: "narrow",
+			options: func(options *SchemaOptions) {
+				options.Layout = LayoutNarrow
+			},
+			want: `software_type,station_id=station value="" 1717243200` + "\n" +
+				`outside_temperature_celsius,station_id=station value=21.5 1717243200` + "\n" +
+				`wind_direction_degrees,station_id=station value=180i 1717243200` + "\n",
+		},
+		{
+			name: "narrow with measurements, field names and value field",
+			options: func(options *SchemaOptions) {
+				options.Layout = LayoutNarrow
+				options.ValueField = "v"
+				options.Tags = map[string]string{"site": "home"}
+				options.FieldNames = map[string]string{"wind_direction_degrees": "wind_direction"}
+				options.Measurements = map[string]string{"outside_temperature_celsius": "temperature,sensor=outdoor"}
+			},
+			obs: func(obs *wsupload.Observation) {
+				obs.SoftwareType = "EasyWeatherV1.6.4"
+			},
+			want: `software_type,site=home,station_id=station v="EasyWeatherV1.6.4" 1717243200` + "\n" +
+				`temperature,sensor=outdoor,site=home,station_id=station v=21.5 1717243200` + "\n" +
+				`wind_direction,site=home,station_id=station v=180i 1717243200` + "\n",
+		},
+		{
+			name:            "field types",
+			measurementName: "weather",
+			options: func(options *SchemaOptions) {
+				options.FieldTypes = map[string]string{"outside_temperature_celsius": "int", "wind_direction_degrees": "float"}
+			},
+			want: `weather,station_id=station outside_temperature_celsius=22i,software_type="",wind_direction_degrees=180 1717243200` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultSchemaOptions()
+			if tt.options != nil {
+				tt.options(&options)
+			}
+
+			schema, err := NewSchema(tt.measurementName, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			obs := testObservation()
+			if tt.obs != nil {
+				tt.obs(obs)
+			}
+
+			got, err := schema.LineProtocol(obs, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(got) != tt.want {
+				t.Errorf("LineProtocol() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreatePoint(t *testing.T) {
+	point, err := CreatePoint(testObservation(), "weather")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := write.PointToLineProtocol(point, time.Second), testLine+" 1717243200\n"; got != want {
+		t.Errorf("CreatePoint() = %q, want %q", got, want)
+	}
+
+	if _, err := CreatePoint(testObservation(), ""); err == nil {
+		t.Error("expected an error without a measurement name")
+	}
+}
@@ -1,35 +1,126 @@
 package influx
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
 	"github.com/koesie10/ws-upload/wsupload"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
 )
 
+const PublisherType = "influx"
+
+// healthCheckInterval is the interval at which the InfluxDB server is pinged to check its health
+const healthCheckInterval = 30 * time.Second
+
 var _ wsupload.Publisher = (*publisher)(nil)
+var _ wsupload.HealthReporter = (*publisher)(nil)
+
+func init() {
+	wsupload.RegisterPublisher(wsupload.PublisherFactory{
+		Type: PublisherType,
+		NewOptions: func() interface{} {
+			options := DefaultPublisherOptions()
+			return &options
+		},
+		New: func(logger *zap.Logger, options interface{}) (wsupload.Publisher, error) {
+			return NewPublisher(logger, *options.(*PublisherOptions))
+		},
+	})
+}
 
 type publisher struct {
 	client   influxdb2.Client
 	writeAPI api.WriteAPI
+	logger   *zap.Logger
 
 	options PublisherOptions
+	schema  *Schema
+
+	pointsWritten prometheus.Counter
+	writeErrors   prometheus.Counter
+
+	health      *wsupload.HealthTracker
+	writeFailed atomic.Bool
+
+	done          chan struct{}
+	stopped       chan struct{}
+	errorsStopped chan struct{}
+	closeOnce     sync.Once
 }
 
-func NewPublisher(options PublisherOptions) (wsupload.Publisher, error) {
+func NewPublisher(logger *zap.Logger, options PublisherOptions) (wsupload.Publisher, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	schema, err := NewSchema(options.MeasurementName, options.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	// The client never fills a batch of size 0, and panics on a flush interval that is 0 in milliseconds
+	if options.BatchSize == 0 {
+		return nil, fmt.Errorf("batch size must be positive")
+	}
+	if options.FlushInterval < time.Millisecond {
+		return nil, fmt.Errorf("flush interval must be at least 1ms, got %s", options.FlushInterval)
+	}
+
 	influxOptions := influxdb2.DefaultOptions()
 	influxOptions.SetPrecision(time.Second)
+	influxOptions.SetBatchSize(options.BatchSize)
+	influxOptions.SetFlushInterval(uint(options.FlushInterval.Milliseconds()))
+	influxOptions.SetRetryBufferLimit(options.RetryBufferLimit)
+	influxOptions.SetMaxRetryTime(uint(options.MaxRetryTime.Milliseconds()))
 	client := influxdb2.NewClientWithOptions(options.Addr, options.AuthToken, influxOptions)
 
 	writeAPI := client.WriteAPI(options.Organization, options.Bucket)
 
-	return &publisher{
+	labels := prometheus.Labels{"addr": options.Addr, "bucket": options.Bucket}
+
+	p := &publisher{
 		client:   client,
 		writeAPI: writeAPI,
+		logger:   logger,
 		options:  options,
-	}, nil
+		schema:   schema,
+
+		pointsWritten: pointsWritten.With(labels),
+		writeErrors:   writeErrors.With(labels),
+
+		health: wsupload.NewHealthTracker(wsupload.HealthStateConnected),
+
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+		errorsStopped: make(chan struct{}),
+	}
+
+	// The error channel must be read before writing any points, otherwise errors are discarded
+	go p.handleErrors(writeAPI.Errors())
+	go p.checkHealth()
+
+	return p, nil
+}
+
+func DefaultPublisherOptions() PublisherOptions {
+	return PublisherOptions{
+		Addr:            "http://localhost:8086",
+		Bucket:          "weather",
+		MeasurementName: "weather",
+		Schema:          DefaultSchemaOptions(),
+
+		BatchSize:        5000,
+		FlushInterval:    time.Second,
+		RetryBufferLimit: 50000,
+		MaxRetryTime:     3 * time.Minute,
+	}
 }
 
 type PublisherOptions struct {
@@ -38,21 +129,104 @@ type PublisherOptions struct {
 	Organization    string `env:"INFLUX_ORGANIZATION" flag:"organization" desc:"InfluxDB organization, do not set if using InfluxDB 1.8"`
 	Bucket          string `env:"INFLUX_BUCKET" flag:"bucket" desc:"InfluxDB bucket, set to database/retention-policy or database for InfluxDB 1.8"`
 	MeasurementName string `env:"MEASUREMENT_NAME" flag:"measurement-name" desc:"InfluxDB measurement name"`
+
+	Schema SchemaOptions `env:",squash" flag:"schema"`
+
+	BatchSize        uint          `env:"INFLUX_BATCH_SIZE" flag:"batch-size" desc:"maximum number of points sent to InfluxDB in a single write"`
+	FlushInterval    time.Duration `env:"INFLUX_FLUSH_INTERVAL" flag:"flush-interval" desc:"interval at which buffered points are written to InfluxDB"`
+	RetryBufferLimit uint          `env:"INFLUX_RETRY_BUFFER_LIMIT" flag:"retry-buffer-limit" desc:"maximum number of points kept in memory for retrying failed writes, the oldest points are dropped when exceeded"`
+	MaxRetryTime     time.Duration `env:"INFLUX_MAX_RETRY_TIME" flag:"max-retry-time" desc:"maximum time to retry a failed write before dropping the points"`
 }
 
 func (p *publisher) Publish(obs *wsupload.Observation) error {
-	point, err := CreatePoint(obs, p.options.MeasurementName)
+	points, err := p.schema.Points(obs)
 	if err != nil {
-		return fmt.Errorf("failed to create point: %w", err)
+		return fmt.Errorf("failed to create points: %w", err)
 	}
 
-	p.writeAPI.WritePoint(point)
+	for _, point := range points {
+		p.writeAPI.WritePoint(point)
+	}
+	p.pointsWritten.Add(float64(len(points)))
 
 	return nil
 }
 
+// handleErrors logs and counts write errors until the error channel is closed, which happens when the client is closed.
+func (p *publisher) handleErrors(errs <-chan error) {
+	defer close(p.errorsStopped)
+
+	for err := range errs {
+		p.logger.Warn("Failed to write points to InfluxDB", zap.Error(err))
+		p.writeErrors.Inc()
+		p.writeFailed.Store(true)
+		p.health.Degraded(fmt.Errorf("failed to write points: %w", err))
+	}
+}
+
+func (p *publisher) Health() wsupload.Health {
+	return p.health.Health()
+}
+
+// checkHealth pings the InfluxDB server periodically. The publisher is considered degraded until a health check
+// interval has passed without failed writes. The field types are checked once after the first successful ping.
+func (p *publisher) checkHealth() {
+	defer close(p.stopped)
+
+	t := time.NewTicker(healthCheckInterval)
+	defer t.Stop()
+
+	var checkedFieldTypes bool
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := p.client.Ping(ctx)
+		cancel()
+
+		if err != nil {
+			p.health.Failing(fmt.Errorf("failed to ping InfluxDB: %w", err))
+		} else if !p.writeFailed.Swap(false) {
+			p.health.Connected()
+		}
+
+		if err == nil && !checkedFieldTypes {
+			p.checkFieldTypes()
+			checkedFieldTypes = true
+		}
+
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// checkFieldTypes warns about fields that are written with a different type than their existing values.
+func (p *publisher) checkFieldTypes() {
+	ctx, cancel := context.WithTimeout(context.Background(), fieldTypeCheckTimeout)
+	defer cancel()
+
+	existing, err := queryFieldTypes(ctx, p.client.QueryAPI(p.options.Organization), p.options.Bucket, p.schema)
+	if err != nil {
+		p.logger.Warn("Failed to check the field types in InfluxDB", zap.Error(err))
+		return
+	}
+
+	warnFieldTypeConflicts(p.logger, p.schema, existing)
+}
+
+// Close writes all buffered points and closes the client. It can be called multiple times.
 func (p *publisher) Close() error {
-	p.client.Close()
+	p.closeOnce.Do(func() {
+		close(p.done)
+		<-p.stopped
+
+		// Write all buffered points before closing the client, which also closes the error channel
+		p.writeAPI.Flush()
+		p.client.Close()
+	})
+	<-p.errorsStopped
 
 	return nil
 }
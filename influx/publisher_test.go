@@ -0,0 +1,60 @@
+package influx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewPublisherOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(options *PublisherOptions)
+		wantErr bool
+	}{
+		{"default", func(options *PublisherOptions) {}, false},
+		{"zero batch size", func(options *PublisherOptions) { options.BatchSize = 0 }, true},
+		{"zero flush interval", func(options *PublisherOptions) { options.FlushInterval = 0 }, true},
+		{"negative flush interval", func(options *PublisherOptions) { options.FlushInterval = -time.Second }, true},
+		{"sub-millisecond flush interval", func(options *PublisherOptions) { options.FlushInterval = time.Microsecond }, true},
+		{"millisecond flush interval", func(options *PublisherOptions) { options.FlushInterval = time.Millisecond }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultPublisherOptions()
+			options.Addr = "http://127.0.0.1:1"
+			tt.modify(&options)
+
+			p, err := NewPublisher(nil, options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewPublisher() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if p != nil {
+				p.Close()
+			}
+		})
+	}
+}
+
+func TestPublisherClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	options := DefaultPublisherOptions()
+	options.Addr = server.URL
+
+	p, err := NewPublisher(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := p.Close(); err != nil {
+			t.Fatalf("close %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package influx
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+var _ wsupload.ObservationTimesLister = (*publisher)(nil)
+var _ wsupload.ObservationQuerier = (*publisher)(nil)
+
+// stationFilter returns the Flux query selecting all points of the station written by the schema between start and
+// end, inclusive. Points written by the aggregate publisher are excluded.
+func (p *publisher) stationFilter(stationID string, start, end time.Time) string {
+	measurements := measurementNames(p.schema)
+
+	quoted := make([]string, len(measurements))
+	for i, name := range measurements {
+		quoted[i] = strconv.Quote(name)
+	}
+
+	return fmt.Sprintf(`from(bucket: %s)
+  |> range(start: %s, stop: %s)
+  |> filter(fn: (r) => contains(value: r._measurement, set: [%s]) and r[%s] == %s and not exists r[%s])`,
+		strconv.Quote(p.options.Bucket),
+		start.UTC().Format(time.RFC3339Nano),
+		end.Add(time.Second).UTC().Format(time.RFC3339Nano),
+		strings.Join(quoted, ", "),
+		strconv.Quote(p.schema.stationIDTag),
+		strconv.Quote(stationID),
+		strconv.Quote(p.schema.aggregateTag),
+	)
+}
+
+// ObservationTimes returns the times of the stored observations of the station between start and end, inclusive.
+func (p *publisher) ObservationTimes(ctx context.Context, stationID string, start, end time.Time) ([]time.Time, error) {
+	query := p.stationFilter(stationID, start, end) + `
+  |> keep(columns: ["_time"])
+  |> group()
+  |> distinct(column: "_time")`
+
+	result, err := p.client.QueryAPI(p.options.Organization).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observation times: %w", err)
+	}
+	defer result.Close()
+
+	var times []time.Time
+	for result.Next() {
+		if t, ok := result.Record().Value().(time.Time); ok {
+			times = append(times, t)
+		}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query observation times: %w", err)
+	}
+
+	return times, nil
+}
+
+// Observations returns the stored observations of the station between start and end, inclusive, sorted by time. Only
+// fields written by the current schema are read.
+func (p *publisher) Observations(ctx context.Context, stationID string, start, end time.Time) ([]*wsupload.Observation, error) {
+	fields := make(map[string]*wsupload.Field)
+	for _, field := range wsupload.ObservationSchema.Fields {
+		fields[field.JSONName] = field
+	}
+
+	// Multiple fields can be written to the same InfluxDB field in the narrow layout, so they are distinguished by
+	// the tags of their measurement
+	type candidate struct {
+		field *wsupload.Field
+		tags  map[string]string
+	}
+	candidates := make(map[string][]candidate)
+	for jsonName, field := range p.schema.fields() {
+		key := field.Measurement + " " + field.Field
+		candidates[key] = append(candidates[key], candidate{
+			field: fields[jsonName],
+			tags:  p.schema.measurements[jsonName].tags,
+		})
+	}
+
+	result, err := p.client.QueryAPI(p.options.Organization).Query(ctx, p.stationFilter(stationID, start, end))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query observations: %w", err)
+	}
+	defer result.Close()
+
+	observations := make(map[time.Time]*wsupload.Observation)
+
+	for result.Next() {
+		record := result.Record()
+
+	candidates:
+		for _, c := range candidates[record.Measurement()+" "+record.Field()] {
+			for k, v := range c.tags {
+				if record.ValueByKey(k) != v {
+					continue candidates
+				}
+			}
+
+			t := record.Time().UTC()
+
+			obs, ok := observations[t]
+			if !ok {
+				obs = &wsupload.Observation{
+					StationID:       stationID,
+					ObservationTime: t,
+				}
+				observations[t] = obs
+			}
+
+			if err := setFieldValue(obs, c.field, record.Value()); err != nil {
+				return nil, fmt.Errorf("invalid value for field %s at %s: %w", c.field.JSONName, t, err)
+			}
+
+			break
+		}
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query observations: %w", err)
+	}
+
+	sorted := make([]*wsupload.Observation, 0, len(observations))
+	for _, obs := range observations {
+		sorted = append(sorted, obs)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ObservationTime.Before(sorted[j].ObservationTime)
+	})
+
+	return sorted, nil
+}
+
+// setFieldValue sets the field of the observation to a value as read from InfluxDB, converting it to the type of the
+// field.
+func setFieldValue(obs *wsupload.Observation, field *wsupload.Field, value interface{}) error {
+	fieldValue := field.Value(obs)
+
+	switch fieldValue.Interface().(type) {
+	case wsupload.NullFloat64:
+		v, err := convertFieldValue(value, wsupload.InfluxTypeFloat)
+		if err != nil {
+			return err
+		}
+		fieldValue.Set(reflect.ValueOf(wsupload.NullFloat64{Valid: true, Float64: v.(float64)}))
+	case wsupload.NullInt64:
+		v, err := convertFieldValue(value, wsupload.InfluxTypeInt)
+		if err != nil {
+			return err
+		}
+		fieldValue.Set(reflect.ValueOf(wsupload.NullInt64{Valid: true, Int64: v.(int64)}))
+	case string:
+		v, err := convertFieldValue(value, wsupload.InfluxTypeString)
+		if err != nil {
+			return err
+		}
+		fieldValue.SetString(v.(string))
+	default:
+		return fmt.Errorf("unsupported field type %s", fieldValue.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,300 @@
+package influx
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+func TestStationFilter(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 6, 1, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		options   func(options *PublisherOptions)
+		stationID string
+		start     time.Time
+		end       time.Time
+		want      string
+	}{
+		{
+			name:      "wide",
+			stationID: "station",
+			start:     start,
+			end:       end,
+			want: `from(bucket: "weather")
+  |> range(start: 2024-06-01T00:00:00Z, stop: 2024-06-02T00:00:00Z)
+  |> filter(fn: (r) => contains(value: r._measurement, set: ["weather"]) and r["station_id"] == "station" and not exists r["aggregate"])`,
+		},
+		{
+			name: "narrow",
+			options: func(options *PublisherOptions) {
+				options.Bucket = "telegraf/autogen"
+				options.Schema.Layout = LayoutNarrow
+				options.Schema.Measurements = map[string]string{
+					"outside_temperature_celsius":            "temperature,sensor=outdoor",
+					"indoor_temperature_celsius":             "temperature,sensor=indoor",
+					"dewpoint_celsius":                       "temperature,sensor=dewpoint",
+					"windchill_celsius":                      "temperature,sensor=windchill",
+					"outside_relative_humidity":              "humidity,sensor=outdoor",
+					"indoor_relative_humidity":               "humidity,sensor=indoor",
+					"relative_atmospheric_pressure_pascal":   "pressure,type=relative",
+					"absolute_atmospheric_pressure_pascal":   "pressure,type=absolute",
+					"uv_index":                               "light,type=uv",
+					"solar_radiation_watt_per_meter_squared": "light,type=solar",
+					"wind_direction_degrees":                 "wind_direction",
+					"wind_speed_meters_per_second":           "wind,type=speed",
+					"wind_gust_meters_per_second":            "wind,type=gust",
+					"hourly_rain_millimeters":                "rain,period=hourly",
+					"daily_rain_millimeters":                 "rain,period=daily",
+					"weekly_rain_millimeters":                "rain,period=weekly",
+					"monthly_rain_millimeters":               "rain,period=monthly",
+					"software_type":                          "software",
+				}
+			},
+			stationID: "station",
+			start:     start,
+			end:       end,
+			want: `from(bucket: "telegraf/autogen")
+  |> range(start: 2024-06-01T00:00:00Z, stop: 2024-06-02T00:00:00Z)
+  |> filter(fn: (r) => contains(value: r._measurement, set: ["humidity", "light", "pressure", "rain", "software", "temperature", "wind", "wind_direction"]) and r["station_id"] == "station" and not exists r["aggregate"])`,
+		},
+		{
+			name:      "quoted station ID",
+			stationID: `station "1"`,
+			start:     start,
+			end:       end,
+			want: `from(bucket: "weather")
+  |> range(start: 2024-06-01T00:00:00Z, stop: 2024-06-02T00:00:00Z)
+  |> filter(fn: (r) => contains(value: r._measurement, set: ["weather"]) and r["station_id"] == "station \"1\"" and not exists r["aggregate"])`,
+		},
+		{
+			name:      "time zone",
+			stationID: "station",
+			start:     start.In(time.FixedZone("CEST", 2*60*60)),
+			end:       start.Add(1500 * time.Millisecond).In(time.FixedZone("CEST", 2*60*60)),
+			want: `from(bucket: "weather")
+  |> range(start: 2024-06-01T00:00:00Z, stop: 2024-06-01T00:00:02.5Z)
+  |> filter(fn: (r) => contains(value: r._measurement, set: ["weather"]) and r["station_id"] == "station" and not exists r["aggregate"])`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := DefaultPublisherOptions()
+			options.Addr = "http://127.0.0.1:1"
+			if tt.options != nil {
+				tt.options(&options)
+			}
+
+			p, err := NewPublisher(nil, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			if got := p.(*publisher).stationFilter(tt.stationID, tt.start, tt.end); got != tt.want {
+				t.Errorf("stationFilter() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// queryServer returns a server that answers every Flux query with the response, and a function returning the queries
+// it received. The queries include the query of the field type check on startup.
+func queryServer(t *testing.T, response string) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var queries []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/query" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var body struct {
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode query: %v", err)
+		}
+
+		mu.Lock()
+		queries = append(queries, body.Query)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), queries...)
+	}
+}
+
+func TestObservationTimes(t *testing.T) {
+	// distinct returns the distinct times in the _value column
+	server, queries := queryServer(t, "#datatype,string,long,dateTime:RFC3339\r\n"+
+		"#group,false,false,false\r\n"+
+		"#default,_result,,\r\n"+
+		",result,table,_value\r\n"+
+		",,0,2024-06-01T12:00:00Z\r\n"+
+		",,0,2024-06-01T12:01:00Z\r\n"+
+		"\r\n")
+
+	options := DefaultPublisherOptions()
+	options.Addr = server.URL
+
+	p, err := NewPublisher(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 6, 1, 23, 59, 59, 0, time.UTC)
+
+	times, err := p.(wsupload.ObservationTimesLister).ObservationTimes(context.Background(), "station", start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Time{
+		time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2024, 6, 1, 12, 1, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(times, want) {
+		t.Errorf("got times %v, want %v", times, want)
+	}
+
+	wantQuery := p.(*publisher).stationFilter("station", start, end) + `
+  |> keep(columns: ["_time"])
+  |> group()
+  |> distinct(column: "_time")`
+	if got := queries(); !slices.Contains(got, wantQuery) {
+		t.Errorf("got queries %q, want %q", got, wantQuery)
+	}
+}
+
+func TestObservations(t *testing.T) {
+	server, queries := queryServer(t, "#datatype,string,long,dateTime:RFC3339,double,string,string,string,string\r\n"+
+		"#group,false,false,false,false,true,true,true,true\r\n"+
+		"#default,_result,,,,,,,\r\n"+
+		",result,table,_time,_value,_field,_measurement,sensor,station_id\r\n"+
+		",,0,2024-06-01T12:01:00Z,22,value,temperature,outdoor,station\r\n"+
+		",,0,2024-06-01T12:00:00Z,21.5,value,temperature,outdoor,station\r\n"+
+		",,1,2024-06-01T12:00:00Z,20,value,temperature,indoor,station\r\n"+
+		",,2,2024-06-01T12:00:00Z,25,value,temperature,unknown,station\r\n"+
+		"\r\n"+
+		"#datatype,string,long,dateTime:RFC3339,long,string,string,string,string\r\n"+
+		"#group,false,false,false,false,true,true,true,true\r\n"+
+		"#default,_result,,,,,,,\r\n"+
+		",result,table,_time,_value,_field,_measurement,sensor,station_id\r\n"+
+		",,3,2024-06-01T12:00:00Z,180,value,wind_direction_degrees,,station\r\n"+
+		"\r\n"+
+		"#datatype,string,long,dateTime:RFC3339,string,string,string,string,string\r\n"+
+		"#group,false,false,false,false,true,true,true,true\r\n"+
+		"#default,_result,,,,,,,\r\n"+
+		",result,table,_time,_value,_field,_measurement,sensor,station_id\r\n"+
+		",,4,2024-06-01T12:00:00Z,EasyWeatherV1.6.4,value,software_type,,station\r\n"+
+		"\r\n")
+
+	options := DefaultPublisherOptions()
+	options.Addr = server.URL
+	options.Schema.Layout = LayoutNarrow
+	options.Schema.Measurements = map[string]string{
+		"outside_temperature_celsius": "temperature,sensor=outdoor",
+		"indoor_temperature_celsius":  "temperature,sensor=indoor",
+	}
+
+	p, err := NewPublisher(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, 6, 1, 23, 59, 59, 0, time.UTC)
+
+	observations, err := p.(wsupload.ObservationQuerier).Observations(context.Background(), "station", start, end)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*wsupload.Observation{
+		{
+			StationID:                 "station",
+			SoftwareType:              "EasyWeatherV1.6.4",
+			ObservationTime:           time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+			OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: 21.5},
+			IndoorTemperatureCelsius:  wsupload.NullFloat64{Valid: true, Float64: 20},
+			WindDirectionDegrees:      wsupload.NullInt64{Valid: true, Int64: 180},
+		},
+		{
+			StationID:                 "station",
+			ObservationTime:           time.Date(2024, 6, 1, 12, 1, 0, 0, time.UTC),
+			OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: 22},
+		},
+	}
+	if !reflect.DeepEqual(observations, want) {
+		t.Errorf("got observations %+v, want %+v", observations, want)
+	}
+
+	wantQuery := p.(*publisher).stationFilter("station", start, end)
+	if got := queries(); !slices.Contains(got, wantQuery) {
+		t.Errorf("got queries %q, want %q", got, wantQuery)
+	}
+}
+
+func TestSetFieldValue(t *testing.T) {
+	fields := make(map[string]*wsupload.Field)
+	for _, field := range wsupload.ObservationSchema.Fields {
+		fields[field.JSONName] = field
+	}
+
+	tests := []struct {
+		name    string
+		field   string
+		value   interface{}
+		want    wsupload.Observation
+		wantErr bool
+	}{
+		{"float", "outside_temperature_celsius", 21.5, wsupload.Observation{OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: 21.5}}, false},
+		{"int to float", "outside_temperature_celsius", int64(21), wsupload.Observation{OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: 21}}, false},
+		{"int", "wind_direction_degrees", int64(180), wsupload.Observation{WindDirectionDegrees: wsupload.NullInt64{Valid: true, Int64: 180}}, false},
+		{"float to int", "wind_direction_degrees", 179.6, wsupload.Observation{WindDirectionDegrees: wsupload.NullInt64{Valid: true, Int64: 180}}, false},
+		{"string", "software_type", "EasyWeatherV1.6.4", wsupload.Observation{SoftwareType: "EasyWeatherV1.6.4"}, false},
+		{"invalid string to float", "outside_temperature_celsius", "warm", wsupload.Observation{}, true},
+		{"unsupported field", "observation_time", "2024-06-01T12:00:00Z", wsupload.Observation{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var obs wsupload.Observation
+
+			err := setFieldValue(&obs, fields[tt.field], tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setFieldValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(obs, tt.want) {
+				t.Errorf("got observation %+v, want %+v", obs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package influx
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+)
+
+const TCPPublisherType = "influx_tcp"
+
+var _ wsupload.Publisher = (*tcpPublisher)(nil)
+var _ wsupload.HealthReporter = (*tcpPublisher)(nil)
+
+func init() {
+	wsupload.RegisterPublisher(wsupload.PublisherFactory{
+		Type: TCPPublisherType,
+		NewOptions: func() interface{} {
+			options := DefaultTCPPublisherOptions()
+			return &options
+		},
+		New: func(logger *zap.Logger, options interface{}) (wsupload.Publisher, error) {
+			return NewTCPPublisher(logger, *options.(*TCPPublisherOptions))
+		},
+	})
+}
+
+// tcpPublisher writes newline-delimited line protocol over a persistent TCP connection, as accepted by the Telegraf
+// socket_listener input. The connection is opened lazily and reopened after an error.
+type tcpPublisher struct {
+	logger *zap.Logger
+
+	options TCPPublisherOptions
+	schema  *Schema
+	health  *wsupload.HealthTracker
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func NewTCPPublisher(logger *zap.Logger, options TCPPublisherOptions) (wsupload.Publisher, error) {
+	schema, err := NewSchema(options.MeasurementName, options.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &tcpPublisher{
+		logger:  logger,
+		options: options,
+		schema:  schema,
+		health:  wsupload.NewHealthTracker(wsupload.HealthStateConnected),
+	}, nil
+}
+
+func DefaultTCPPublisherOptions() TCPPublisherOptions {
+	return TCPPublisherOptions{
+		Addr:            "localhost:8094",
+		MeasurementName: "weather",
+		Schema:          DefaultSchemaOptions(),
+		Timeout:         5 * time.Second,
+	}
+}
+
+type TCPPublisherOptions struct {
+	Addr            string        `flag:"addr" desc:"address of the Telegraf socket_listener"`
+	MeasurementName string        `flag:"measurement-name" desc:"InfluxDB measurement name"`
+	Timeout         time.Duration `flag:"timeout" desc:"timeout for connecting and writing"`
+
+	Schema SchemaOptions `flag:"schema"`
+}
+
+func (p *tcpPublisher) Publish(obs *wsupload.Observation) error {
+	line, err := p.schema.LineProtocol(obs, time.Nanosecond)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// A connection closed by the listener is often only noticed when writing, so retry once using a new connection
+	reused := p.conn != nil
+	err = p.write(line)
+	if err != nil && reused {
+		err = p.write(line)
+	}
+	if err != nil {
+		p.health.Failing(err)
+		return err
+	}
+
+	p.health.Connected()
+
+	return nil
+}
+
+func (p *tcpPublisher) write(line []byte) error {
+	if p.conn == nil {
+		conn, err := net.DialTimeout("tcp", p.options.Addr, p.options.Timeout)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", p.options.Addr, err)
+		}
+
+		p.conn = conn
+	}
+
+	if err := p.conn.SetWriteDeadline(time.Now().Add(p.options.Timeout)); err != nil {
+		return p.closeConn(fmt.Errorf("failed to set write deadline: %w", err))
+	}
+
+	if _, err := p.conn.Write(line); err != nil {
+		return p.closeConn(fmt.Errorf("failed to write to %s: %w", p.options.Addr, err))
+	}
+
+	return nil
+}
+
+// closeConn closes the connection after an error, so the next write opens a new connection.
+func (p *tcpPublisher) closeConn(err error) error {
+	p.logger.Warn("Closing TCP connection after error", zap.Error(err))
+
+	p.conn.Close()
+	p.conn = nil
+
+	return err
+}
+
+func (p *tcpPublisher) Health() wsupload.Health {
+	return p.health.Health()
+}
+
+func (p *tcpPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn == nil {
+		return nil
+	}
+
+	err := p.conn.Close()
+	p.conn = nil
+
+	return err
+}
@@ -0,0 +1,87 @@
+package influx
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+func TestTCPPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	options := DefaultTCPPublisherOptions()
+	options.Addr = listener.Addr().String()
+
+	p, err := NewTCPPublisher(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// The connection is opened lazily and reused for every observation
+	for i := 0; i < 2; i++ {
+		if err := p.Publish(testObservation()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	for i := 0; i < 2; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want := testLine + " 1717243200000000000\n"; line != want {
+			t.Errorf("got line %d %q, want %q", i, line, want)
+		}
+	}
+
+	if state := wsupload.PublisherHealth(p).State; state != wsupload.HealthStateConnected {
+		t.Errorf("health = %s, want %s", state, wsupload.HealthStateConnected)
+	}
+}
+
+func TestTCPPublisherUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	options := DefaultTCPPublisherOptions()
+	options.Addr = addr
+	options.Timeout = time.Second
+
+	p, err := NewTCPPublisher(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Publish(testObservation()); err == nil {
+		t.Fatal("expected an error without a listener")
+	}
+
+	if state := wsupload.PublisherHealth(p).State; state != wsupload.HealthStateFailing {
+		t.Errorf("health = %s, want %s", state, wsupload.HealthStateFailing)
+	}
+}
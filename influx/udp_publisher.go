@@ -0,0 +1,96 @@
+package influx
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+)
+
+const UDPPublisherType = "influx_udp"
+
+var _ wsupload.Publisher = (*udpPublisher)(nil)
+var _ wsupload.HealthReporter = (*udpPublisher)(nil)
+
+func init() {
+	wsupload.RegisterPublisher(wsupload.PublisherFactory{
+		Type: UDPPublisherType,
+		NewOptions: func() interface{} {
+			options := DefaultUDPPublisherOptions()
+			return &options
+		},
+		New: func(logger *zap.Logger, options interface{}) (wsupload.Publisher, error) {
+			return NewUDPPublisher(*options.(*UDPPublisherOptions))
+		},
+	})
+}
+
+// udpPublisher writes line protocol to the UDP listener of InfluxDB 1.x or Telegraf. UDP gives no delivery guarantees,
+// so only errors of the local socket are detected.
+type udpPublisher struct {
+	conn net.Conn
+
+	options UDPPublisherOptions
+	schema  *Schema
+	health  *wsupload.HealthTracker
+}
+
+func NewUDPPublisher(options UDPPublisherOptions) (wsupload.Publisher, error) {
+	schema, err := NewSchema(options.MeasurementName, options.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.Dial("udp", options.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve UDP address %s: %w", options.Addr, err)
+	}
+
+	return &udpPublisher{
+		conn:    conn,
+		options: options,
+		schema:  schema,
+		health:  wsupload.NewHealthTracker(wsupload.HealthStateConnected),
+	}, nil
+}
+
+func DefaultUDPPublisherOptions() UDPPublisherOptions {
+	return UDPPublisherOptions{
+		Addr:            "localhost:8089",
+		MeasurementName: "weather",
+		Schema:          DefaultSchemaOptions(),
+	}
+}
+
+type UDPPublisherOptions struct {
+	Addr            string `flag:"addr" desc:"address of the InfluxDB or Telegraf UDP listener"`
+	MeasurementName string `flag:"measurement-name" desc:"InfluxDB measurement name"`
+
+	Schema SchemaOptions `flag:"schema"`
+}
+
+func (p *udpPublisher) Publish(obs *wsupload.Observation) error {
+	line, err := p.schema.LineProtocol(obs, time.Nanosecond)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.conn.Write(line); err != nil {
+		p.health.Failing(err)
+		return fmt.Errorf("failed to write to UDP: %w", err)
+	}
+
+	p.health.Connected()
+
+	return nil
+}
+
+func (p *udpPublisher) Health() wsupload.Health {
+	return p.health.Health()
+}
+
+func (p *udpPublisher) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,51 @@
+package influx
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPPublisher(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	options := DefaultUDPPublisherOptions()
+	options.Addr = listener.LocalAddr().String()
+
+	p, err := NewUDPPublisher(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Publish(testObservation()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := listener.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 64<<10)
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := string(buf[:n]), testLine+" 1717243200000000000\n"; got != want {
+		t.Errorf("got datagram %q, want %q", got, want)
+	}
+}
+
+func TestNewUDPPublisherInvalidAddr(t *testing.T) {
+	options := DefaultUDPPublisherOptions()
+	options.Addr = "localhost"
+
+	if _, err := NewUDPPublisher(options); err == nil {
+		t.Error("expected an error for an address without a port")
+	}
+}
@@ -0,0 +1,269 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
+)
+
+const V1PublisherType = "influx_v1"
+
+var _ wsupload.Publisher = (*v1Publisher)(nil)
+var _ wsupload.HealthReporter = (*v1Publisher)(nil)
+
+func init() {
+	wsupload.RegisterPublisher(wsupload.PublisherFactory{
+		Type: V1PublisherType,
+		NewOptions: func() interface{} {
+			options := DefaultV1PublisherOptions()
+			return &options
+		},
+		New: func(logger *zap.Logger, options interface{}) (wsupload.Publisher, error) {
+			return NewV1Publisher(logger, *options.(*V1PublisherOptions))
+		},
+	})
+}
+
+// v1Publisher writes line protocol to the /write endpoint of InfluxDB 1.x, which is also offered by the Telegraf
+// influxdb_listener input. Every observation is written synchronously.
+type v1Publisher struct {
+	client   *http.Client
+	writeURL string
+	queryURL string
+	logger   *zap.Logger
+
+	options V1PublisherOptions
+	schema  *Schema
+	health  *wsupload.HealthTracker
+
+	cancel  context.CancelFunc
+	checked chan struct{}
+}
+
+func NewV1Publisher(logger *zap.Logger, options V1PublisherOptions) (wsupload.Publisher, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	schema, err := NewSchema(options.MeasurementName, options.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Database == "" {
+		return nil, fmt.Errorf("database is required")
+	}
+
+	query := url.Values{}
+	query.Set("db", options.Database)
+	if options.RetentionPolicy != "" {
+		query.Set("rp", options.RetentionPolicy)
+	}
+	query.Set("precision", "s")
+
+	ctx, cancel := context.WithTimeout(context.Background(), fieldTypeCheckTimeout)
+
+	p := &v1Publisher{
+		client: &http.Client{
+			Timeout: options.Timeout,
+		},
+		writeURL: strings.TrimSuffix(options.Addr, "/") + "/write?" + query.Encode(),
+		queryURL: strings.TrimSuffix(options.Addr, "/") + "/query",
+		logger:   logger,
+
+		options: options,
+		schema:  schema,
+		health:  wsupload.NewHealthTracker(wsupload.HealthStateConnected),
+
+		cancel:  cancel,
+		checked: make(chan struct{}),
+	}
+
+	go p.checkFieldTypes(ctx)
+
+	return p, nil
+}
+
+func DefaultV1PublisherOptions() V1PublisherOptions {
+	return V1PublisherOptions{
+		Addr:            "http://localhost:8086",
+		Database:        "weather",
+		MeasurementName: "weather",
+		Schema:          DefaultSchemaOptions(),
+		Timeout:         5 * time.Second,
+	}
+}
+
+type V1PublisherOptions struct {
+	Addr            string        `flag:"addr" desc:"InfluxDB 1.x HTTP address"`
+	Database        string        `flag:"database" desc:"InfluxDB database"`
+	RetentionPolicy string        `flag:"retention-policy" desc:"InfluxDB retention policy, leave empty for the default retention policy"`
+	Username        string        `flag:"username" desc:"InfluxDB username"`
+	Password        string        `flag:"password" desc:"InfluxDB password"`
+	MeasurementName string        `flag:"measurement-name" desc:"InfluxDB measurement name"`
+	Timeout         time.Duration `flag:"timeout" desc:"timeout for a single write"`
+
+	Schema SchemaOptions `flag:"schema"`
+}
+
+func (p *v1Publisher) Publish(obs *wsupload.Observation) error {
+	line, err := p.schema.LineProtocol(obs, time.Second)
+	if err != nil {
+		return err
+	}
+
+	if err := p.write(line); err != nil {
+		p.health.Failing(err)
+		return err
+	}
+
+	p.health.Connected()
+
+	return nil
+}
+
+func (p *v1Publisher) write(line []byte) error {
+	req, err := http.NewRequest(http.MethodPost, p.writeURL, bytes.NewReader(line))
+	if err != nil {
+		return fmt.Errorf("failed to create write request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if p.options.Username != "" {
+		req.SetBasicAuth(p.options.Username, p.options.Password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write to InfluxDB: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to write to InfluxDB: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+type showFieldKeysResponse struct {
+	Results []struct {
+		Series []struct {
+			Name   string     `json:"name"`
+			Values [][]string `json:"values"`
+		} `json:"series"`
+		Error string `json:"error"`
+	} `json:"results"`
+	Error string `json:"error"`
+}
+
+// v1FieldTypes maps the field types returned by SHOW FIELD KEYS to the types used in the schema
+var v1FieldTypes = map[string]wsupload.InfluxType{
+	"float":   wsupload.InfluxTypeFloat,
+	"integer": wsupload.InfluxTypeInt,
+	"boolean": wsupload.InfluxTypeBool,
+	"string":  wsupload.InfluxTypeString,
+}
+
+// checkFieldTypes warns about fields that are written with a different type than their existing values.
+func (p *v1Publisher) checkFieldTypes(ctx context.Context) {
+	defer close(p.checked)
+
+	existing, err := p.queryFieldTypes(ctx)
+	if err != nil {
+		p.logger.Warn("Failed to check the field types in InfluxDB", zap.Error(err))
+		return
+	}
+
+	warnFieldTypeConflicts(p.logger, p.schema, existing)
+}
+
+func (p *v1Publisher) queryFieldTypes(ctx context.Context) ([]SchemaField, error) {
+	measurements := measurementNames(p.schema)
+
+	quoted := make([]string, len(measurements))
+	for i, name := range measurements {
+		quoted[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + `"`
+	}
+
+	query := url.Values{}
+	query.Set("db", p.options.Database)
+	query.Set("q", "SHOW FIELD KEYS FROM "+strings.Join(quoted, ", "))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.queryURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create query request: %w", err)
+	}
+	if p.options.Username != "" {
+		req.SetBasicAuth(p.options.Username, p.options.Password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query field types: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("failed to query field types: unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var response showFieldKeysResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode field types: %w", err)
+	}
+	if response.Error != "" {
+		return nil, fmt.Errorf("failed to query field types: %s", response.Error)
+	}
+
+	var fields []SchemaField
+	for _, result := range response.Results {
+		if result.Error != "" {
+			return nil, fmt.Errorf("failed to query field types: %s", result.Error)
+		}
+
+		for _, series := range result.Series {
+			for _, value := range series.Values {
+				if len(value) != 2 {
+					continue
+				}
+
+				t, ok := v1FieldTypes[value[1]]
+				if !ok {
+					t = wsupload.InfluxType(value[1])
+				}
+
+				fields = append(fields, SchemaField{
+					Measurement: series.Name,
+					Field:       value[0],
+					Type:        t,
+				})
+			}
+		}
+	}
+
+	return fields, nil
+}
+
+func (p *v1Publisher) Health() wsupload.Health {
+	return p.health.Health()
+}
+
+func (p *v1Publisher) Close() error {
+	p.cancel()
+	<-p.checked
+
+	p.client.CloseIdleConnections()
+
+	return nil
+}
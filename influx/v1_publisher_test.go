@@ -0,0 +1,197 @@
+package influx
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+// testObservation returns an observation with a float and an integer field, taken at 2024-06-01T12:00:00Z.
+func testObservation() *wsupload.Observation {
+	return &wsupload.Observation{
+		StationID:                 "station",
+		ObservationTime:           time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		OutsideTemperatureCelsius: wsupload.NullFloat64{Valid: true, Float64: 21.5},
+		WindDirectionDegrees:      wsupload.NullInt64{Valid: true, Int64: 180},
+	}
+}
+
+// testLine is the line protocol of testObservation without the timestamp
+const testLine = `weather,station_id=station outside_temperature_celsius=21.5,software_type="",wind_direction_degrees=180i`
+
+type v1Request struct {
+	path     string
+	query    url.Values
+	username string
+	password string
+	body     string
+}
+
+func TestV1Publisher(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(options *V1PublisherOptions)
+		status  int
+		want    v1Request
+		wantErr bool
+	}{
+		{
+			name:   "database",
+			status: http.StatusNoContent,
+			want: v1Request{
+				path:  "/write",
+				query: url.Values{"db": {"weather"}, "precision": {"s"}},
+				body:  testLine + " 1717243200\n",
+			},
+		},
+		{
+			name: "retention policy and basic auth",
+			modify: func(options *V1PublisherOptions) {
+				options.Database = "telegraf"
+				options.RetentionPolicy = "autogen"
+				options.Username = "user"
+				options.Password = "pass"
+			},
+			status: http.StatusNoContent,
+			want: v1Request{
+				path:     "/write",
+				query:    url.Values{"db": {"telegraf"}, "rp": {"autogen"}, "precision": {"s"}},
+				username: "user",
+				password: "pass",
+				body:     testLine + " 1717243200\n",
+			},
+		},
+		{
+			name:   "error status",
+			status: http.StatusBadRequest,
+			want: v1Request{
+				path:  "/write",
+				query: url.Values{"db": {"weather"}, "precision": {"s"}},
+				body:  testLine + " 1717243200\n",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var got []v1Request
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/query" {
+					w.Header().Set("Content-Type", "application/json")
+					io.WriteString(w, `{"results":[{}]}`)
+					return
+				}
+
+				body, _ := io.ReadAll(r.Body)
+				username, password, _ := r.BasicAuth()
+
+				mu.Lock()
+				got = append(got, v1Request{
+					path:     r.URL.Path,
+					query:    r.URL.Query(),
+					username: username,
+					password: password,
+					body:     string(body),
+				})
+				mu.Unlock()
+
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			options := DefaultV1PublisherOptions()
+			options.Addr = server.URL + "/"
+			if tt.modify != nil {
+				tt.modify(&options)
+			}
+
+			p, err := NewV1Publisher(nil, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			err = p.Publish(testObservation())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			wantState := wsupload.HealthStateConnected
+			if tt.wantErr {
+				wantState = wsupload.HealthStateFailing
+			}
+			if state := wsupload.PublisherHealth(p).State; state != wantState {
+				t.Errorf("health = %s, want %s", state, wantState)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if len(got) != 1 {
+				t.Fatalf("got %d write requests, want 1", len(got))
+			}
+			if !reflect.DeepEqual(got[0], tt.want) {
+				t.Errorf("got request %+v, want %+v", got[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestV1PublisherQueryFieldTypes(t *testing.T) {
+	var mu sync.Mutex
+	var query url.Values
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		query = r.URL.Query()
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"results":[{"series":[{"name":"weather","columns":["fieldKey","fieldType"],"values":[["outside_temperature_celsius","float"],["wind_direction_degrees","integer"],["software_type","string"]]}]}]}`)
+	}))
+	defer server.Close()
+
+	options := DefaultV1PublisherOptions()
+	options.Addr = server.URL
+
+	p, err := NewV1Publisher(nil, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	fields, err := p.(*v1Publisher).queryFieldTypes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SchemaField{
+		{Measurement: "weather", Field: "outside_temperature_celsius", Type: wsupload.InfluxTypeFloat},
+		{Measurement: "weather", Field: "wind_direction_degrees", Type: wsupload.InfluxTypeInt},
+		{Measurement: "weather", Field: "software_type", Type: wsupload.InfluxTypeString},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("got fields %+v, want %+v", fields, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if got, want := query.Get("db"), "weather"; got != want {
+		t.Errorf("got db %q, want %q", got, want)
+	}
+	if got, want := query.Get("q"), `SHOW FIELD KEYS FROM "weather"`; got != want {
+		t.Errorf("got query %q, want %q", got, want)
+	}
+}
@@ -5,10 +5,22 @@ import (
 	"fmt"
 
 	"github.com/koesie10/ws-upload/wsupload"
+	"go.uber.org/zap"
 )
 
+const DebugPublisherType = "json_debug"
+
 var _ wsupload.Publisher = (*debugPublisher)(nil)
 
+func init() {
+	wsupload.RegisterPublisher(wsupload.PublisherFactory{
+		Type: DebugPublisherType,
+		New: func(logger *zap.Logger, options interface{}) (wsupload.Publisher, error) {
+			return NewDebugPublisher()
+		},
+	})
+}
+
 type debugPublisher struct{}
 
 func NewDebugPublisher() (wsupload.Publisher, error) {
@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"strings"
+	"sync"
+)
+
+// serverAvailability counts the publishers per broker and server availability topic. When the config is reloaded,
+// the new publisher is created before the old one is closed, so the old one must not publish offline.
+var serverAvailability = &availabilityCounter{
+	publishers: make(map[string]int),
+}
+
+type availabilityCounter struct {
+	mu         sync.Mutex
+	publishers map[string]int
+}
+
+func availabilityKey(options PublisherOptions) string {
+	return strings.Join(options.Brokers, ",") + " " + options.ServerAvailabilityTopic
+}
+
+func (c *availabilityCounter) acquire(options PublisherOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.publishers[availabilityKey(options)]++
+}
+
+// release returns whether the publisher was the last one using the topic.
+func (c *availabilityCounter) release(options PublisherOptions) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := availabilityKey(options)
+
+	c.publishers[key]--
+	if c.publishers[key] > 0 {
+		return false
+	}
+
+	delete(c.publishers, key)
+
+	return true
+}
+
+// stationAvailability combines the availability of all stations into a single availability, since all stations share
+// the availability topic. It is online while any station is online, and offline once all stations are offline.
+type stationAvailability struct {
+	mu       sync.Mutex
+	stations map[string]bool
+	// published is the last published availability, or nil if none has been published yet
+	published *bool
+}
+
+// set records the availability of the station. It returns the combined availability and whether it changed since it
+// was last published.
+func (a *stationAvailability) set(stationID string, online bool) (bool, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stations == nil {
+		a.stations = make(map[string]bool)
+	}
+	a.stations[stationID] = online
+
+	combined := false
+	for _, stationOnline := range a.stations {
+		if stationOnline {
+			combined = true
+			break
+		}
+	}
+
+	if a.published != nil && *a.published == combined {
+		return combined, false
+	}
+	a.published = &combined
+
+	return combined, true
+}
+
+// current returns the last published availability, or false if none has been published yet.
+func (a *stationAvailability) current() (online bool, ok bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.published == nil {
+		return false, false
+	}
+
+	return *a.published, true
+}
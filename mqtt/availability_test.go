@@ -0,0 +1,73 @@
+package mqtt
+
+import "testing"
+
+func TestStationAvailability(t *testing.T) {
+	type step struct {
+		stationID   string
+		online      bool
+		wantOnline  bool
+		wantChanged bool
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "single station",
+			steps: []step{
+				{"a", true, true, true},
+				{"a", true, true, false},
+				{"a", false, false, true},
+				{"a", false, false, false},
+			},
+		},
+		{
+			name: "first state is always published",
+			steps: []step{
+				{"a", false, false, true},
+			},
+		},
+		{
+			name: "offline once all stations are offline",
+			steps: []step{
+				{"a", true, true, true},
+				{"b", true, true, false},
+				{"a", false, true, false},
+				{"b", false, false, true},
+				{"a", true, true, true},
+			},
+		},
+		{
+			name: "silent station does not hide online station",
+			steps: []step{
+				{"quiet", false, false, true},
+				{"a", true, true, true},
+				{"quiet", false, true, false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a stationAvailability
+
+			if _, ok := a.current(); ok {
+				t.Error("current() is set before any availability is published")
+			}
+
+			for i, s := range tt.steps {
+				online, changed := a.set(s.stationID, s.online)
+				if online != s.wantOnline || changed != s.wantChanged {
+					t.Errorf("step %d: set(%s, %v) = %v, %v, want %v, %v", i, s.stationID, s.online, online, changed, s.wantOnline, s.wantChanged)
+				}
+			}
+
+			last := tt.steps[len(tt.steps)-1]
+			if online, ok := a.current(); !ok || online != last.wantOnline {
+				t.Errorf("current() = %v, %v, want %v, true", online, ok, last.wantOnline)
+			}
+		})
+	}
+}
@@ -2,12 +2,13 @@ package mqtt
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"reflect"
+	"time"
 
-	"github.com/fatih/structtag"
+	mqttclient "github.com/eclipse/paho.mqtt.golang"
+	"github.com/koesie10/ws-upload/climate"
 	"github.com/koesie10/ws-upload/wsupload"
-	"github.com/koesie10/ws-upload/x"
 	"go.uber.org/zap"
 )
 
@@ -18,6 +19,12 @@ type homeAssistantDevice struct {
 	Name         string   `json:"name,omitempty"`
 }
 
+type homeAssistantAvailability struct {
+	Topic               string `json:"topic"`
+	PayloadAvailable    string `json:"payload_available"`
+	PayloadNotAvailable string `json:"payload_not_available"`
+}
+
 type homeAssistantConfig struct {
 	DeviceClass       string `json:"device_class,omitempty"`
 	Name              string `json:"name"`
@@ -26,71 +33,222 @@ type homeAssistantConfig struct {
 	UnitOfMeasurement string `json:"unit_of_measurement,omitempty"`
 	ValueTemplate     string `json:"value_template"`
 
+	Availability     []homeAssistantAvailability `json:"availability,omitempty"`
+	AvailabilityMode string                      `json:"availability_mode,omitempty"`
+
 	UniqueID string              `json:"unique_id,omitempty"`
 	Device   homeAssistantDevice `json:"device"`
 }
 
+// DiscoveryPublisher is implemented by the MQTT publisher to manage its Home Assistant discovery messages.
+type DiscoveryPublisher interface {
+	// PublishDiscovery publishes the discovery messages and waits until they are delivered. It resumes publishing them
+	// periodically if that was stopped by ClearDiscovery.
+	PublishDiscovery() error
+	// ClearDiscovery removes all discovery messages and waits until that is delivered. The discovery messages will not
+	// be published periodically until PublishDiscovery is called or the publisher is recreated.
+	ClearDiscovery() error
+}
+
+var _ DiscoveryPublisher = (*publisher)(nil)
+
 func (p *publisher) publishDiscovery() error {
-	if !p.options.HomeAssistant.DiscoveryEnabled {
+	if !p.options.HomeAssistant.DiscoveryEnabled || p.discoveryCleared.Load() {
 		return nil
 	}
 
-	reflectType := reflect.TypeOf(wsupload.Observation{})
+	messages, err := p.discoveryMessages()
+	if err != nil {
+		return err
+	}
 
-	device := homeAssistantDevice{
-		Identifiers:  p.options.HomeAssistant.DeviceIdentifiers,
-		Manufacturer: p.options.HomeAssistant.DeviceManufacturer,
-		Model:        p.options.HomeAssistant.DeviceModel,
-		Name:         p.options.HomeAssistant.DeviceName,
+	for _, message := range messages {
+		topic := message.Topic
+		err := p.publish(message, func(err error) {
+			if err != nil {
+				p.logger.Warn("Failed to publish config to MQTT", zap.String("mqtt.topic", topic), zap.Error(err))
+				p.health.Degraded(fmt.Errorf("failed to publish discovery message: %w", err))
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *publisher) PublishDiscovery() error {
+	if !p.options.HomeAssistant.DiscoveryEnabled {
+		return errors.New("Home Assistant discovery is not enabled")
 	}
 
-	for i := 0; i < reflectType.NumField(); i++ {
-		field := reflectType.Field(i)
+	p.discoveryCleared.Store(false)
 
-		tag, err := structtag.Parse(string(field.Tag))
+	messages, err := p.discoveryMessages()
+	if err != nil {
+		return err
+	}
+
+	return p.publishAndWait(messages)
+}
+
+// discoveryMessages returns the discovery messages of the observation, and of the climate records once they have been
+// published.
+func (p *publisher) discoveryMessages() ([]Message, error) {
+	messages, err := DiscoveryMessages(p.options)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.climateReceived.Load() {
+		climateMessages, err := ClimateDiscoveryMessages(p.options)
 		if err != nil {
-			return fmt.Errorf("failed to parse struct tag for %s: %w", field.Name, err)
+			return nil, err
 		}
+		messages = append(messages, climateMessages...)
+	}
 
-		jsonTag, err := tag.Get("json")
-		if err != nil {
-			continue
+	return messages, nil
+}
+
+func (p *publisher) ClearDiscovery() error {
+	p.discoveryCleared.Store(true)
+
+	return p.publishAndWait(ClearDiscoveryMessages(p.options))
+}
+
+// publishAndWait publishes the messages and waits until all of them are delivered, or until the drain timeout has
+// passed.
+func (p *publisher) publishAndWait(messages []Message) error {
+	if !p.client.IsConnectionOpen() {
+		return errors.New("not connected to MQTT broker")
+	}
+
+	tokens := make([]mqttclient.Token, 0, len(messages))
+	for _, message := range messages {
+		tokens = append(tokens, p.client.Publish(message.Topic, message.QoS, message.Retained, message.Payload))
+	}
+
+	deadline := time.Now().Add(drainTimeout)
+	for i, token := range tokens {
+		if !token.WaitTimeout(time.Until(deadline)) {
+			return fmt.Errorf("timed out publishing %s", messages[i].Topic)
 		}
-		homeAssistantTag, err := tag.Get("homeassistant")
-		if err != nil {
-			p.logger.Warn("Field is missing homeassistant tag", zap.String("discovery.field", field.Name))
-			continue
+		if err := token.Error(); err != nil {
+			return fmt.Errorf("failed to publish %s: %w", messages[i].Topic, err)
 		}
+	}
+
+	return nil
+}
 
-		options := x.ParseStructTagOptions(homeAssistantTag.Options)
+// DiscoveryMessages returns the Home Assistant discovery messages for all fields of the observation that have a
+// homeassistant tag.
+func DiscoveryMessages(options PublisherOptions) ([]Message, error) {
+	return discoveryMessages(options, wsupload.ObservationSchema, options.Topic)
+}
+
+// ClimateDiscoveryMessages returns the Home Assistant discovery messages for all fields of the climate summary that
+// have a homeassistant tag.
+func ClimateDiscoveryMessages(options PublisherOptions) ([]Message, error) {
+	return discoveryMessages(options, climate.SummarySchema, options.ClimateTopic)
+}
+
+func discoveryMessages(options PublisherOptions, schema *wsupload.Schema, stateTopic string) ([]Message, error) {
+	device := homeAssistantDevice{
+		Identifiers:  options.HomeAssistant.DeviceIdentifiers,
+		Manufacturer: options.HomeAssistant.DeviceManufacturer,
+		Model:        options.HomeAssistant.DeviceModel,
+		Name:         options.HomeAssistant.DeviceName,
+	}
+
+	var availability []homeAssistantAvailability
+	for _, topic := range []string{options.ServerAvailabilityTopic, options.AvailabilityTopic} {
+		if topic != "" {
+			availability = append(availability, homeAssistantAvailability{
+				Topic:               topic,
+				PayloadAvailable:    PayloadOnline,
+				PayloadNotAvailable: PayloadOffline,
+			})
+		}
+	}
+
+	// The sensors are only available if both the server and any station are online
+	var availabilityMode string
+	if len(availability) > 1 {
+		availabilityMode = "all"
+	}
+
+	var messages []Message
+
+	for _, field := range schema.Fields {
+		if field.JSONName == "" || field.HomeAssistant == nil {
+			continue
+		}
 
 		config := homeAssistantConfig{
-			DeviceClass:       options["device_class"],
-			Name:              homeAssistantTag.Name,
-			StateTopic:        p.options.Topic,
-			StateClass:        options["state_class"],
-			UnitOfMeasurement: options["unit_of_measurement"],
-			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", jsonTag.Name),
-
-			UniqueID: fmt.Sprintf("%s%s", p.options.HomeAssistant.UniqueIDPrefix, jsonTag.Name),
+			DeviceClass:       field.HomeAssistant.DeviceClass,
+			Name:              field.HomeAssistant.Name,
+			StateTopic:        stateTopic,
+			StateClass:        field.HomeAssistant.StateClass,
+			UnitOfMeasurement: field.HomeAssistant.UnitOfMeasurement,
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", field.JSONName),
+
+			Availability:     availability,
+			AvailabilityMode: availabilityMode,
+
+			UniqueID: fmt.Sprintf("%s%s", options.HomeAssistant.UniqueIDPrefix, field.JSONName),
 			Device:   device,
 		}
 
-		topic := fmt.Sprintf("%s/sensor/%s%s/config", p.options.HomeAssistant.DiscoveryPrefix, p.options.HomeAssistant.DevicePrefix, jsonTag.Name)
-
 		data, err := json.Marshal(config)
 		if err != nil {
-			return fmt.Errorf("failed to marshal observation to JSON: %w", err)
+			return nil, fmt.Errorf("failed to marshal observation to JSON: %w", err)
 		}
 
-		token := p.client.Publish(topic, byte(p.options.HomeAssistant.DiscoveryQoS), true, string(data))
-		go func(topic string) {
-			token.Wait()
-			if err := token.Error(); err != nil {
-				p.logger.Warn("Failed to publish config to MQTT", zap.String("mqtt.topic", topic), zap.Error(err))
+		messages = append(messages, Message{
+			Topic:    discoveryTopic(options, field),
+			QoS:      byte(options.HomeAssistant.DiscoveryQoS),
+			Retained: true,
+			Payload:  data,
+		})
+	}
+
+	return messages, nil
+}
+
+// ClearDiscoveryMessages returns the messages that remove the Home Assistant discovery messages of all fields of the
+// observation and the climate summary.
+func ClearDiscoveryMessages(options PublisherOptions) []Message {
+	var messages []Message
+
+	for _, field := range discoveryFields() {
+		// An empty retained message removes the entity from Home Assistant and the retained message from the broker
+		messages = append(messages, Message{
+			Topic:    discoveryTopic(options, field),
+			QoS:      byte(options.HomeAssistant.DiscoveryQoS),
+			Retained: true,
+		})
+	}
+
+	return messages
+}
+
+// discoveryFields returns all fields of the observation and the climate summary that have a homeassistant tag.
+func discoveryFields() []*wsupload.Field {
+	var fields []*wsupload.Field
+	for _, schema := range []*wsupload.Schema{wsupload.ObservationSchema, climate.SummarySchema} {
+		for _, field := range schema.Fields {
+			if field.JSONName != "" && field.HomeAssistant != nil {
+				fields = append(fields, field)
 			}
-		}(topic)
+		}
 	}
 
-	return nil
+	return fields
+}
+
+func discoveryTopic(options PublisherOptions, field *wsupload.Field) string {
+	return fmt.Sprintf("%s/sensor/%s%s/config", options.HomeAssistant.DiscoveryPrefix, options.HomeAssistant.DevicePrefix, field.JSONName)
 }
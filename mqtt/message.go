@@ -0,0 +1,76 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/koesie10/ws-upload/climate"
+	"github.com/koesie10/ws-upload/wsupload"
+)
+
+// Message is an MQTT message as it would be published to the broker
+type Message struct {
+	Topic    string
+	QoS      byte
+	Retained bool
+	Payload  []byte
+}
+
+// StateMessage returns the message containing the state of the observation.
+func StateMessage(options PublisherOptions, obs *wsupload.Observation) (Message, error) {
+	data, err := json.Marshal(obs)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to marshal observation to JSON: %w", err)
+	}
+
+	return Message{
+		Topic:    options.Topic,
+		QoS:      byte(options.QoS),
+		Retained: true,
+		Payload:  data,
+	}, nil
+}
+
+// ClimateMessage returns the message containing the climate records of a station.
+func ClimateMessage(options PublisherOptions, summary *climate.Summary) (Message, error) {
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to marshal climate records to JSON: %w", err)
+	}
+
+	return Message{
+		Topic:    options.ClimateTopic,
+		QoS:      byte(options.QoS),
+		Retained: true,
+		Payload:  data,
+	}, nil
+}
+
+const (
+	// PayloadOnline and PayloadOffline are the availability payloads, which are the defaults of Home Assistant
+	PayloadOnline  = "online"
+	PayloadOffline = "offline"
+)
+
+// ServerAvailabilityMessage returns the message containing whether the server is online.
+func ServerAvailabilityMessage(options PublisherOptions, online bool) Message {
+	message := AvailabilityMessage(options, online)
+	message.Topic = options.ServerAvailabilityTopic
+
+	return message
+}
+
+// AvailabilityMessage returns the message containing whether the station is online.
+func AvailabilityMessage(options PublisherOptions, online bool) Message {
+	payload := PayloadOffline
+	if online {
+		payload = PayloadOnline
+	}
+
+	return Message{
+		Topic:    options.AvailabilityTopic,
+		QoS:      byte(options.QoS),
+		Retained: true,
+		Payload:  []byte(payload),
+	}
+}
@@ -1,18 +1,46 @@
 package mqtt
 
 import (
-	"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	mqttclient "github.com/eclipse/paho.mqtt.golang"
+	"github.com/koesie10/ws-upload/climate"
 	"github.com/koesie10/ws-upload/wsupload"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
+const PublisherType = "mqtt"
+
+var errClosed = errors.New("publisher is closed")
+
+// drainTimeout is the maximum time to wait for pending messages when closing the publisher
+const drainTimeout = 10 * time.Second
+
 var _ wsupload.Publisher = (*publisher)(nil)
+var _ wsupload.HealthReporter = (*publisher)(nil)
+var _ climate.Publisher = (*publisher)(nil)
+var _ wsupload.AvailabilityPublisher = (*publisher)(nil)
+
+func init() {
+	wsupload.RegisterPublisher(wsupload.PublisherFactory{
+		Type: PublisherType,
+		NewOptions: func() interface{} {
+			options := DefaultPublisherOptions()
+			return &options
+		},
+		New: func(logger *zap.Logger, options interface{}) (wsupload.Publisher, error) {
+			return NewPublisher(logger, *options.(*PublisherOptions))
+		},
+	})
+}
 
 type publisher struct {
 	client mqttclient.Client
@@ -20,7 +48,44 @@ type publisher struct {
 
 	options PublisherOptions
 
-	done chan struct{}
+	health  *wsupload.HealthTracker
+	pending sync.WaitGroup
+
+	mu sync.Mutex
+	// closing is set once the pending messages are drained, after which no messages are published
+	closing bool
+
+	discoveryCleared atomic.Bool
+	// climateReceived is set once climate records are published, their sensors are only discovered from then on
+	climateReceived atomic.Bool
+
+	availability stationAvailability
+
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// ClientID returns the configured client ID, or a unique client ID that starts with the hostname if it is empty.
+func ClientID(clientID string) string {
+	if clientID != "" {
+		return clientID
+	}
+
+	hostname, _ := os.Hostname()
+
+	return UniqueClientID(hostname)
+}
+
+// UniqueClientID returns a unique client ID that starts with the prefix.
+func UniqueClientID(prefix string) string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		// The time is unique enough if no random bytes are available
+		return fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
+	}
+
+	return prefix + "-" + hex.EncodeToString(suffix)
 }
 
 func NewPublisher(logger *zap.Logger, options PublisherOptions) (wsupload.Publisher, error) {
@@ -32,13 +97,15 @@ func NewPublisher(logger *zap.Logger, options PublisherOptions) (wsupload.Publis
 		setupDebugLogs(logger.With(zap.String("component", "mqtt")))
 	}
 
-	hostname, _ := os.Hostname()
-
-	if options.ClientID == "" {
-		options.ClientID = fmt.Sprintf("%s-%d", hostname, time.Now().Unix())
+	for _, field := range wsupload.ObservationSchema.Fields {
+		if field.WS != nil && field.JSONName != "" && field.HomeAssistant == nil {
+			logger.Warn("Field is missing homeassistant tag", zap.String("discovery.field", field.Name))
+		}
 	}
 
-	connOpts := mqttclient.NewClientOptions().SetClientID(options.ClientID).SetCleanSession(true)
+	// The publisher is created before the one it replaces is closed when the config is reloaded, so the default client
+	// ID has a random suffix, or the broker would disconnect one of them. A configured client ID is used as is.
+	connOpts := mqttclient.NewClientOptions().SetClientID(ClientID(options.ClientID)).SetCleanSession(true)
 
 	for _, broker := range options.Brokers {
 		connOpts.AddBroker(broker)
@@ -53,14 +120,45 @@ func NewPublisher(logger *zap.Logger, options PublisherOptions) (wsupload.Publis
 	connOpts.SetAutoReconnect(true)
 	connOpts.SetConnectRetry(true)
 
-	client := mqttclient.NewClient(connOpts)
+	if options.ServerAvailabilityTopic != "" {
+		// The broker publishes the will when the connection is lost without disconnecting
+		will := ServerAvailabilityMessage(options, false)
+		connOpts.SetBinaryWill(will.Topic, will.Payload, will.QoS, will.Retained)
+	}
 
 	p := &publisher{
-		client:  client,
 		logger:  logger,
 		options: options,
 
-		done: make(chan struct{}),
+		health: wsupload.NewHealthTracker(wsupload.HealthStateFailing),
+
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	connOpts.SetOnConnectHandler(func(client mqttclient.Client) {
+		p.health.Connected()
+
+		// The will may have been published while the connection was lost, so this is published on every connect
+		if options.ServerAvailabilityTopic != "" {
+			p.publishServerAvailability(true)
+		}
+		// Availability published before the connection was established is not delivered
+		if online, ok := p.availability.current(); ok && options.AvailabilityTopic != "" {
+			p.publishAvailability(online)
+		}
+	})
+	connOpts.SetConnectionLostHandler(func(client mqttclient.Client, err error) {
+		p.logger.Warn("Lost connection to MQTT broker", zap.Error(err))
+		p.health.Failing(fmt.Errorf("lost connection to MQTT broker: %w", err))
+	})
+
+	p.health.Failing(errors.New("not connected to MQTT broker yet"))
+
+	p.client = mqttclient.NewClient(connOpts)
+
+	if options.ServerAvailabilityTopic != "" {
+		serverAvailability.acquire(options)
 	}
 
 	go p.watchdog()
@@ -68,16 +166,40 @@ func NewPublisher(logger *zap.Logger, options PublisherOptions) (wsupload.Publis
 	return p, nil
 }
 
+func DefaultPublisherOptions() PublisherOptions {
+	return PublisherOptions{
+		Brokers: []string{"tcp://127.0.0.1:1883"},
+		Topic:   "homeassistant/sensor/sensorWeatherStation/state",
+
+		ClimateTopic:      "homeassistant/sensor/sensorWeatherStation/climate",
+		AvailabilityTopic: "homeassistant/sensor/sensorWeatherStation/availability",
+
+		ServerAvailabilityTopic: "homeassistant/sensor/sensorWeatherStation/server_availability",
+		HomeAssistant: HomeAssistantOptions{
+			DiscoveryEnabled:  true,
+			DiscoveryInterval: 30 * time.Second,
+			DiscoveryQoS:      1, // At least once
+			DiscoveryPrefix:   "homeassistant",
+			DevicePrefix:      "weatherstation_",
+		},
+	}
+}
+
 type PublisherOptions struct {
 	Brokers  []string `env:"MQTT_BROKERS" flag:"brokers" desc:"MQTT broker addresses, leave empty to disable"`
-	ClientID string   `env:"MQTT_CLIENT_ID" flag:"client-id" desc:"MQTT client ID, default will be autogenerated based on the client hostname"`
+	ClientID string   `env:"MQTT_CLIENT_ID" flag:"client-id" desc:"MQTT client ID, defaults to the client hostname with a random suffix so every publisher has a unique client ID"`
 	Username string   `env:"MQTT_USERNAME" flag:"username" desc:"MQTT username"`
 	Password string   `env:"MQTT_PASSWORD" flag:"password" desc:"MQTT password"`
 
 	Topic string `env:"MQTT_TOPIC" flag:"topic" desc:"topic to publish to"`
 	QoS   int    `env:"MQTT_QOS" flag:"qos" desc:"the QoS to send the messages at"`
 
-	HomeAssistant HomeAssistantOptions `env:",squash"`
+	ClimateTopic      string `env:"MQTT_CLIMATE_TOPIC" flag:"climate-topic" desc:"topic to publish the climate records to, if climate records are enabled"`
+	AvailabilityTopic string `env:"MQTT_AVAILABILITY_TOPIC" flag:"availability-topic" desc:"topic to publish whether any station is online to, leave empty to disable"`
+
+	ServerAvailabilityTopic string `env:"MQTT_SERVER_AVAILABILITY_TOPIC" flag:"server-availability-topic" desc:"topic to publish online to when connected and offline to on shutdown or as Last Will when the connection is lost, leave empty to disable"`
+
+	HomeAssistant HomeAssistantOptions `env:",squash" flag:"home-assistant"`
 
 	Debug bool `env:"MQTT_DEBUG" flag:"debug" desc:"whether to enable debug logging"`
 }
@@ -97,35 +219,159 @@ type HomeAssistantOptions struct {
 }
 
 func (p *publisher) Publish(obs *wsupload.Observation) error {
-	data, err := json.Marshal(obs)
+	message, err := StateMessage(p.options, obs)
 	if err != nil {
-		return fmt.Errorf("failed to marshal observation to JSON: %w", err)
+		return err
 	}
 
-	token := p.client.Publish(p.options.Topic, byte(p.options.QoS), true, string(data))
-	go func() {
-		token.Wait()
-		if err := token.Error(); err != nil {
+	return p.publish(message, func(err error) {
+		if err != nil {
 			p.logger.Warn("Failed to publish observation to MQTT", zap.Error(err))
+			p.health.Degraded(fmt.Errorf("failed to publish observation: %w", err))
+			return
+		}
+
+		p.health.Connected()
+	})
+}
+
+func (p *publisher) PublishClimate(summary *climate.Summary) error {
+	message, err := ClimateMessage(p.options, summary)
+	if err != nil {
+		return err
+	}
+
+	if !p.climateReceived.Swap(true) {
+		if err := p.publishDiscovery(); err != nil {
+			p.logger.Warn("Failed to publish discovery message", zap.Error(err))
+		}
+	}
+
+	return p.publish(message, func(err error) {
+		if err != nil {
+			p.logger.Warn("Failed to publish climate records to MQTT", zap.Error(err))
+			p.health.Degraded(fmt.Errorf("failed to publish climate records: %w", err))
+		}
+	})
+}
+
+// PublishAvailability publishes whether the stations are online to the availability topic. The topic is shared by all
+// stations, like the state topic, so online is published while any station is online, and offline once all stations
+// are offline.
+func (p *publisher) PublishAvailability(stationID string, online bool) error {
+	if p.options.AvailabilityTopic == "" {
+		return nil
+	}
+
+	online, changed := p.availability.set(stationID, online)
+	if !changed {
+		return nil
+	}
+
+	return p.publishAvailability(online)
+}
+
+// publishAvailability publishes whether any station is online to the availability topic.
+func (p *publisher) publishAvailability(online bool) error {
+	return p.publish(AvailabilityMessage(p.options, online), func(err error) {
+		if err != nil {
+			p.logger.Warn("Failed to publish availability to MQTT", zap.Error(err))
+			p.health.Degraded(fmt.Errorf("failed to publish availability: %w", err))
 		}
+	})
+}
+
+// publishServerAvailability publishes whether the server is online to the server availability topic.
+func (p *publisher) publishServerAvailability(online bool) error {
+	return p.publish(ServerAvailabilityMessage(p.options, online), func(err error) {
+		if err != nil {
+			p.logger.Warn("Failed to publish server availability to MQTT", zap.Error(err))
+			p.health.Degraded(fmt.Errorf("failed to publish server availability: %w", err))
+		}
+	})
+}
+
+// publish publishes the message and calls done with the result once it is delivered. Messages are not published once
+// the publisher is closing, since the pending messages are being drained.
+func (p *publisher) publish(message Message, done func(err error)) error {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		return errClosed
+	}
+	p.pending.Add(1)
+	p.mu.Unlock()
+
+	token := p.client.Publish(message.Topic, message.QoS, message.Retained, message.Payload)
+	go func() {
+		defer p.pending.Done()
+
+		token.Wait()
+		done(token.Error())
 	}()
 
 	return nil
 }
 
+func (p *publisher) Health() wsupload.Health {
+	return p.health.Health()
+}
+
+// Close waits for pending messages to be delivered and disconnects from the broker. It can be called multiple times.
 func (p *publisher) Close() error {
-	close(p.done)
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	<-p.stopped
 
 	return nil
 }
 
+// drain waits for all pending messages to be delivered, or until the drain timeout has passed. No messages are published
+// afterwards.
+func (p *publisher) drain() {
+	p.mu.Lock()
+	p.closing = true
+	p.mu.Unlock()
+
+	if !p.client.IsConnectionOpen() {
+		return
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		p.pending.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(drainTimeout):
+		p.logger.Warn("Timed out waiting for pending MQTT messages", zap.Duration("mqtt.drain_timeout", drainTimeout))
+	}
+}
+
 func (p *publisher) watchdog() {
+	defer close(p.stopped)
+
 	token := p.client.Connect()
 
-	token.Wait()
+	select {
+	case <-token.Done():
+	case <-p.done:
+		if p.options.ServerAvailabilityTopic != "" {
+			serverAvailability.release(p.options)
+		}
+
+		// Pending messages cannot be delivered without a connection
+		p.client.Disconnect(250)
+
+		return
+	}
 
 	if token.Error() != nil {
 		p.logger.Error("Failed to connect to MQTT broker", zap.Error(token.Error()))
+		p.health.Failing(fmt.Errorf("failed to connect to MQTT broker: %w", token.Error()))
 	}
 
 	discoveryInterval := p.options.HomeAssistant.DiscoveryInterval
@@ -145,6 +391,13 @@ func (p *publisher) watchdog() {
 	for {
 		select {
 		case <-p.done:
+			// A clean disconnect does not publish the will, so offline is published unless another publisher with the
+			// same topic replaces this one when the config is reloaded
+			if p.options.ServerAvailabilityTopic != "" && serverAvailability.release(p.options) && p.client.IsConnectionOpen() {
+				p.publishServerAvailability(false)
+			}
+
+			p.drain()
 			p.client.Disconnect(250)
 
 			return
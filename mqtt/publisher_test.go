@@ -0,0 +1,37 @@
+package mqtt
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestClientID(t *testing.T) {
+	if got := ClientID("ws-upload"); got != "ws-upload" {
+		t.Errorf("ClientID(%q) = %s, want %s", "ws-upload", got, "ws-upload")
+	}
+
+	hostname, _ := os.Hostname()
+
+	first := ClientID("")
+	second := ClientID("")
+
+	if !strings.HasPrefix(first, hostname+"-") {
+		t.Errorf("ClientID(%q) = %s, want prefix %s", "", first, hostname+"-")
+	}
+	if first == second {
+		t.Errorf("ClientID(%q) returned %s twice", "", first)
+	}
+}
+
+func TestUniqueClientID(t *testing.T) {
+	first := UniqueClientID("ws-upload-alert")
+	second := UniqueClientID("ws-upload-alert")
+
+	if !strings.HasPrefix(first, "ws-upload-alert-") {
+		t.Errorf("UniqueClientID() = %s, want prefix %s", first, "ws-upload-alert-")
+	}
+	if first == second {
+		t.Errorf("UniqueClientID() returned %s twice", first)
+	}
+}
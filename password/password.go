@@ -0,0 +1,202 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// Argon2id parameters as recommended by OWASP
+const (
+	argon2Memory      = 19 * 1024
+	argon2Iterations  = 2
+	argon2Parallelism = 1
+	argon2SaltLength  = 16
+	argon2KeyLength   = 32
+)
+
+const argon2Prefix = "$argon2id$"
+
+// Hash hashes the password using the given algorithm. The cost is only used for bcrypt, use 0 for the default cost.
+func Hash(password string, algorithm string, cost int) (string, error) {
+	switch algorithm {
+	case AlgorithmBcrypt:
+		if cost == 0 {
+			cost = bcrypt.DefaultCost
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash password: %w", err)
+		}
+
+		return string(hash), nil
+	case AlgorithmArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("failed to generate salt: %w", err)
+		}
+
+		key := argon2.IDKey([]byte(password), salt, argon2Iterations, argon2Memory, argon2Parallelism, argon2KeyLength)
+
+		return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2Prefix,
+			argon2.Version,
+			argon2Memory,
+			argon2Iterations,
+			argon2Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key),
+		), nil
+	default:
+		return "", fmt.Errorf("unsupported algorithm %s, use %s or %s", algorithm, AlgorithmBcrypt, AlgorithmArgon2id)
+	}
+}
+
+// IsHash returns whether the stored password is a bcrypt or argon2id hash instead of a plaintext password.
+func IsHash(stored string) bool {
+	return isBcrypt(stored) || strings.HasPrefix(stored, argon2Prefix)
+}
+
+func isBcrypt(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// Validate returns an error if the stored password looks like a hash, but cannot be parsed.
+func Validate(stored string) error {
+	switch {
+	case isBcrypt(stored):
+		if _, err := bcrypt.Cost([]byte(stored)); err != nil {
+			return fmt.Errorf("invalid bcrypt hash: %w", err)
+		}
+	case strings.HasPrefix(stored, argon2Prefix):
+		if _, err := parseArgon2(stored); err != nil {
+			return fmt.Errorf("invalid argon2id hash: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Verify returns whether the password matches the stored password, which is either a hash or a plaintext password.
+// Plaintext passwords are compared in constant time.
+func Verify(stored, password string) bool {
+	switch {
+	case isBcrypt(stored):
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	case strings.HasPrefix(stored, argon2Prefix):
+		hash, err := parseArgon2(stored)
+		if err != nil {
+			return false
+		}
+
+		key := argon2.IDKey([]byte(password), hash.salt, hash.iterations, hash.memory, hash.parallelism, uint32(len(hash.key)))
+
+		return subtle.ConstantTimeCompare(key, hash.key) == 1
+	default:
+		// Compare digests so the comparison does not depend on the length of the password
+		storedDigest := sha256.Sum256([]byte(stored))
+		digest := sha256.Sum256([]byte(password))
+
+		return subtle.ConstantTimeCompare(storedDigest[:], digest[:]) == 1
+	}
+}
+
+// Cache remembers the passwords that were verified against a bcrypt or argon2id hash, so stations uploading every few
+// seconds do not compute the hash for every upload. Bad passwords are never cached. It is safe for concurrent use.
+type Cache struct {
+	mu sync.Mutex
+	// verified contains the SHA-256 digest of the last password verified against every hash
+	verified map[string][sha256.Size]byte
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		verified: make(map[string][sha256.Size]byte),
+	}
+}
+
+// Verify is like Verify, but a password that was verified against the same hash before is compared in constant time
+// against its digest instead of computing the hash again.
+func (c *Cache) Verify(stored, password string) bool {
+	if !IsHash(stored) {
+		return Verify(stored, password)
+	}
+
+	digest := sha256.Sum256([]byte(password))
+
+	c.mu.Lock()
+	cached, ok := c.verified[stored]
+	c.mu.Unlock()
+
+	if ok && subtle.ConstantTimeCompare(cached[:], digest[:]) == 1 {
+		return true
+	}
+
+	if !Verify(stored, password) {
+		return false
+	}
+
+	c.mu.Lock()
+	c.verified[stored] = digest
+	c.mu.Unlock()
+
+	return true
+}
+
+type argon2Hash struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func parseArgon2(stored string) (*argon2Hash, error) {
+	// $argon2id$v=19$m=19456,t=2,p=1$salt$key
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("expected 6 parts")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, fmt.Errorf("invalid version: %w", err)
+	}
+	if version != argon2.Version {
+		return nil, fmt.Errorf("unsupported version %d", version)
+	}
+
+	hash := &argon2Hash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.iterations, &hash.parallelism); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	var err error
+	hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+	hash.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	if len(hash.key) == 0 {
+		return nil, errors.New("empty key")
+	}
+
+	return hash, nil
+}
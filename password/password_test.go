@@ -0,0 +1,187 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustHash(t *testing.T, password, algorithm string) string {
+	t.Helper()
+
+	hash, err := Hash(password, algorithm, 4)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+
+	return hash
+}
+
+func TestVerify(t *testing.T) {
+	bcryptHash := mustHash(t, "secret", AlgorithmBcrypt)
+	argon2Hash := mustHash(t, "secret", AlgorithmArgon2id)
+
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		want     bool
+	}{
+		{"plaintext match", "secret", "secret", true},
+		{"plaintext mismatch", "secret", "Secret", false},
+		{"plaintext prefix", "secret", "secre", false},
+		{"plaintext empty", "secret", "", false},
+		{"bcrypt match", bcryptHash, "secret", true},
+		{"bcrypt mismatch", bcryptHash, "other", false},
+		{"bcrypt hash as password", bcryptHash, bcryptHash, false},
+		{"argon2id match", argon2Hash, "secret", true},
+		{"argon2id mismatch", argon2Hash, "other", false},
+		{"argon2id hash as password", argon2Hash, argon2Hash, false},
+		{"argon2id missing parts", "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA", "secret", false},
+		{"argon2id wrong version", strings.Replace(argon2Hash, "v=19", "v=16", 1), "secret", false},
+		{"argon2id invalid key", argon2Hash + "!", "secret", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.stored, tt.password); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheVerify(t *testing.T) {
+	bcryptHash := mustHash(t, "secret", AlgorithmBcrypt)
+	otherHash := mustHash(t, "other", AlgorithmBcrypt)
+
+	cache := NewCache()
+
+	steps := []struct {
+		stored   string
+		password string
+		want     bool
+		cached   bool
+	}{
+		{bcryptHash, "other", false, false},
+		{bcryptHash, "secret", true, true},
+		{bcryptHash, "secret", true, true},
+		{bcryptHash, "other", false, true},
+		{bcryptHash, "", false, true},
+		{otherHash, "secret", false, false},
+		{otherHash, "other", true, true},
+		{"secret", "secret", true, false},
+	}
+
+	for i, step := range steps {
+		if got := cache.Verify(step.stored, step.password); got != step.want {
+			t.Errorf("step %d: Verify() = %v, want %v", i, got, step.want)
+		}
+		if _, cached := cache.verified[step.stored]; cached != step.cached {
+			t.Errorf("step %d: cached = %v, want %v", i, cached, step.cached)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		prefix    string
+		wantErr   bool
+	}{
+		{AlgorithmBcrypt, "$2a$", false},
+		{AlgorithmArgon2id, "$argon2id$v=19$m=19456,t=2,p=1$", false},
+		{"md5", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			hash, err := Hash("secret", tt.algorithm, 4)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Hash() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("Hash() = %s, want prefix %s", hash, tt.prefix)
+			}
+			if !IsHash(hash) {
+				t.Errorf("IsHash(%s) = false", hash)
+			}
+			if err := Validate(hash); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestParseArgon2(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  string
+		want    argon2Hash
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			stored: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5",
+			want: argon2Hash{
+				memory:      19456,
+				iterations:  2,
+				parallelism: 1,
+				salt:        []byte("saltsalt"),
+				key:         []byte("keykey"),
+			},
+		},
+		{name: "too few parts", stored: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ", wantErr: true},
+		{name: "too many parts", stored: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5$", wantErr: true},
+		{name: "invalid version", stored: "$argon2id$version$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5", wantErr: true},
+		{name: "unsupported version", stored: "$argon2id$v=16$m=19456,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5", wantErr: true},
+		{name: "invalid parameters", stored: "$argon2id$v=19$m=x,t=2,p=1$c2FsdHNhbHQ$a2V5a2V5", wantErr: true},
+		{name: "invalid salt", stored: "$argon2id$v=19$m=19456,t=2,p=1$!!$a2V5a2V5", wantErr: true},
+		{name: "invalid key", stored: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$!!", wantErr: true},
+		{name: "empty key", stored: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHQ$", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseArgon2(tt.stored)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgon2() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if err := Validate(tt.stored); err == nil {
+					t.Errorf("Validate() error = nil, want error")
+				}
+				return
+			}
+
+			if got.memory != tt.want.memory || got.iterations != tt.want.iterations || got.parallelism != tt.want.parallelism ||
+				string(got.salt) != string(tt.want.salt) || string(got.key) != string(tt.want.key) {
+				t.Errorf("parseArgon2() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		stored  string
+		wantErr bool
+	}{
+		{"empty", "", false},
+		{"plaintext", "secret", false},
+		{"invalid bcrypt", "$2a$10$short", true},
+		{"invalid argon2id", "$argon2id$v=19", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.stored); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package password
+
+import (
+	"net/url"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// secretParams are the query parameters in which stations send their password
+var secretParams = []string{"PASSWORD", "PASSKEY"}
+
+// IsSecretParam returns whether the query parameter contains a station password.
+func IsSecretParam(key string) bool {
+	for _, param := range secretParams {
+		if strings.EqualFold(key, param) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedactQuery replaces the values of all secret parameters in a raw query or form body. The order and encoding of the
+// other parameters is kept as is.
+func RedactQuery(query string) string {
+	parts := strings.Split(query, "&")
+
+	for i, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+
+		if IsSecretParam(key) {
+			rawKey, _, _ := strings.Cut(part, "=")
+			parts[i] = rawKey + "=" + redacted
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// RedactRequestURI replaces the values of all secret parameters in the query of a request URI.
+func RedactRequestURI(requestURI string) string {
+	path, query, ok := strings.Cut(requestURI, "?")
+	if !ok {
+		return requestURI
+	}
+
+	return path + "?" + RedactQuery(query)
+}
@@ -0,0 +1,50 @@
+package password
+
+import "testing"
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"no secrets", "ID=abc&tempf=50", "ID=abc&tempf=50"},
+		{"password", "ID=abc&PASSWORD=secret&tempf=50", "ID=abc&PASSWORD=REDACTED&tempf=50"},
+		{"passkey", "PASSKEY=ABCDEF&stationtype=EasyWeather", "PASSKEY=REDACTED&stationtype=EasyWeather"},
+		{"lowercase", "password=secret", "password=REDACTED"},
+		{"escaped key", "PASS%57ORD=secret", "PASS%57ORD=REDACTED"},
+		{"without value", "PASSWORD&ID=abc", "PASSWORD=REDACTED&ID=abc"},
+		{"repeated", "PASSWORD=a&PASSWORD=b", "PASSWORD=REDACTED&PASSWORD=REDACTED"},
+		{"keeps encoding", "dateutc=2026-10-19+10%3A00%3A00&PASSWORD=a%26b", "dateutc=2026-10-19+10%3A00%3A00&PASSWORD=REDACTED"},
+		{"similar key", "PASSWORDS=secret", "PASSWORDS=secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactQuery(tt.query); got != tt.want {
+				t.Errorf("RedactQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactRequestURI(t *testing.T) {
+	tests := []struct {
+		name       string
+		requestURI string
+		want       string
+	}{
+		{"no query", "/weatherstation/updateweatherstation.php", "/weatherstation/updateweatherstation.php"},
+		{"empty query", "/api/v1/observe?", "/api/v1/observe?"},
+		{"password", "/weatherstation/updateweatherstation.php?ID=abc&PASSWORD=secret", "/weatherstation/updateweatherstation.php?ID=abc&PASSWORD=REDACTED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactRequestURI(tt.requestURI); got != tt.want {
+				t.Errorf("RedactRequestURI(%q) = %q, want %q", tt.requestURI, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// timeLayout is the layout of the time added to the names of rotated files
+const timeLayout = "2006-01-02T15-04-05.000"
+
+type Options struct {
+	// MaxSize is the size in bytes after which the file is rotated, 0 disables rotating by size
+	MaxSize int64
+	// Daily rotates the file when the first write of a new day in UTC happens
+	Daily bool
+	// Compress compresses rotated files using gzip
+	Compress bool
+	// MaxFiles is the number of rotated files that are kept, the oldest rotated files are removed when it is exceeded. 0
+	// keeps all rotated files.
+	MaxFiles int
+}
+
+// Writer appends to a file and rotates it by renaming it to a name containing the time of rotation. Writes are never
+// split across files.
+type Writer struct {
+	path    string
+	options Options
+	logger  *zap.Logger
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	day    string
+	closed bool
+	// rotatedAt is the time in the name of the last rotated file
+	rotatedAt time.Time
+
+	// compressingPaths contains the rotated files that are being compressed
+	compressingPaths map[string]struct{}
+	compressing      sync.WaitGroup
+}
+
+func NewWriter(logger *zap.Logger, path string, options Options) (*Writer, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	w := &Writer{
+		path:    path,
+		options: options,
+		logger:  logger,
+
+		compressingPaths: make(map[string]struct{}),
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	w.file = file
+	w.size = info.Size()
+	w.day = day(time.Now())
+
+	// An existing file is rotated on the first write if it was last written on another day
+	if w.size > 0 {
+		w.day = day(info.ModTime())
+	}
+
+	return nil
+}
+
+// SetOptions changes the options of the writer, which apply from the next write.
+func (w *Writer) SetOptions(options Options) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.options = options
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	// Reopen the file if opening it failed after the last rotation
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	now := time.Now()
+
+	if w.size > 0 && ((w.options.MaxSize > 0 && w.size+int64(len(p)) > w.options.MaxSize) || (w.options.Daily && day(now) != w.day)) {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	w.day = day(now)
+
+	return n, err
+}
+
+func (w *Writer) rotate(now time.Time) error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	w.file = nil
+
+	// The names of rotated files must sort in the order of rotation, so a file rotated within the same millisecond as
+	// the previous file does not overwrite it and is not removed as the oldest file
+	now = now.Truncate(time.Millisecond)
+	if next := w.rotatedAt.Add(time.Millisecond); now.Before(next) {
+		now = next
+	}
+
+	var rotatedPath string
+	for {
+		rotatedPath = w.rotatedPath(now)
+		if !exists(rotatedPath) && !exists(rotatedPath+".gz") {
+			break
+		}
+		now = now.Add(time.Millisecond)
+	}
+	w.rotatedAt = now
+
+	if err := os.Rename(w.path, rotatedPath); err != nil {
+		return fmt.Errorf("failed to rotate file: %w", err)
+	}
+
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if w.options.Compress {
+		w.compressingPaths[rotatedPath] = struct{}{}
+
+		w.compressing.Add(1)
+		go func() {
+			defer w.compressing.Done()
+
+			if err := compress(rotatedPath); err != nil {
+				w.logger.Error("Failed to compress rotated file", zap.String("file.path", rotatedPath), zap.Error(err))
+			}
+
+			w.mu.Lock()
+			defer w.mu.Unlock()
+
+			delete(w.compressingPaths, rotatedPath)
+			if err := w.prune(); err != nil {
+				w.logger.Error("Failed to remove old rotated files", zap.Error(err))
+			}
+		}()
+	}
+
+	if err := w.prune(); err != nil {
+		w.logger.Error("Failed to remove old rotated files", zap.Error(err))
+	}
+
+	return nil
+}
+
+// rotatedPath returns the name of the file rotated at the time.
+func (w *Writer) rotatedPath(t time.Time) string {
+	ext := filepath.Ext(w.path)
+
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(w.path, ext), t.UTC().Format(timeLayout), ext)
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// prune removes the oldest rotated files if there are more than MaxFiles. Files that are being compressed are skipped,
+// they are pruned once they have been compressed. The lock must be held.
+func (w *Writer) prune() error {
+	if w.options.MaxFiles <= 0 {
+		return nil
+	}
+
+	dir := filepath.Dir(w.path)
+	ext := filepath.Ext(w.path)
+	prefix := strings.TrimSuffix(filepath.Base(w.path), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list rotated files: %w", err)
+	}
+
+	rotated := make(map[string][]string)
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok {
+			continue
+		}
+		name, ok = strings.CutSuffix(strings.TrimSuffix(name, ".gz"), ext)
+		if !ok {
+			continue
+		}
+		if _, err := time.Parse(timeLayout, name); err != nil {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if _, ok := w.compressingPaths[strings.TrimSuffix(path, ".gz")]; ok {
+			continue
+		}
+
+		rotated[name] = append(rotated[name], path)
+	}
+
+	times := make([]string, 0, len(rotated))
+	for t := range rotated {
+		times = append(times, t)
+	}
+	// The time layout sorts in chronological order
+	sort.Strings(times)
+
+	var errs []error
+	for i := 0; i < len(times)-w.options.MaxFiles; i++ {
+		for _, path := range rotated[times[i]] {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// compress writes a gzip compressed copy of the file and removes the file.
+func compress(path string) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			dst.Close()
+			os.Remove(dst.Name())
+		}
+	}()
+
+	gz := gzip.NewWriter(dst)
+	if _, err := io.Copy(gz, src); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	src.Close()
+
+	return os.Remove(path)
+}
+
+// Close closes the file and waits for rotated files to be compressed.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+
+	w.compressing.Wait()
+
+	return err
+}
+
+func day(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
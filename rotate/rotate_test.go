@@ -0,0 +1,256 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readFiles returns the contents of all files in the directory by name, the names of rotated files are replaced by
+// their order of rotation. Compressed files are decompressed.
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	files := make(map[string]string)
+	rotated := 0
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var r io.Reader = f
+		if strings.HasSuffix(name, ".gz") {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("failed to decompress %s: %v", name, err)
+			}
+			r = gz
+		}
+
+		data, err := io.ReadAll(r)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if name != "data.lp" {
+			rotated++
+			name = "rotated-" + strconv.Itoa(rotated)
+		}
+		files[name] = string(data)
+	}
+
+	return files
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+		writes  []string
+		want    map[string]string
+	}{
+		{
+			name:    "no rotation",
+			options: Options{},
+			writes:  []string{"a\n", "b\n", "c\n"},
+			want:    map[string]string{"data.lp": "a\nb\nc\n"},
+		},
+		{
+			name:    "rotation by size",
+			options: Options{MaxSize: 4},
+			writes:  []string{"a\n", "b\n", "c\n"},
+			want: map[string]string{
+				"rotated-1": "a\nb\n",
+				"data.lp":   "c\n",
+			},
+		},
+		{
+			name:    "write larger than the maximum size",
+			options: Options{MaxSize: 4},
+			writes:  []string{"abcdef\n", "b\n"},
+			want: map[string]string{
+				"rotated-1": "abcdef\n",
+				"data.lp":   "b\n",
+			},
+		},
+		{
+			name:    "rotation within a millisecond",
+			options: Options{MaxSize: 1},
+			writes:  []string{"a\n", "b\n", "c\n", "d\n"},
+			want: map[string]string{
+				"rotated-1": "a\n",
+				"rotated-2": "b\n",
+				"rotated-3": "c\n",
+				"data.lp":   "d\n",
+			},
+		},
+		{
+			name:    "compression",
+			options: Options{MaxSize: 4, Compress: true},
+			writes:  []string{"a\n", "b\n", "c\n", "d\n", "e\n"},
+			want: map[string]string{
+				"rotated-1": "a\nb\n",
+				"rotated-2": "c\nd\n",
+				"data.lp":   "e\n",
+			},
+		},
+		{
+			name:    "retention",
+			options: Options{MaxSize: 1, MaxFiles: 2},
+			writes:  []string{"a\n", "b\n", "c\n", "d\n", "e\n"},
+			want: map[string]string{
+				"rotated-1": "c\n",
+				"rotated-2": "d\n",
+				"data.lp":   "e\n",
+			},
+		},
+		{
+			name:    "retention with compression",
+			options: Options{MaxSize: 1, MaxFiles: 1, Compress: true},
+			writes:  []string{"a\n", "b\n", "c\n"},
+			want: map[string]string{
+				"rotated-1": "b\n",
+				"data.lp":   "c\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			w, err := NewWriter(nil, filepath.Join(dir, "data.lp"), tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, write := range tt.writes {
+				if _, err := w.Write([]byte(write)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := readFiles(t, dir)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %d files, want %d: %q", len(got), len(tt.want), got)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("got %s %q, want %q", name, got[name], want)
+				}
+			}
+
+			if tt.options.Compress {
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, entry := range entries {
+					if entry.Name() != "data.lp" && !strings.HasSuffix(entry.Name(), ".gz") {
+						t.Errorf("rotated file %s is not compressed", entry.Name())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWriterDaily(t *testing.T) {
+	tests := []struct {
+		name  string
+		daily bool
+		want  map[string]string
+	}{
+		{
+			name:  "daily",
+			daily: true,
+			want: map[string]string{
+				"rotated-1": "yesterday\n",
+				"data.lp":   "today\n",
+			},
+		},
+		{
+			name: "not daily",
+			want: map[string]string{
+				"data.lp": "yesterday\ntoday\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "data.lp")
+
+			// The day of an existing file is the day it was last written
+			if err := os.WriteFile(path, []byte("yesterday\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			yesterday := time.Now().Add(-24 * time.Hour)
+			if err := os.Chtimes(path, yesterday, yesterday); err != nil {
+				t.Fatal(err)
+			}
+
+			w, err := NewWriter(nil, path, Options{Daily: tt.daily})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := w.Write([]byte("today\n")); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			got := readFiles(t, dir)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %d files, want %d: %q", len(got), len(tt.want), got)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("got %s %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriterClosed(t *testing.T) {
+	w, err := NewWriter(nil, filepath.Join(t.TempDir(), "data.lp"), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("a\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("Write() error = %v, want %v", err, os.ErrClosed)
+	}
+}
@@ -0,0 +1,106 @@
+package simulate
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type Protocol string
+
+const (
+	ProtocolWunderground Protocol = "wunderground"
+	ProtocolEcowitt      Protocol = "ecowitt"
+)
+
+func ParseProtocol(value string) (Protocol, error) {
+	switch Protocol(value) {
+	case ProtocolWunderground, ProtocolEcowitt:
+		return Protocol(value), nil
+	default:
+		return "", fmt.Errorf("unsupported protocol %s", value)
+	}
+}
+
+const dateLayout = "2006-01-02 15:04:05"
+
+// WundergroundValues returns the query parameters of a Wunderground upload, as sent by a console using the
+// customized Wunderground protocol.
+func WundergroundValues(stationID, password string, sample Sample) url.Values {
+	return url.Values{
+		"ID":             {stationID},
+		"PASSWORD":       {password},
+		"action":         {"updateraww"},
+		"realtime":       {"1"},
+		"rtfreq":         {"5"},
+		"softwaretype":   {"ws-upload-simulator"},
+		"dateutc":        {sample.Time.UTC().Format(dateLayout)},
+		"tempf":          {formatFloat(sample.OutsideTemperatureFahrenheit, 1)},
+		"indoortempf":    {formatFloat(sample.IndoorTemperatureFahrenheit, 1)},
+		"dewptf":         {formatFloat(sample.DewpointFahrenheit, 1)},
+		"windchillf":     {formatFloat(sample.WindchillFahrenheit, 1)},
+		"humidity":       {formatFloat(sample.OutsideRelativeHumidity, 0)},
+		"indoorhumidity": {formatFloat(sample.IndoorRelativeHumidity, 0)},
+		"baromin":        {formatFloat(sample.RelativePressureInchesOfMercury, 2)},
+		"absbaromin":     {formatFloat(sample.AbsolutePressureInchesOfMercury, 2)},
+		"UV":             {formatFloat(sample.UVIndex, 0)},
+		"solarradiation": {formatFloat(sample.SolarRadiationWattPerMeterSquared, 2)},
+		"winddir":        {strconv.FormatInt(sample.WindDirectionDegrees, 10)},
+		"windspeedmph":   {formatFloat(sample.WindSpeedMph, 1)},
+		"windgustmph":    {formatFloat(sample.WindGustMph, 1)},
+		"rainin":         {formatFloat(sample.HourlyRainInches, 3)},
+		"dailyrainin":    {formatFloat(sample.DailyRainInches, 3)},
+		"weeklyrainin":   {formatFloat(sample.WeeklyRainInches, 3)},
+		"monthlyrainin":  {formatFloat(sample.MonthlyRainInches, 3)},
+	}
+}
+
+// EcowittMAC returns the MAC address of a simulated Ecowitt console, derived from the station ID so every station
+// has its own. It is a locally administered address, so it does not collide with real consoles.
+func EcowittMAC(stationID string) string {
+	sum := sha256.Sum256([]byte(stationID))
+	sum[0] = sum[0]&0xfc | 0x02
+
+	return strings.ToUpper(fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", sum[0], sum[1], sum[2], sum[3], sum[4], sum[5]))
+}
+
+// EcowittPasskey returns the PASSKEY an Ecowitt console sends for its MAC address, which is the MD5 hash of the MAC
+// address.
+func EcowittPasskey(mac string) string {
+	return strings.ToUpper(fmt.Sprintf("%x", md5.Sum([]byte(mac))))
+}
+
+// EcowittValues returns the form values of an Ecowitt upload, as sent by a console using the customized Ecowitt
+// protocol. The PASSKEY is derived from the station ID, see EcowittMAC.
+func EcowittValues(stationID string, sample Sample) url.Values {
+	return url.Values{
+		"PASSKEY":        {EcowittPasskey(EcowittMAC(stationID))},
+		"stationtype":    {"ws-upload-simulator"},
+		"model":          {"simulator"},
+		"freq":           {"868M"},
+		"dateutc":        {sample.Time.UTC().Format(dateLayout)},
+		"tempinf":        {formatFloat(sample.IndoorTemperatureFahrenheit, 1)},
+		"humidityin":     {formatFloat(sample.IndoorRelativeHumidity, 0)},
+		"baromrelin":     {formatFloat(sample.RelativePressureInchesOfMercury, 3)},
+		"baromabsin":     {formatFloat(sample.AbsolutePressureInchesOfMercury, 3)},
+		"tempf":          {formatFloat(sample.OutsideTemperatureFahrenheit, 1)},
+		"humidity":       {formatFloat(sample.OutsideRelativeHumidity, 0)},
+		"winddir":        {strconv.FormatInt(sample.WindDirectionDegrees, 10)},
+		"windspeedmph":   {formatFloat(sample.WindSpeedMph, 2)},
+		"windgustmph":    {formatFloat(sample.WindGustMph, 2)},
+		"solarradiation": {formatFloat(sample.SolarRadiationWattPerMeterSquared, 2)},
+		"uv":             {formatFloat(sample.UVIndex, 0)},
+		"rainratein":     {formatFloat(sample.RainRateInchesPerHour, 3)},
+		"hourlyrainin":   {formatFloat(sample.HourlyRainInches, 3)},
+		"dailyrainin":    {formatFloat(sample.DailyRainInches, 3)},
+		"weeklyrainin":   {formatFloat(sample.WeeklyRainInches, 3)},
+		"monthlyrainin":  {formatFloat(sample.MonthlyRainInches, 3)},
+	}
+}
+
+func formatFloat(v float64, precision int) string {
+	return strconv.FormatFloat(v, 'f', precision, 64)
+}
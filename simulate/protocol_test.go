@@ -0,0 +1,47 @@
+package simulate
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestEcowittValues(t *testing.T) {
+	macPattern := regexp.MustCompile(`^[0-9A-F]{2}(:[0-9A-F]{2}){5}$`)
+	passkeyPattern := regexp.MustCompile(`^[0-9A-F]{32}$`)
+
+	sample := NewWeather(1).Next(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	macs := make(map[string]string)
+	passkeys := make(map[string]string)
+
+	for _, stationID := range []string{"simulator1", "simulator2", "simulator3"} {
+		mac := EcowittMAC(stationID)
+		if !macPattern.MatchString(mac) {
+			t.Errorf("EcowittMAC(%s) = %s, want a MAC address", stationID, mac)
+		}
+		if mac != EcowittMAC(stationID) {
+			t.Errorf("EcowittMAC(%s) is not stable", stationID)
+		}
+		if other, ok := macs[mac]; ok {
+			t.Errorf("EcowittMAC(%s) = EcowittMAC(%s) = %s", stationID, other, mac)
+		}
+		macs[mac] = stationID
+
+		passkey := EcowittValues(stationID, sample).Get("PASSKEY")
+		if !passkeyPattern.MatchString(passkey) || passkey != EcowittPasskey(mac) {
+			t.Errorf("PASSKEY of %s = %s, want %s", stationID, passkey, EcowittPasskey(mac))
+		}
+		if other, ok := passkeys[passkey]; ok {
+			t.Errorf("PASSKEY of %s equals the PASSKEY of %s", stationID, other)
+		}
+		passkeys[passkey] = stationID
+	}
+}
+
+func TestEcowittPasskey(t *testing.T) {
+	// The PASSKEY is the uppercase MD5 hash of the MAC address, as sent by Ecowitt consoles
+	if got, want := EcowittPasskey("AA:BB:CC:DD:EE:FF"), "6393CFC4AB6D416690B21278957AEAB2"; got != want {
+		t.Errorf("EcowittPasskey() = %s, want %s", got, want)
+	}
+}
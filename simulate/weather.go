@@ -0,0 +1,232 @@
+package simulate
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Sample is a simulated set of measurements, in the units used by the station protocols
+type Sample struct {
+	Time time.Time
+
+	OutsideTemperatureFahrenheit float64
+	IndoorTemperatureFahrenheit  float64
+	DewpointFahrenheit           float64
+	WindchillFahrenheit          float64
+
+	OutsideRelativeHumidity float64
+	IndoorRelativeHumidity  float64
+
+	RelativePressureInchesOfMercury float64
+	AbsolutePressureInchesOfMercury float64
+
+	UVIndex                           float64
+	SolarRadiationWattPerMeterSquared float64
+
+	WindDirectionDegrees int64
+	WindSpeedMph         float64
+	WindGustMph          float64
+
+	RainRateInchesPerHour float64
+	HourlyRainInches      float64
+	DailyRainInches       float64
+	WeeklyRainInches      float64
+	MonthlyRainInches     float64
+}
+
+// Weather generates synthetic but plausible weather: a diurnal temperature cycle, a slowly drifting pressure and
+// wind, gusts and occasional rain events.
+type Weather struct {
+	rand *rand.Rand
+
+	meanTemperatureCelsius  float64
+	dailyRangeCelsius       float64
+	temperatureNoiseCelsius float64
+
+	pressureHectopascal      float64
+	windSpeedMetersPerSecond float64
+	windDirection            float64
+	cloudiness               float64
+
+	rainRemaining              time.Duration
+	rainRateMillimetersPerHour float64
+	rainEvents                 []rainEvent
+	dailyRainMillimeters       float64
+	weeklyRainMillimeters      float64
+	monthlyRainMillimeters     float64
+
+	last time.Time
+}
+
+type rainEvent struct {
+	time        time.Time
+	millimeters float64
+}
+
+func NewWeather(seed int64) *Weather {
+	r := rand.New(rand.NewSource(seed))
+
+	return &Weather{
+		rand: r,
+
+		meanTemperatureCelsius: 8 + r.Float64()*10,
+		dailyRangeCelsius:      6 + r.Float64()*6,
+
+		pressureHectopascal:      1005 + r.Float64()*20,
+		windSpeedMetersPerSecond: 1 + r.Float64()*4,
+		windDirection:            r.Float64() * 360,
+		cloudiness:               r.Float64(),
+	}
+}
+
+// Next advances the weather to t and returns a sample. Calls must use non-decreasing times.
+func (w *Weather) Next(t time.Time) Sample {
+	dt := 16 * time.Second
+	if !w.last.IsZero() {
+		dt = t.Sub(w.last)
+		w.resetAccumulators(t)
+	}
+	w.last = t
+	hours := dt.Hours()
+
+	// Slowly drifting weather systems
+	w.pressureHectopascal = clamp(w.pressureHectopascal+w.rand.NormFloat64()*0.5*math.Sqrt(hours), 970, 1045)
+	w.cloudiness = clamp(w.cloudiness+w.rand.NormFloat64()*0.2*math.Sqrt(hours), 0, 1)
+	w.windSpeedMetersPerSecond = clamp(w.windSpeedMetersPerSecond+w.rand.NormFloat64()*0.8*math.Sqrt(hours), 0, 25)
+	w.windDirection = math.Mod(w.windDirection+w.rand.NormFloat64()*20*math.Sqrt(hours)+360, 360)
+	w.temperatureNoiseCelsius = clamp(w.temperatureNoiseCelsius*0.95+w.rand.NormFloat64()*0.1, -2, 2)
+
+	w.updateRain(t, dt)
+
+	hourOfDay := float64(t.Hour()) + float64(t.Minute())/60
+
+	// Coldest around 05:00, warmest around 15:00
+	var temperature float64
+	if hourOfDay >= 5 && hourOfDay <= 15 {
+		temperature = w.meanTemperatureCelsius - w.dailyRangeCelsius/2*math.Cos((hourOfDay-5)/10*math.Pi)
+	} else {
+		temperature = w.meanTemperatureCelsius + w.dailyRangeCelsius/2*math.Cos(math.Mod(hourOfDay+24-15, 24)/14*math.Pi)
+	}
+	temperature += w.temperatureNoiseCelsius - w.cloudiness*2
+	if w.rainRemaining > 0 {
+		temperature -= 2
+	}
+
+	humidity := clamp(95-2.5*(temperature-w.meanTemperatureCelsius+w.dailyRangeCelsius/2)-20*(1-w.cloudiness), 20, 99)
+	if w.rainRemaining > 0 {
+		humidity = clamp(humidity+15, 20, 99)
+	}
+
+	solarRadiation := 0.0
+	if elevation := math.Sin((hourOfDay - 6) / 12 * math.Pi); elevation > 0 {
+		solarRadiation = 900 * elevation * (1 - 0.75*w.cloudiness)
+	}
+
+	windSpeed := math.Max(0, w.windSpeedMetersPerSecond*(1+w.rand.NormFloat64()*0.25))
+	windGust := windSpeed * (1.2 + w.rand.Float64()*0.8)
+
+	indoorTemperature := 20.5 + 0.5*math.Sin(hourOfDay/24*2*math.Pi) + w.rand.NormFloat64()*0.1
+
+	return Sample{
+		Time: t,
+
+		OutsideTemperatureFahrenheit: celsiusToFahrenheit(temperature),
+		IndoorTemperatureFahrenheit:  celsiusToFahrenheit(indoorTemperature),
+		DewpointFahrenheit:           celsiusToFahrenheit(dewpoint(temperature, humidity)),
+		WindchillFahrenheit:          celsiusToFahrenheit(windchill(temperature, windSpeed)),
+
+		OutsideRelativeHumidity: math.Round(humidity),
+		IndoorRelativeHumidity:  math.Round(45 + w.rand.NormFloat64()),
+
+		RelativePressureInchesOfMercury: w.pressureHectopascal * 100 / 3386,
+		AbsolutePressureInchesOfMercury: (w.pressureHectopascal - 5) * 100 / 3386,
+
+		UVIndex:                           math.Round(solarRadiation / 100),
+		SolarRadiationWattPerMeterSquared: math.Round(solarRadiation*10) / 10,
+
+		WindDirectionDegrees: int64(math.Round(w.windDirection+w.rand.NormFloat64()*10+360)) % 360,
+		WindSpeedMph:         windSpeed / 0.44704,
+		WindGustMph:          windGust / 0.44704,
+
+		RainRateInchesPerHour: w.rainRateMillimetersPerHour / 25.4,
+		HourlyRainInches:      w.hourlyRain(t) / 25.4,
+		DailyRainInches:       w.dailyRainMillimeters / 25.4,
+		WeeklyRainInches:      w.weeklyRainMillimeters / 25.4,
+		MonthlyRainInches:     w.monthlyRainMillimeters / 25.4,
+	}
+}
+
+func (w *Weather) updateRain(t time.Time, dt time.Duration) {
+	if w.rainRemaining <= 0 {
+		w.rainRateMillimetersPerHour = 0
+
+		// Rain events are more likely when it is cloudy, on average one per day
+		if w.rand.Float64() < dt.Hours()/24*2*w.cloudiness {
+			w.rainRemaining = time.Duration(10+w.rand.Intn(110)) * time.Minute
+			w.rainRateMillimetersPerHour = 0.5 + w.rand.ExpFloat64()*3
+		} else {
+			return
+		}
+	}
+
+	w.rainRemaining -= dt
+	w.rainRateMillimetersPerHour = clamp(w.rainRateMillimetersPerHour*(1+w.rand.NormFloat64()*0.2), 0.2, 50)
+
+	millimeters := w.rainRateMillimetersPerHour * dt.Hours()
+	w.rainEvents = append(w.rainEvents, rainEvent{time: t, millimeters: millimeters})
+	w.dailyRainMillimeters += millimeters
+	w.weeklyRainMillimeters += millimeters
+	w.monthlyRainMillimeters += millimeters
+}
+
+func (w *Weather) hourlyRain(t time.Time) float64 {
+	var total float64
+	var keep []rainEvent
+	for _, event := range w.rainEvents {
+		if t.Sub(event.time) < time.Hour {
+			total += event.millimeters
+			keep = append(keep, event)
+		}
+	}
+	w.rainEvents = keep
+
+	return total
+}
+
+func (w *Weather) resetAccumulators(t time.Time) {
+	if t.YearDay() != w.last.YearDay() || t.Year() != w.last.Year() {
+		w.dailyRainMillimeters = 0
+	}
+	if t.Weekday() == time.Sunday && w.last.Weekday() != time.Sunday {
+		w.weeklyRainMillimeters = 0
+	}
+	if t.Month() != w.last.Month() {
+		w.monthlyRainMillimeters = 0
+	}
+}
+
+func celsiusToFahrenheit(celsius float64) float64 {
+	return celsius*9/5 + 32
+}
+
+// dewpoint uses the Magnus formula
+func dewpoint(celsius, relativeHumidity float64) float64 {
+	const b, c = 17.62, 243.12
+	gamma := math.Log(relativeHumidity/100) + b*celsius/(c+celsius)
+	return c * gamma / (b - gamma)
+}
+
+// windchill uses the formula of the North American and UK wind chill index
+func windchill(celsius, metersPerSecond float64) float64 {
+	kmh := metersPerSecond * 3.6
+	if celsius > 10 || kmh < 4.8 {
+		return celsius
+	}
+
+	return 13.12 + 0.6215*celsius - 11.37*math.Pow(kmh, 0.16) + 0.3965*celsius*math.Pow(kmh, 0.16)
+}
+
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(max, v))
+}
@@ -0,0 +1,53 @@
+package wsupload
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrClockSkew = errors.New("observation time exceeds the maximum clock skew")
+
+type ClockSkewPolicy string
+
+const (
+	// ClockSkewPolicyTrustStation keeps the observation time sent by the station
+	ClockSkewPolicyTrustStation ClockSkewPolicy = "trust-station"
+	// ClockSkewPolicyTrustServer replaces the observation time by the server time
+	ClockSkewPolicyTrustServer ClockSkewPolicy = "trust-server"
+	// ClockSkewPolicyReject rejects the observation
+	ClockSkewPolicyReject ClockSkewPolicy = "reject"
+)
+
+func ParseClockSkewPolicy(value string) (ClockSkewPolicy, error) {
+	switch ClockSkewPolicy(value) {
+	case ClockSkewPolicyTrustStation, ClockSkewPolicyTrustServer, ClockSkewPolicyReject:
+		return ClockSkewPolicy(value), nil
+	default:
+		return "", fmt.Errorf("unsupported clock skew policy %s", value)
+	}
+}
+
+// ApplyClockSkewPolicy compares the observation time to now and applies the policy if the difference is larger than
+// maxSkew. Observations without an observation time always get the server time. The returned skew is the observation
+// time minus now, as sent by the station.
+func ApplyClockSkewPolicy(obs *Observation, now time.Time, maxSkew time.Duration, policy ClockSkewPolicy) (time.Duration, error) {
+	if obs.ObservationTime.IsZero() {
+		obs.ObservationTime = now
+		return 0, nil
+	}
+
+	skew := obs.ObservationTime.Sub(now)
+	if maxSkew <= 0 || (skew <= maxSkew && skew >= -maxSkew) {
+		return skew, nil
+	}
+
+	switch policy {
+	case ClockSkewPolicyTrustServer:
+		obs.ObservationTime = now
+	case ClockSkewPolicyReject:
+		return skew, fmt.Errorf("%w: %s", ErrClockSkew, skew)
+	}
+
+	return skew, nil
+}
@@ -0,0 +1,171 @@
+package wsupload
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseClockSkewPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ClockSkewPolicy
+		wantErr bool
+	}{
+		{value: "trust-station", want: ClockSkewPolicyTrustStation},
+		{value: "trust-server", want: ClockSkewPolicyTrustServer},
+		{value: "reject", want: ClockSkewPolicyReject},
+		{value: "", wantErr: true},
+		{value: "Reject", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseClockSkewPolicy(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseClockSkewPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseClockSkewPolicy() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyClockSkewPolicy(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		observationTime time.Time
+		maxSkew         time.Duration
+		policy          ClockSkewPolicy
+		wantTime        time.Time
+		wantSkew        time.Duration
+		wantErr         bool
+	}{
+		{
+			name:     "missing observation time",
+			maxSkew:  time.Minute,
+			policy:   ClockSkewPolicyReject,
+			wantTime: now,
+		},
+		{
+			name:            "within maximum skew",
+			observationTime: now.Add(-time.Minute),
+			maxSkew:         time.Minute,
+			policy:          ClockSkewPolicyReject,
+			wantTime:        now.Add(-time.Minute),
+			wantSkew:        -time.Minute,
+		},
+		{
+			name:            "no maximum skew",
+			observationTime: now.Add(-24 * time.Hour),
+			policy:          ClockSkewPolicyReject,
+			wantTime:        now.Add(-24 * time.Hour),
+			wantSkew:        -24 * time.Hour,
+		},
+		{
+			name:            "trust station",
+			observationTime: now.Add(time.Hour),
+			maxSkew:         time.Minute,
+			policy:          ClockSkewPolicyTrustStation,
+			wantTime:        now.Add(time.Hour),
+			wantSkew:        time.Hour,
+		},
+		{
+			name:            "trust server",
+			observationTime: now.Add(-time.Hour),
+			maxSkew:         time.Minute,
+			policy:          ClockSkewPolicyTrustServer,
+			wantTime:        now,
+			wantSkew:        -time.Hour,
+		},
+		{
+			name:            "reject ahead",
+			observationTime: now.Add(time.Minute + time.Second),
+			maxSkew:         time.Minute,
+			policy:          ClockSkewPolicyReject,
+			wantTime:        now.Add(time.Minute + time.Second),
+			wantSkew:        time.Minute + time.Second,
+			wantErr:         true,
+		},
+		{
+			name:            "reject behind",
+			observationTime: now.Add(-time.Hour),
+			maxSkew:         time.Minute,
+			policy:          ClockSkewPolicyReject,
+			wantTime:        now.Add(-time.Hour),
+			wantSkew:        -time.Hour,
+			wantErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obs := &Observation{ObservationTime: tt.observationTime}
+
+			skew, err := ApplyClockSkewPolicy(obs, now, tt.maxSkew, tt.policy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ApplyClockSkewPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrClockSkew) {
+				t.Errorf("ApplyClockSkewPolicy() error = %v, want %v", err, ErrClockSkew)
+			}
+			if skew != tt.wantSkew {
+				t.Errorf("ApplyClockSkewPolicy() skew = %s, want %s", skew, tt.wantSkew)
+			}
+			if !obs.ObservationTime.Equal(tt.wantTime) {
+				t.Errorf("ObservationTime = %s, want %s", obs.ObservationTime, tt.wantTime)
+			}
+		})
+	}
+}
+
+func TestParseObservationTime(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   string
+		options ParseOptions
+		want    time.Time
+	}{
+		{
+			name:  "utc",
+			value: "2024-06-01 10:00:00",
+			want:  time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "station time zone",
+			value:   "2024-06-01 10:00:00",
+			options: ParseOptions{Location: amsterdam},
+			want:    time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "now",
+			value:   "now",
+			options: ParseOptions{Now: now},
+			want:    now,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obs, err := Parse(url.Values{"ID": {"station"}, "dateutc": {tt.value}}, tt.options, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !obs.ObservationTime.Equal(tt.want) {
+				t.Errorf("ObservationTime = %s, want %s", obs.ObservationTime, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package wsupload
+
+import (
+	"sync"
+	"time"
+)
+
+type HealthState string
+
+const (
+	// HealthStateConnected means the publisher is connected and publishing works
+	HealthStateConnected HealthState = "connected"
+	// HealthStateDegraded means the publisher is connected, but publishing recently failed
+	HealthStateDegraded HealthState = "degraded"
+	// HealthStateFailing means the publisher is unable to publish
+	HealthStateFailing HealthState = "failing"
+)
+
+// Worse returns whether s is a worse state than other.
+func (s HealthState) Worse(other HealthState) bool {
+	return healthStateSeverity[s] > healthStateSeverity[other]
+}
+
+var healthStateSeverity = map[HealthState]int{
+	HealthStateConnected: 0,
+	HealthStateDegraded:  1,
+	HealthStateFailing:   2,
+}
+
+type Health struct {
+	State         HealthState `json:"state"`
+	LastError     string      `json:"last_error,omitempty"`
+	LastErrorTime *time.Time  `json:"last_error_time,omitempty"`
+}
+
+// HealthReporter is implemented by publishers that can report their health. Publishers that do not implement it are
+// always considered to be connected.
+type HealthReporter interface {
+	Health() Health
+}
+
+// PublisherHealth returns the health of the publisher.
+func PublisherHealth(publisher Publisher) Health {
+	if reporter, ok := publisher.(HealthReporter); ok {
+		return reporter.Health()
+	}
+
+	return Health{
+		State: HealthStateConnected,
+	}
+}
+
+// HealthTracker keeps track of the health of a publisher. It is safe for concurrent use.
+type HealthTracker struct {
+	mu     sync.Mutex
+	health Health
+}
+
+func NewHealthTracker(state HealthState) *HealthTracker {
+	return &HealthTracker{
+		health: Health{
+			State: state,
+		},
+	}
+}
+
+// Connected sets the state to connected, keeping the last error.
+func (t *HealthTracker) Connected() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.health.State = HealthStateConnected
+}
+
+// Degraded sets the state to degraded if the publisher is not failing, and records the error.
+func (t *HealthTracker) Degraded(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.health.State != HealthStateFailing {
+		t.health.State = HealthStateDegraded
+	}
+	t.setError(err)
+}
+
+// Failing sets the state to failing and records the error.
+func (t *HealthTracker) Failing(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.health.State = HealthStateFailing
+	t.setError(err)
+}
+
+func (t *HealthTracker) setError(err error) {
+	if err == nil {
+		return
+	}
+
+	now := time.Now()
+
+	t.health.LastError = err.Error()
+	t.health.LastErrorTime = &now
+}
+
+func (t *HealthTracker) Health() Health {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.health
+}
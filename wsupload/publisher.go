@@ -1,7 +1,38 @@
 package wsupload
 
+import (
+	"context"
+	"time"
+)
+
 type Publisher interface {
 	Publish(obs *Observation) error
 
 	Close() error
 }
+
+// ObservationTimesLister is implemented by publishers that store observations and can list the times of the stored
+// observations of a station. It is used to skip observations that already exist when importing observations.
+type ObservationTimesLister interface {
+	ObservationTimes(ctx context.Context, stationID string, start, end time.Time) ([]time.Time, error)
+}
+
+// ObservationQuerier is implemented by publishers that store observations and can read back the stored observations
+// of a station.
+type ObservationQuerier interface {
+	Observations(ctx context.Context, stationID string, start, end time.Time) ([]*Observation, error)
+}
+
+// AvailabilityPublisher is implemented by publishers that publish whether stations are online, which is the case as
+// long as they keep uploading.
+type AvailabilityPublisher interface {
+	PublishAvailability(stationID string, online bool) error
+}
+
+// StatefulPublisher is implemented by publishers that keep state which should not be lost when the configuration is
+// reloaded. TakeState is called with the publisher of the same name and type it replaces, before the replaced
+// publisher is closed. Observations published to the replaced publisher afterwards should be handled by the new
+// publisher.
+type StatefulPublisher interface {
+	TakeState(previous Publisher)
+}
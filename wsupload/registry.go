@@ -0,0 +1,64 @@
+package wsupload
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// PublisherFactory creates publishers of a single type. Publisher packages register their factories using
+// RegisterPublisher, so publishers can be created by type name from configuration.
+type PublisherFactory struct {
+	// Type is the name of the publisher type as used in configuration
+	Type string
+	// NewOptions returns a pointer to a new options struct with all defaults set. The configuration of a publisher is
+	// decoded into this struct. It may be nil if the publisher has no options.
+	NewOptions func() interface{}
+	// New creates a publisher using the options returned by NewOptions.
+	New func(logger *zap.Logger, options interface{}) (Publisher, error)
+}
+
+var (
+	publisherFactoriesMu sync.RWMutex
+	publisherFactories   = make(map[string]PublisherFactory)
+)
+
+// RegisterPublisher registers a publisher factory. It panics if a factory with the same type is already registered.
+func RegisterPublisher(factory PublisherFactory) {
+	publisherFactoriesMu.Lock()
+	defer publisherFactoriesMu.Unlock()
+
+	if factory.Type == "" || factory.New == nil {
+		panic("wsupload: invalid publisher factory")
+	}
+	if _, ok := publisherFactories[factory.Type]; ok {
+		panic(fmt.Sprintf("wsupload: publisher type %s is already registered", factory.Type))
+	}
+
+	publisherFactories[factory.Type] = factory
+}
+
+func LookupPublisher(publisherType string) (PublisherFactory, bool) {
+	publisherFactoriesMu.RLock()
+	defer publisherFactoriesMu.RUnlock()
+
+	factory, ok := publisherFactories[publisherType]
+
+	return factory, ok
+}
+
+// PublisherTypes returns the sorted types of all registered publishers.
+func PublisherTypes() []string {
+	publisherFactoriesMu.RLock()
+	defer publisherFactoriesMu.RUnlock()
+
+	types := make([]string, 0, len(publisherFactories))
+	for publisherType := range publisherFactories {
+		types = append(types, publisherType)
+	}
+	sort.Strings(types)
+
+	return types
+}
@@ -0,0 +1,420 @@
+package wsupload
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/fatih/structtag"
+	"github.com/koesie10/ws-upload/x"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+var nullFloat64Type = reflect.TypeOf(NullFloat64{})
+var nullInt64Type = reflect.TypeOf(NullInt64{})
+
+// ObservationSchema is the schema of Observation. It is built once at startup, so any error in the struct tags of
+// Observation will cause a panic during initialization.
+var ObservationSchema = MustNewSchema(reflect.TypeOf(Observation{}))
+
+// Schema describes the fields of a struct as defined by its ws, json, influx and homeassistant struct tags.
+type Schema struct {
+	Type   reflect.Type
+	Fields []*Field
+}
+
+type Field struct {
+	// Name is the Go name of the field
+	Name  string
+	Index int
+	Type  reflect.Type
+
+	// JSONName is the name of the field in the json tag, or empty if the field has no json tag
+	JSONName string
+
+	WS            *WSField
+	Influx        *InfluxField
+	HomeAssistant *HomeAssistantField
+}
+
+type WSField struct {
+	// Key is the query parameter name used by the weather station
+	Key string
+	// Optional is true if the field may be missing from an upload
+	Optional bool
+
+	set func(value string, fieldValue reflect.Value, options ParseOptions) error
+}
+
+type InfluxRole int
+
+const (
+	InfluxRoleField InfluxRole = iota
+	InfluxRoleTag
+	InfluxRoleTimestamp
+)
+
+// InfluxType is the type of an InfluxDB field. InfluxDB rejects writes with a different type than the existing values of
+// a field, so the type of a field should never change.
+type InfluxType string
+
+const (
+	InfluxTypeFloat  InfluxType = "float"
+	InfluxTypeInt    InfluxType = "int"
+	InfluxTypeBool   InfluxType = "bool"
+	InfluxTypeString InfluxType = "string"
+)
+
+func ParseInfluxType(s string) (InfluxType, error) {
+	switch t := InfluxType(s); t {
+	case InfluxTypeFloat, InfluxTypeInt, InfluxTypeBool, InfluxTypeString:
+		return t, nil
+	default:
+		return "", fmt.Errorf("invalid influx type %q, use %s, %s, %s or %s", s, InfluxTypeFloat, InfluxTypeInt, InfluxTypeBool, InfluxTypeString)
+	}
+}
+
+type InfluxField struct {
+	Name string
+	Role InfluxRole
+	// Type is the type of the field value, it is only set for fields with the InfluxRoleField role
+	Type InfluxType
+}
+
+type HomeAssistantField struct {
+	Name              string
+	DeviceClass       string
+	StateClass        string
+	UnitOfMeasurement string
+}
+
+func MustNewSchema(t reflect.Type) *Schema {
+	schema, err := NewSchema(t)
+	if err != nil {
+		panic(fmt.Sprintf("invalid schema for %s: %v", t, err))
+	}
+
+	return schema
+}
+
+func NewSchema(t reflect.Type) (*Schema, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported schema type %s", t)
+	}
+
+	schema := &Schema{
+		Type: t,
+	}
+
+	var hasTimestamp bool
+
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+
+		tag, err := structtag.Parse(string(structField.Tag))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse struct tag for %s: %w", structField.Name, err)
+		}
+
+		field := &Field{
+			Name:  structField.Name,
+			Index: i,
+			Type:  structField.Type,
+		}
+
+		if jsonTag, err := tag.Get("json"); err == nil && jsonTag.Name != "-" {
+			field.JSONName = jsonTag.Name
+		}
+
+		if wsTag, err := tag.Get("ws"); err == nil {
+			field.WS, err = newWSField(structField, wsTag)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		field.Influx, err = newInfluxField(field, tag)
+		if err != nil {
+			return nil, err
+		}
+		if field.Influx != nil && field.Influx.Role == InfluxRoleTimestamp {
+			if hasTimestamp {
+				return nil, fmt.Errorf("multiple timestamps found for %s", field.Name)
+			}
+			hasTimestamp = true
+		}
+
+		if homeAssistantTag, err := tag.Get("homeassistant"); err == nil {
+			field.HomeAssistant, err = newHomeAssistantField(field, homeAssistantTag)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		schema.Fields = append(schema.Fields, field)
+	}
+
+	return schema, nil
+}
+
+// Value returns the value of the field in v, which must be a struct or a pointer to a struct of the schema type.
+func (f *Field) Value(v interface{}) reflect.Value {
+	return reflect.Indirect(reflect.ValueOf(v)).Field(f.Index)
+}
+
+func newWSField(field reflect.StructField, wsTag *structtag.Tag) (*WSField, error) {
+	options := x.ParseStructTagOptions(wsTag.Options)
+
+	wsField := &WSField{
+		Key: wsTag.Name,
+	}
+
+	switch field.Type.Kind() {
+	case reflect.String:
+		wsField.set = func(value string, fieldValue reflect.Value, parseOptions ParseOptions) error {
+			fieldValue.SetString(value)
+			return nil
+		}
+	case reflect.Float64:
+		transformFunc, err := getConversionTransformFunc(options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get conversion transform func for %s: %w", field.Name, err)
+		}
+
+		wsField.set = func(value string, fieldValue reflect.Value, parseOptions ParseOptions) error {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse value: %w", err)
+			}
+
+			fieldValue.SetFloat(transformFunc(v))
+
+			return nil
+		}
+	case reflect.Int64:
+		wsField.set = func(value string, fieldValue reflect.Value, parseOptions ParseOptions) error {
+			v, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse value: %w", err)
+			}
+
+			fieldValue.SetInt(v)
+
+			return nil
+		}
+	case reflect.Struct:
+		if field.Type.AssignableTo(timeType) {
+			location := time.UTC
+			if locationOption, ok := options["location"]; ok {
+				var err error
+				location, err = time.LoadLocation(locationOption)
+				if err != nil {
+					return nil, fmt.Errorf("unsupported location %s for field %s: %w", locationOption, field.Name, err)
+				}
+
+				delete(options, "location")
+			}
+
+			layout := time.RFC3339
+			if formatOption, ok := options["layout"]; ok {
+				layout = formatOption
+
+				delete(options, "layout")
+			}
+
+			wsField.set = func(value string, fieldValue reflect.Value, parseOptions ParseOptions) error {
+				if value == "now" {
+					now := parseOptions.Now
+					if now.IsZero() {
+						now = time.Now()
+					}
+
+					fieldValue.Set(reflect.ValueOf(now))
+					return nil
+				}
+
+				location := location
+				if parseOptions.Location != nil {
+					location = parseOptions.Location
+				}
+
+				t, err := time.ParseInLocation(layout, value, location)
+				if err != nil {
+					return fmt.Errorf("failed to parse date: %w", err)
+				}
+
+				fieldValue.Set(reflect.ValueOf(t))
+
+				return nil
+			}
+		} else if field.Type.AssignableTo(nullFloat64Type) {
+			wsField.Optional = true
+
+			transformFunc, err := getConversionTransformFunc(options)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get conversion transform func for %s: %w", field.Name, err)
+			}
+
+			wsField.set = func(value string, fieldValue reflect.Value, parseOptions ParseOptions) error {
+				if value == "-9999" {
+					fieldValue.Set(reflect.ValueOf(NullFloat64{Valid: false}))
+					return nil
+				}
+
+				v, err := strconv.ParseFloat(value, 64)
+				if err != nil {
+					return fmt.Errorf("failed to parse value: %w", err)
+				}
+
+				fieldValue.Set(reflect.ValueOf(NullFloat64{Valid: true, Float64: transformFunc(v)}))
+
+				return nil
+			}
+		} else if field.Type.AssignableTo(nullInt64Type) {
+			wsField.Optional = true
+
+			wsField.set = func(value string, fieldValue reflect.Value, parseOptions ParseOptions) error {
+				if value == "-9999" {
+					fieldValue.Set(reflect.ValueOf(NullInt64{Valid: false}))
+					return nil
+				}
+
+				v, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return fmt.Errorf("failed to parse value: %w", err)
+				}
+
+				fieldValue.Set(reflect.ValueOf(NullInt64{Valid: true, Int64: v}))
+
+				return nil
+			}
+		}
+	}
+
+	if wsField.set == nil {
+		return nil, fmt.Errorf("unsupported field type %s for %s", field.Type, field.Name)
+	}
+
+	if len(options) > 0 {
+		return nil, fmt.Errorf("unused options %s for %s", options, field.Name)
+	}
+
+	return wsField, nil
+}
+
+func newInfluxField(field *Field, tag *structtag.Tags) (*InfluxField, error) {
+	influxTag, _ := tag.Get("influx")
+
+	influxField := &InfluxField{
+		Name: field.JSONName,
+		Role: InfluxRoleField,
+	}
+
+	if influxTag != nil {
+		if influxTag.Name == "ts" {
+			if !field.Type.AssignableTo(timeType) {
+				return nil, fmt.Errorf("influx timestamp field %s must be a time.Time", field.Name)
+			}
+
+			influxField.Role = InfluxRoleTimestamp
+
+			return influxField, nil
+		}
+
+		if influxTag.Name != "" {
+			influxField.Name = influxTag.Name
+		}
+
+		options := x.ParseStructTagOptions(influxTag.Options)
+		if _, ok := options["tag"]; ok {
+			if field.Type.Kind() != reflect.String {
+				return nil, fmt.Errorf("influx tag field %s must be a string", field.Name)
+			}
+
+			influxField.Role = InfluxRoleTag
+
+			delete(options, "tag")
+		}
+
+		if v, ok := options["type"]; ok {
+			if influxField.Role != InfluxRoleField {
+				return nil, fmt.Errorf("influx type of %s can only be set for fields", field.Name)
+			}
+
+			t, err := ParseInfluxType(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid influx options for %s: %w", field.Name, err)
+			}
+
+			influxField.Type = t
+
+			delete(options, "type")
+		}
+
+		if len(options) > 0 {
+			return nil, fmt.Errorf("unused influx options %s for %s", options, field.Name)
+		}
+	}
+
+	if influxField.Name == "" || influxField.Name == "-" {
+		return nil, nil
+	}
+
+	if influxField.Role == InfluxRoleField && influxField.Type == "" {
+		influxField.Type = defaultInfluxType(field.Type)
+		if influxField.Type == "" {
+			return nil, fmt.Errorf("influx field %s of type %s must have an explicit type", field.Name, field.Type)
+		}
+	}
+
+	return influxField, nil
+}
+
+func newHomeAssistantField(field *Field, homeAssistantTag *structtag.Tag) (*HomeAssistantField, error) {
+	if field.JSONName == "" {
+		return nil, fmt.Errorf("homeassistant field %s must have a json name", field.Name)
+	}
+
+	options := x.ParseStructTagOptions(homeAssistantTag.Options)
+
+	homeAssistantField := &HomeAssistantField{
+		Name:              homeAssistantTag.Name,
+		DeviceClass:       options["device_class"],
+		StateClass:        options["state_class"],
+		UnitOfMeasurement: options["unit_of_measurement"],
+	}
+
+	delete(options, "device_class")
+	delete(options, "state_class")
+	delete(options, "unit_of_measurement")
+
+	if len(options) > 0 {
+		return nil, fmt.Errorf("unused homeassistant options %s for %s", options, field.Name)
+	}
+
+	return homeAssistantField, nil
+}
+
+// defaultInfluxType returns the type of InfluxDB field matching t, or an empty type if there is none.
+func defaultInfluxType(t reflect.Type) InfluxType {
+	switch t {
+	case nullFloat64Type:
+		return InfluxTypeFloat
+	case nullInt64Type:
+		return InfluxTypeInt
+	}
+
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return InfluxTypeFloat
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return InfluxTypeInt
+	case reflect.Bool:
+		return InfluxTypeBool
+	case reflect.String:
+		return InfluxTypeString
+	default:
+		return ""
+	}
+}
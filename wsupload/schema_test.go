@@ -0,0 +1,210 @@
+package wsupload
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestNewSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			value: struct {
+				Station     string      `ws:"ID" json:"station_id" influx:"station_id,tag" homeassistant:"Station ID"`
+				Time        time.Time   `ws:"dateutc,layout=2006-01-02 15:04:05,location=Europe/Amsterdam" json:"time" influx:"ts"`
+				Temperature NullFloat64 `ws:"tempf,conversion=fahrenheit_to_celsius" json:"temperature" homeassistant:"Temperature,device_class=temperature,unit_of_measurement=°C"`
+				Humidity    NullInt64   `ws:"humidity" json:"humidity" influx:",type=int"`
+				Ignored     string      `json:"-"`
+			}{},
+		},
+		{name: "not a struct", value: "", wantErr: true},
+		{
+			name: "malformed struct tag",
+			value: reflect.New(reflect.StructOf([]reflect.StructField{
+				{Name: "Field", Type: reflect.TypeOf(""), Tag: `json:"field`},
+			})).Elem().Interface(),
+			wantErr: true,
+		},
+		{
+			name: "unknown conversion",
+			value: struct {
+				Field NullFloat64 `ws:"field,conversion=kelvin_to_celsius" json:"field"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unused ws option",
+			value: struct {
+				Field NullFloat64 `ws:"field,scale=10" json:"field"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unsupported ws type",
+			value: struct {
+				Field bool `ws:"field" json:"field"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unknown location",
+			value: struct {
+				Field time.Time `ws:"field,location=Mars/Olympus_Mons" json:"field" influx:"ts"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "influx timestamp not a time",
+			value: struct {
+				Field string `json:"field" influx:"ts"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "multiple influx timestamps",
+			value: struct {
+				First  time.Time `json:"first" influx:"ts"`
+				Second time.Time `json:"second" influx:"ts"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "influx tag not a string",
+			value: struct {
+				Field NullFloat64 `json:"field" influx:",tag"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "influx type of a tag",
+			value: struct {
+				Field string `json:"field" influx:",tag,type=string"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unknown influx type",
+			value: struct {
+				Field NullFloat64 `json:"field" influx:",type=double"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unused influx option",
+			value: struct {
+				Field NullFloat64 `json:"field" influx:",precision=2"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "influx field without type",
+			value: struct {
+				Field []string `json:"field"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "homeassistant field without json name",
+			value: struct {
+				Field NullFloat64 `homeassistant:"Field"`
+			}{},
+			wantErr: true,
+		},
+		{
+			name: "unused homeassistant option",
+			value: struct {
+				Field NullFloat64 `json:"field" homeassistant:"Field,icon=mdi:thermometer"`
+			}{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSchema(reflect.TypeOf(tt.value))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSchema() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchemaFields(t *testing.T) {
+	schema, err := NewSchema(reflect.TypeOf(struct {
+		Station     string      `ws:"ID" json:"station_id" influx:"station_id,tag"`
+		Time        time.Time   `ws:"dateutc" json:"time" influx:"ts"`
+		Temperature NullFloat64 `ws:"tempf,conversion=fahrenheit_to_celsius" json:"temperature" homeassistant:"Temperature,device_class=temperature,unit_of_measurement=°C,state_class=measurement"`
+		Count       int64       `json:"count" influx:"total"`
+		Hidden      string      `json:"hidden" influx:"-"`
+	}{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := make(map[string]*Field)
+	for _, field := range schema.Fields {
+		fields[field.Name] = field
+	}
+
+	if f := fields["Station"]; f.WS == nil || f.WS.Key != "ID" || f.WS.Optional || f.Influx.Role != InfluxRoleTag || f.Influx.Name != "station_id" {
+		t.Errorf("Station = %+v", f)
+	}
+	if f := fields["Time"]; f.Influx.Role != InfluxRoleTimestamp {
+		t.Errorf("Time influx = %+v, want timestamp", f.Influx)
+	}
+	if f := fields["Temperature"]; !f.WS.Optional || f.Influx.Type != InfluxTypeFloat || f.Influx.Name != "temperature" {
+		t.Errorf("Temperature = %+v, influx %+v", f, f.Influx)
+	}
+	if f := fields["Temperature"].HomeAssistant; f == nil || *f != (HomeAssistantField{Name: "Temperature", DeviceClass: "temperature", StateClass: "measurement", UnitOfMeasurement: "°C"}) {
+		t.Errorf("Temperature homeassistant = %+v", f)
+	}
+	if f := fields["Count"]; f.WS != nil || f.Influx.Name != "total" || f.Influx.Type != InfluxTypeInt {
+		t.Errorf("Count = %+v, influx %+v", f, f.Influx)
+	}
+	if f := fields["Hidden"]; f.Influx != nil {
+		t.Errorf("Hidden influx = %+v, want nil", f.Influx)
+	}
+}
+
+func TestParse(t *testing.T) {
+	params := url.Values{
+		"ID":          {"station"},
+		"dateutc":     {"2024-01-02 03:04:05"},
+		"tempf":       {"50"},
+		"indoortempf": {"-9999"},
+		"humidity":    {"80"},
+		"baromin":     {"invalid"},
+	}
+
+	obs, err := Parse(params, ParseOptions{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if obs.StationID != "station" {
+		t.Errorf("StationID = %s, want station", obs.StationID)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !obs.ObservationTime.Equal(want) {
+		t.Errorf("ObservationTime = %s, want %s", obs.ObservationTime, want)
+	}
+	if !obs.OutsideTemperatureCelsius.Valid || obs.OutsideTemperatureCelsius.Float64 != 10 {
+		t.Errorf("OutsideTemperatureCelsius = %+v, want 10", obs.OutsideTemperatureCelsius)
+	}
+	if obs.IndoorTemperatureCelsius.Valid {
+		t.Errorf("IndoorTemperatureCelsius = %+v, want null", obs.IndoorTemperatureCelsius)
+	}
+	if !obs.OutsideRelativeHumidity.Valid || obs.OutsideRelativeHumidity.Float64 != 80 {
+		t.Errorf("OutsideRelativeHumidity = %+v, want 80", obs.OutsideRelativeHumidity)
+	}
+	if obs.RelativeAtmosphericPressurePascal.Valid {
+		t.Errorf("RelativeAtmosphericPressurePascal = %+v, want null for an invalid value", obs.RelativeAtmosphericPressurePascal)
+	}
+}